@@ -1,17 +1,143 @@
 package main
 
 import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
 	"log"
+	"os"
+	"os/signal"
+	"runtime"
+	"strings"
+	"syscall"
 
+	"mac-powermetrics-exporter/internal/collector"
 	"mac-powermetrics-exporter/internal/config"
+	"mac-powermetrics-exporter/internal/logging"
 	"mac-powermetrics-exporter/internal/server"
+	"mac-powermetrics-exporter/internal/version"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
 )
 
 func main() {
 	// Load configuration
 	cfg := config.New()
+	cfg.RegisterFlags(flag.CommandLine)
+	checkOnly := flag.Bool("check", false, "Run each enabled collector once, print its metrics and exit; exits non-zero if a collector failed")
+	printVersion := flag.Bool("version", false, "Print the build version and exit")
+	flag.Parse()
+	if *printVersion {
+		fmt.Println(version.Info())
+		return
+	}
+	if cfg.ConfigFile != "" {
+		if err := cfg.LoadFile(cfg.ConfigFile); err != nil {
+			log.Fatal(err)
+		}
+		// Parse again so that flags override the file
+		flag.Parse()
+	}
+	if err := logging.Setup(cfg); err != nil {
+		log.Fatal(err)
+	}
+	if err := cfg.Validate(); err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+	if err := checkPlatform(cfg, runtime.GOOS); err != nil {
+		log.Fatal(err)
+	}
+
+	if *checkOnly {
+		if err := check(cfg, os.Stdout); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	// Stop cleanly on Ctrl-C and on the SIGTERM launchd sends when unloading
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	// Create and run server
+	srv, err := server.New(cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := srv.Run(ctx); err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("Server stopped")
+}
+
+// checkPlatform refuses to start outside macOS, where powermetrics and the
+// other tools the collectors run do not exist. Replaying captured output
+// with --powermetrics.input-file works everywhere.
+func checkPlatform(cfg *config.Config, goos string) error {
+	if goos == "darwin" || cfg.PowermetricsInputFile != "" {
+		return nil
+	}
+	return fmt.Errorf("mac-powermetrics-exporter only runs on macOS, not %s; use --powermetrics.input-file to replay captured powermetrics output", goos)
+}
+
+// check gathers each enabled collector once through its own registry and
+// writes the metrics in the text exposition format. Background sampling is
+// replaced by a single run, since no sample would be ready yet.
+func check(cfg *config.Config, w io.Writer) error {
+	cfg.PowermetricsMode = config.PowermetricsModeScrape
+	cfg.MacmonMode = config.MacmonModeScrape
+
+	var failed []string
+	for _, name := range cfg.EnabledCollectors {
+		registration, ok := collector.Lookup(name)
+		if !ok {
+			return fmt.Errorf("unknown collector %q", name)
+		}
+		registry := prometheus.NewRegistry()
+		if err := registry.Register(registration.Factory(cfg)); err != nil {
+			return fmt.Errorf("collector %q: %w", name, err)
+		}
+		families, err := registry.Gather()
+		if err != nil {
+			log.Printf("Collector %s reported errors: %v", name, err)
+		}
+
+		fmt.Fprintf(w, "# collector: %s\n", name)
+		for _, family := range families {
+			if _, err := expfmt.MetricFamilyToText(w, family); err != nil {
+				return err
+			}
+		}
+		if !collected(cfg, families) {
+			failed = append(failed, name)
+		}
+	}
+
+	if len(failed) > 0 {
+		return fmt.Errorf("collectors failed or produced no metrics: %v", failed)
+	}
+	return nil
+}
 
-	// Create and start server
-	srv := server.New(cfg)
-	log.Fatal(srv.Start())
+// collected reports whether a collector's metrics show that it worked: no
+// *_up gauge is 0, and there is more than the meta metrics that collectors
+// report even when their commands fail
+func collected(cfg *config.Config, families []*dto.MetricFamily) bool {
+	data := false
+	for _, family := range families {
+		if strings.HasSuffix(family.GetName(), "_up") {
+			for _, metric := range family.GetMetric() {
+				if metric.GetGauge().GetValue() == 0 {
+					return false
+				}
+			}
+		}
+		if !collector.IsMetaMetric(cfg, family.GetName()) {
+			data = true
+		}
+	}
+	return data
 }
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"mac-powermetrics-exporter/internal/config"
+)
+
+// fakeCommand puts a shell script named name first on PATH
+func fakeCommand(t *testing.T, dir, name, script string) {
+	t.Helper()
+	if err := os.WriteFile(filepath.Join(dir, name), []byte("#!/bin/sh\n"+script), 0o755); err != nil {
+		t.Fatalf("Failed to write fake %s: %v", name, err)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	fixture, err := filepath.Abs("../internal/collector/testdata/powermetrics_apple_silicon.txt")
+	if err != nil {
+		t.Fatalf("Failed to resolve fixture: %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		collectors []string
+		script     string
+		failed     bool
+	}{
+		{name: "sample", collectors: []string{"powermetrics"}, script: "exec /bin/cat " + fixture + "\n"},
+		// powermetrics_up is 0, though the exporter meta metrics are reported
+		{name: "failing powermetrics", collectors: []string{"powermetrics"}, script: "echo 'powermetrics must be invoked as the superuser' >&2\nexit 1\n", failed: true},
+		// Only vmstat_page_size_bytes is reported without vm_stat and sysctl
+		{name: "failing vmstat", collectors: []string{"vmstat"}, failed: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			t.Setenv("PATH", dir)
+			fakeCommand(t, dir, "powermetrics", tt.script)
+			fakeCommand(t, dir, "vm_stat", "exit 1\n")
+
+			cfg := config.New()
+			cfg.EnabledCollectors = tt.collectors
+			err := check(cfg, io.Discard)
+			if tt.failed && (err == nil || !strings.Contains(err.Error(), tt.collectors[0])) {
+				t.Errorf("Expected check to report %s as failed, got %v", tt.collectors[0], err)
+			}
+			if !tt.failed && err != nil {
+				t.Errorf("Expected check to pass, got %v", err)
+			}
+		})
+	}
+}
+
+func TestCheckMacmonBackground(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("PATH", dir)
+	fakeCommand(t, dir, "macmon", "echo '{\"all_power\":5.1}'\n")
+
+	cfg := config.New()
+	cfg.EnabledCollectors = []string{"macmon"}
+	cfg.MacmonMode = config.MacmonModeBackground
+	if err := check(cfg, io.Discard); err != nil {
+		t.Errorf("Expected check to run macmon once in background mode, got %v", err)
+	}
+}
+
+func TestCheckPlatform(t *testing.T) {
+	cfg := config.New()
+	if err := checkPlatform(cfg, "darwin"); err != nil {
+		t.Errorf("Expected macOS to be accepted, got %v", err)
+	}
+	if err := checkPlatform(cfg, "linux"); err == nil {
+		t.Error("Expected an error outside macOS")
+	}
+	cfg.PowermetricsInputFile = "powermetrics.txt"
+	if err := checkPlatform(cfg, "linux"); err != nil {
+		t.Errorf("Expected input-file replay to be accepted outside macOS, got %v", err)
+	}
+}
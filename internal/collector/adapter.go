@@ -0,0 +1,106 @@
+package collector
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"mac-powermetrics-exporter/internal/config"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// AdapterCollector collects whether a power adapter is connected and its
+// rated wattage, to spot chargers too small for the load
+type AdapterCollector struct {
+	config *config.Config
+	runner commandRunner
+
+	connected *prometheus.Desc
+	watts     *prometheus.Desc
+}
+
+func init() {
+	Register("adapter", "pmset", func(cfg *config.Config) prometheus.Collector { return NewAdapterCollector(cfg) })
+}
+
+// NewAdapterCollector creates a new AdapterCollector
+func NewAdapterCollector(cfg *config.Config) *AdapterCollector {
+	return &AdapterCollector{
+		config: cfg,
+		runner: execRunner{},
+		connected: prometheus.NewDesc(
+			prometheus.BuildFQName(cfg.Namespace, "power", "adapter_connected"),
+			"Whether a power adapter is connected (1) or not (0).",
+			nil,
+			cfg.ConstLabels,
+		),
+		watts: prometheus.NewDesc(
+			prometheus.BuildFQName(cfg.Namespace, "power", "adapter_watts"),
+			"Rated wattage of the connected power adapter.",
+			nil,
+			cfg.ConstLabels,
+		),
+	}
+}
+
+// Describe describes metrics to Prometheus
+func (collector *AdapterCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- collector.connected
+	ch <- collector.watts
+}
+
+// Collect is called by Prometheus when collecting metrics
+func (collector *AdapterCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := scrapeContext(collector.config)
+	defer cancel()
+	out, err := collector.runner.Run(ctx, "pmset", "-g", "ac")
+	if err != nil {
+		logCommandFailure("Failed to run command", "adapter", commandLine("pmset", "-g", "ac"), err, commandStderr(err))
+		return
+	}
+
+	adapter := parseAdapter(bytes.NewReader(out))
+	connected := 0.0
+	if adapter.connected {
+		connected = 1
+	}
+	ch <- prometheus.MustNewConstMetric(collector.connected, prometheus.GaugeValue, connected)
+	if adapter.watts != nil {
+		ch <- prometheus.MustNewConstMetric(collector.watts, prometheus.GaugeValue, *adapter.watts)
+	}
+}
+
+// adapterInfo holds the power adapter details from `pmset -g ac`
+type adapterInfo struct {
+	connected bool
+	watts     *float64 // nil when no adapter is connected or it reports none
+}
+
+// adapterWattagePattern matches the wattage line of `pmset -g ac`, e.g.
+//
+//	Wattage = 96W
+var adapterWattagePattern = regexp.MustCompile(`^\s*Wattage\s*=\s*([\d.]+)W`)
+
+// parseAdapter parses `pmset -g ac` output, which is "No adapter attached."
+// without one and a list of adapter details otherwise
+func parseAdapter(r io.Reader) adapterInfo {
+	var info adapterInfo
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.TrimSpace(line) == "" || strings.Contains(line, "No adapter attached") {
+			continue
+		}
+		info.connected = true
+		if match := adapterWattagePattern.FindStringSubmatch(line); match != nil {
+			if watts, err := strconv.ParseFloat(match[1], 64); err == nil {
+				info.watts = &watts
+			}
+		}
+	}
+	return info
+}
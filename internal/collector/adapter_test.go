@@ -0,0 +1,40 @@
+package collector
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"mac-powermetrics-exporter/internal/config"
+)
+
+func TestParseAdapter(t *testing.T) {
+	f, err := os.Open("testdata/pmset_ac.txt")
+	if err != nil {
+		t.Fatalf("Failed to open fixture: %v", err)
+	}
+	defer f.Close()
+
+	adapter := parseAdapter(f)
+	if !adapter.connected || adapter.watts == nil || *adapter.watts != 96 {
+		t.Errorf("Expected a connected 96 W adapter, got %+v", adapter)
+	}
+
+	adapter = parseAdapter(strings.NewReader("No adapter attached.\n"))
+	if adapter.connected || adapter.watts != nil {
+		t.Errorf("Expected no adapter, got %+v", adapter)
+	}
+}
+
+func TestAdapterCollector(t *testing.T) {
+	collector := NewAdapterCollector(config.New())
+	collector.runner = fakeRunner{"pmset -g ac": {stdout: "No adapter attached.\n"}}
+
+	values := gatherValues(t, collector)
+	if got, ok := values["power_adapter_connected"]; !ok || got != 0 {
+		t.Errorf("Expected power_adapter_connected 0, got %v (present=%v)", got, ok)
+	}
+	if _, ok := values["power_adapter_watts"]; ok {
+		t.Error("Expected no wattage without an adapter")
+	}
+}
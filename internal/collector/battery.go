@@ -0,0 +1,218 @@
+package collector
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"mac-powermetrics-exporter/internal/config"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// BatteryCollector collects the charge, time estimates and health of the
+// internal battery. Macs without a battery report nothing.
+type BatteryCollector struct {
+	config *config.Config
+	runner commandRunner
+
+	charge      *prometheus.Desc
+	timeToEmpty *prometheus.Desc
+	timeToFull  *prometheus.Desc
+	health      *prometheus.Desc
+	condition   *prometheus.Desc
+}
+
+func init() {
+	Register("battery", "pmset", func(cfg *config.Config) prometheus.Collector { return NewBatteryCollector(cfg) })
+}
+
+// NewBatteryCollector creates a new BatteryCollector
+func NewBatteryCollector(cfg *config.Config) *BatteryCollector {
+	return &BatteryCollector{
+		config: cfg,
+		runner: execRunner{},
+		charge: prometheus.NewDesc(
+			prometheus.BuildFQName(cfg.Namespace, "battery", "charge_percent"),
+			"Battery charge in percent.",
+			nil,
+			cfg.ConstLabels,
+		),
+		timeToEmpty: prometheus.NewDesc(
+			prometheus.BuildFQName(cfg.Namespace, "battery", "time_to_empty_minutes"),
+			"Estimated time until the battery is empty in minutes, while discharging.",
+			nil,
+			cfg.ConstLabels,
+		),
+		timeToFull: prometheus.NewDesc(
+			prometheus.BuildFQName(cfg.Namespace, "battery", "time_to_full_minutes"),
+			"Estimated time until the battery is full in minutes, while charging.",
+			nil,
+			cfg.ConstLabels,
+		),
+		health: prometheus.NewDesc(
+			prometheus.BuildFQName(cfg.Namespace, "battery", "health_percent"),
+			"Maximum battery capacity as a percentage of its design capacity.",
+			nil,
+			cfg.ConstLabels,
+		),
+		condition: prometheus.NewDesc(
+			prometheus.BuildFQName(cfg.Namespace, "battery", "condition_info"),
+			"Battery condition reported by macOS, always 1.",
+			[]string{"condition"},
+			cfg.ConstLabels,
+		),
+	}
+}
+
+// Describe describes metrics to Prometheus
+func (collector *BatteryCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- collector.charge
+	ch <- collector.timeToEmpty
+	ch <- collector.timeToFull
+	ch <- collector.health
+	ch <- collector.condition
+}
+
+// Collect is called by Prometheus when collecting metrics
+func (collector *BatteryCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := scrapeContext(collector.config)
+	defer cancel()
+	collector.collectStatus(ctx, ch)
+	collector.collectHealth(ctx, ch)
+}
+
+// collectStatus exports the charge and time estimates from `pmset -g batt`
+func (collector *BatteryCollector) collectStatus(ctx context.Context, ch chan<- prometheus.Metric) {
+	out, err := collector.runner.Run(ctx, "pmset", "-g", "batt")
+	if err != nil {
+		logCommandFailure("Failed to run command", "battery", commandLine("pmset", "-g", "batt"), err, commandStderr(err))
+		return
+	}
+
+	battery, ok := parseBattery(bytes.NewReader(out))
+	if !ok {
+		return
+	}
+	ch <- prometheus.MustNewConstMetric(collector.charge, prometheus.GaugeValue, battery.charge)
+	// macOS prints "(no estimate)" while it is still computing one, and no
+	// time at all when the battery is neither charging nor discharging
+	if battery.remaining == nil {
+		return
+	}
+	switch battery.state {
+	case "discharging":
+		ch <- prometheus.MustNewConstMetric(collector.timeToEmpty, prometheus.GaugeValue, *battery.remaining)
+	case "charging", "finishing charge":
+		ch <- prometheus.MustNewConstMetric(collector.timeToFull, prometheus.GaugeValue, *battery.remaining)
+	}
+}
+
+// collectHealth exports the capacity and condition from the
+// AppleSmartBattery IOKit entry
+func (collector *BatteryCollector) collectHealth(ctx context.Context, ch chan<- prometheus.Metric) {
+	out, err := collector.runner.Run(ctx, "ioreg", "-rn", "AppleSmartBattery")
+	if err != nil {
+		logCommandFailure("Failed to run command", "battery", commandLine("ioreg", "-rn", "AppleSmartBattery"), err, commandStderr(err))
+		return
+	}
+
+	health, ok := parseBatteryHealth(bytes.NewReader(out))
+	if !ok {
+		return
+	}
+	if health.designCapacity > 0 && health.maxCapacity > 0 {
+		ch <- prometheus.MustNewConstMetric(collector.health, prometheus.GaugeValue, health.maxCapacity/health.designCapacity*100)
+	}
+	ch <- prometheus.MustNewConstMetric(collector.condition, prometheus.GaugeValue, 1, health.condition)
+}
+
+// batteryStatus holds the battery line of `pmset -g batt`
+type batteryStatus struct {
+	charge    float64  // percent
+	state     string   // e.g. discharging, charging, charged, AC attached
+	remaining *float64 // minutes, nil without an estimate
+}
+
+// batteryPattern matches the battery line of `pmset -g batt`, e.g.
+//
+//	-InternalBattery-0 (id=4653155)	85%; discharging; 4:12 remaining present: true
+var batteryPattern = regexp.MustCompile(`^\s*-InternalBattery-\d+.*?\s(\d+)%;\s*([^;]+);\s*(.*)$`)
+
+// remainingPattern matches the H:MM time estimate, e.g. "4:12 remaining"
+var remainingPattern = regexp.MustCompile(`^(\d+):(\d{2}) remaining`)
+
+// parseBattery parses `pmset -g batt` output, returning false when it lists
+// no internal battery
+func parseBattery(r io.Reader) (batteryStatus, bool) {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		match := batteryPattern.FindStringSubmatch(scanner.Text())
+		if match == nil {
+			continue
+		}
+		charge, err := strconv.ParseFloat(match[1], 64)
+		if err != nil {
+			return batteryStatus{}, false
+		}
+		status := batteryStatus{charge: charge, state: match[2]}
+		if remaining := remainingPattern.FindStringSubmatch(match[3]); remaining != nil {
+			hours, _ := strconv.Atoi(remaining[1])
+			minutes, _ := strconv.Atoi(remaining[2])
+			total := float64(hours*60 + minutes)
+			status.remaining = &total
+		}
+		return status, true
+	}
+	return batteryStatus{}, false
+}
+
+// batteryHealth holds the AppleSmartBattery properties used for health
+type batteryHealth struct {
+	maxCapacity    float64 // mAh
+	designCapacity float64 // mAh
+	condition      string
+}
+
+// ioregPropertyPattern matches a top-level property line of ioreg, e.g.
+//
+//	"DesignCapacity" = 4563
+var ioregPropertyPattern = regexp.MustCompile(`^\s*"(\w+)" = (.*)$`)
+
+// parseBatteryHealth parses `ioreg -rn AppleSmartBattery` output, returning
+// false when it lists no battery. Apple silicon reports MaxCapacity as a
+// percentage and the capacity in mAh as AppleRawMaxCapacity, while Intel
+// Macs report MaxCapacity in mAh. Likewise the condition is
+// BatteryHealthCondition on current macOS and BatteryHealth before; a
+// battery reporting neither is healthy.
+func parseBatteryHealth(r io.Reader) (batteryHealth, bool) {
+	properties := make(map[string]string)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		if match := ioregPropertyPattern.FindStringSubmatch(scanner.Text()); match != nil {
+			properties[match[1]] = strings.Trim(match[2], `"`)
+		}
+	}
+	if len(properties) == 0 {
+		return batteryHealth{}, false
+	}
+
+	health := batteryHealth{condition: "Normal"}
+	health.designCapacity, _ = strconv.ParseFloat(properties["DesignCapacity"], 64)
+	maxCapacity, ok := properties["AppleRawMaxCapacity"]
+	if !ok {
+		maxCapacity = properties["MaxCapacity"]
+	}
+	health.maxCapacity, _ = strconv.ParseFloat(maxCapacity, 64)
+	for _, key := range []string{"BatteryHealthCondition", "BatteryHealth"} {
+		if condition := properties[key]; condition != "" {
+			health.condition = condition
+			break
+		}
+	}
+	return health, true
+}
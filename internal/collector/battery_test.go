@@ -0,0 +1,128 @@
+package collector
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"mac-powermetrics-exporter/internal/config"
+)
+
+func TestParseBattery(t *testing.T) {
+	f, err := os.Open("testdata/pmset_batt.txt")
+	if err != nil {
+		t.Fatalf("Failed to open fixture: %v", err)
+	}
+	defer f.Close()
+
+	battery, ok := parseBattery(f)
+	if !ok || battery.charge != 85 || battery.state != "discharging" || battery.remaining == nil || *battery.remaining != 252 {
+		t.Errorf("Expected 85%% discharging with 252 minutes left, got %+v (ok=%v)", battery, ok)
+	}
+
+	// Desktop Macs list no battery
+	if battery, ok := parseBattery(strings.NewReader("Now drawing from 'AC Power'\n")); ok {
+		t.Errorf("Expected no battery, got %+v", battery)
+	}
+}
+
+func TestBatteryCollector(t *testing.T) {
+	tests := []struct {
+		name     string
+		line     string
+		expected map[string]float64
+	}{
+		{
+			name: "discharging",
+			line: "85%; discharging; 4:12 remaining present: true",
+			expected: map[string]float64{
+				"battery_charge_percent":        85,
+				"battery_time_to_empty_minutes": 252,
+			},
+		},
+		{
+			name: "charging",
+			line: "42%; charging; 1:05 remaining present: true",
+			expected: map[string]float64{
+				"battery_charge_percent":       42,
+				"battery_time_to_full_minutes": 65,
+			},
+		},
+		{
+			name:     "no estimate",
+			line:     "85%; discharging; (no estimate) present: true",
+			expected: map[string]float64{"battery_charge_percent": 85},
+		},
+		{
+			name:     "not charging",
+			line:     "80%; AC attached; not charging present: true",
+			expected: map[string]float64{"battery_charge_percent": 80},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := "Now drawing from 'Battery Power'\n -InternalBattery-0 (id=4653155)\t" + tt.line + "\n"
+			collector := NewBatteryCollector(config.New())
+			collector.runner = fakeRunner{"pmset -g batt": {stdout: out}}
+
+			values := gatherValues(t, collector)
+			if len(values) != len(tt.expected) {
+				t.Errorf("Expected %d metrics, got %v", len(tt.expected), values)
+			}
+			for key, want := range tt.expected {
+				if got, ok := values[key]; !ok || got != want {
+					t.Errorf("%s: expected %v, got %v (present=%v)", key, want, got, ok)
+				}
+			}
+		})
+	}
+}
+
+func TestParseBatteryHealth(t *testing.T) {
+	f, err := os.Open("testdata/ioreg_battery.txt")
+	if err != nil {
+		t.Fatalf("Failed to open fixture: %v", err)
+	}
+	defer f.Close()
+
+	// Apple silicon: MaxCapacity is a percentage, AppleRawMaxCapacity is mAh
+	health, ok := parseBatteryHealth(f)
+	if !ok || health.maxCapacity != 4102 || health.designCapacity != 4382 || health.condition != "Normal" {
+		t.Errorf("Expected 4102/4382 mAh in Normal condition, got %+v (ok=%v)", health, ok)
+	}
+
+	// Intel: MaxCapacity is mAh and the condition is BatteryHealth
+	legacy := `    {
+      "MaxCapacity" = 5100
+      "DesignCapacity" = 6900
+      "BatteryHealth" = "Service Battery"
+    }
+`
+	health, ok = parseBatteryHealth(strings.NewReader(legacy))
+	if !ok || health.maxCapacity != 5100 || health.designCapacity != 6900 || health.condition != "Service Battery" {
+		t.Errorf("Expected 5100/6900 mAh in Service Battery condition, got %+v (ok=%v)", health, ok)
+	}
+
+	// Desktop Macs list no battery
+	if health, ok := parseBatteryHealth(strings.NewReader("")); ok {
+		t.Errorf("Expected no battery, got %+v", health)
+	}
+}
+
+func TestBatteryCollectorHealth(t *testing.T) {
+	ioreg, err := os.ReadFile("testdata/ioreg_battery.txt")
+	if err != nil {
+		t.Fatalf("Failed to read fixture: %v", err)
+	}
+	collector := NewBatteryCollector(config.New())
+	collector.runner = fakeRunner{"ioreg -rn AppleSmartBattery": {stdout: string(ioreg)}}
+
+	values := gatherValues(t, collector)
+	if got := values["battery_health_percent"]; got < 93.6 || got > 93.7 {
+		t.Errorf("Expected battery_health_percent of about 93.6, got %v", got)
+	}
+	if got, ok := values[`battery_condition_info{condition="Normal"}`]; !ok || got != 1 {
+		t.Errorf("Expected Normal battery condition, got %v", values)
+	}
+}
@@ -0,0 +1,144 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"strings"
+
+	"mac-powermetrics-exporter/internal/config"
+	"mac-powermetrics-exporter/internal/logging"
+)
+
+// scrapeContext returns the context for the commands run by one Collect call.
+//
+// prometheus.Collector.Collect receives no context, so a scrape canceled by
+// the client (e.g. on Prometheus' scrape timeout) cannot reach the processes
+// it spawned. Instead each Collect bounds its commands by cfg.ScrapeTimeout:
+// they are started with exec.CommandContext and killed once it elapses, so an
+// abandoned scrape never leaves powermetrics or vm_stat running behind it.
+// Background streaming uses the server's run context instead.
+func scrapeContext(cfg *config.Config) (context.Context, context.CancelFunc) {
+	if cfg.ScrapeTimeout <= 0 {
+		return context.WithCancel(context.Background())
+	}
+	return context.WithTimeout(context.Background(), cfg.ScrapeTimeout)
+}
+
+// commandErrorType classifies why a command failed. The values are exported
+// by powermetrics_exporter_last_error_type, so they must not be renumbered.
+type commandErrorType int
+
+const (
+	commandErrorNone       commandErrorType = iota // the command succeeded
+	commandErrorNotFound                           // the binary is not in PATH
+	commandErrorPermission                         // the command needs root
+	commandErrorTimeout                            // killed by the scrape timeout
+	commandErrorExit                               // any other failure
+)
+
+// classifyCommandError returns why a command run with ctx failed, given its
+// error and stderr
+func classifyCommandError(ctx context.Context, err error, stderr string) commandErrorType {
+	var exitErr *exec.ExitError
+	switch {
+	case err == nil:
+		return commandErrorNone
+	case errors.Is(err, exec.ErrNotFound), errors.Is(err, os.ErrNotExist):
+		return commandErrorNotFound
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		return commandErrorTimeout
+	case errors.Is(err, os.ErrPermission), isPermissionError(stderr):
+		return commandErrorPermission
+	case errors.As(err, &exitErr) && exitErr.ExitCode() == 126:
+		// The shell convention for a command that cannot be executed
+		return commandErrorPermission
+	}
+	return commandErrorExit
+}
+
+// logCommandError logs a failed command with a message for its errType
+func logCommandError(collector, command string, errType commandErrorType, err error, stderr string) {
+	message := "Failed to run command"
+	switch errType {
+	case commandErrorNone:
+		return
+	case commandErrorNotFound:
+		message = "Command not found"
+	case commandErrorPermission:
+		message = "Command not permitted"
+	case commandErrorTimeout:
+		message = "Command killed by scrape timeout"
+	}
+	logCommandFailure(message, collector, command, err, stderr)
+}
+
+// logCommandFailure logs a failed command, rate-limited like every
+// collector failure so a binary that is missing or needs root doesn't flood
+// the log on every scrape
+func logCommandFailure(message, collector, command string, err error, stderr string) {
+	logging.Failure(message, "collector", collector, "command", command, "err", err, "stderr", stderr)
+}
+
+// commandRunner runs a command to completion and returns its stdout. When
+// the command fails, the returned error is an *exec.ExitError holding its
+// stderr. Collectors run their one-shot commands through a commandRunner so
+// tests can replace the real binaries with canned output; background
+// processes are streamed from a pipe and started with os/exec directly.
+type commandRunner interface {
+	Run(ctx context.Context, name string, args ...string) ([]byte, error)
+}
+
+// execRunner is the commandRunner running commands with os/exec. They are
+// killed when ctx is done.
+type execRunner struct{}
+
+// Run runs the command and returns its stdout, which is kept even when the
+// command exits with an error
+func (execRunner) Run(ctx context.Context, name string, args ...string) ([]byte, error) {
+	return exec.CommandContext(ctx, name, args...).Output()
+}
+
+// commandLine formats a command for logging
+func commandLine(name string, args ...string) string {
+	return strings.Join(append([]string{name}, args...), " ")
+}
+
+// commandStderr returns the trimmed stderr a failed command left in its error
+func commandStderr(err error) string {
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return strings.TrimSpace(string(exitErr.Stderr))
+	}
+	return ""
+}
+
+// streamStderrLimit bounds how much stderr is kept from a long-running
+// powermetrics or macmon process. Only the end is needed to log why it exited.
+const streamStderrLimit = 4 << 10
+
+// tailBuffer is an io.Writer keeping only the last max bytes written to it
+type tailBuffer struct {
+	max int
+	buf []byte
+}
+
+// Write appends p, dropping the oldest bytes beyond max. It never fails.
+func (b *tailBuffer) Write(p []byte) (int, error) {
+	n := len(p)
+	if len(p) >= b.max {
+		b.buf = append(b.buf[:0], p[len(p)-b.max:]...)
+		return n, nil
+	}
+	b.buf = append(b.buf, p...)
+	if len(b.buf) > b.max {
+		b.buf = append(b.buf[:0], b.buf[len(b.buf)-b.max:]...)
+	}
+	return n, nil
+}
+
+// String returns the kept bytes
+func (b *tailBuffer) String() string {
+	return string(b.buf)
+}
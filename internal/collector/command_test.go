@@ -0,0 +1,124 @@
+package collector
+
+import (
+	"bytes"
+	"errors"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"mac-powermetrics-exporter/internal/config"
+)
+
+func TestScrapeContextKillsCommand(t *testing.T) {
+	if _, err := exec.LookPath("sleep"); err != nil {
+		t.Skip("sleep not available")
+	}
+	cfg := config.New()
+	cfg.ScrapeTimeout = 100 * time.Millisecond
+
+	ctx, cancel := scrapeContext(cfg)
+	defer cancel()
+
+	start := time.Now()
+	if err := exec.CommandContext(ctx, "sleep", "5").Run(); err == nil {
+		t.Error("Expected the command to be killed")
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("Command ran for %v, expected it to be killed after the scrape timeout", elapsed)
+	}
+}
+
+func TestScrapeContextWithoutTimeout(t *testing.T) {
+	cfg := config.New()
+	cfg.ScrapeTimeout = 0
+
+	ctx, cancel := scrapeContext(cfg)
+	defer cancel()
+	if _, ok := ctx.Deadline(); ok {
+		t.Error("Expected no deadline when the scrape timeout is disabled")
+	}
+}
+
+func TestClassifyCommandError(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh not available")
+	}
+	notExecutable := filepath.Join(t.TempDir(), "powermetrics")
+	if err := os.WriteFile(notExecutable, []byte("#!/bin/sh\n"), 0o644); err != nil {
+		t.Fatalf("Failed to write script: %v", err)
+	}
+
+	cases := []struct {
+		name    string
+		args    []string
+		stderr  string
+		timeout time.Duration
+		want    commandErrorType
+	}{
+		{name: "success", args: []string{"sh", "-c", "exit 0"}, want: commandErrorNone},
+		{name: "not found", args: []string{"powermetrics-does-not-exist"}, want: commandErrorNotFound},
+		{name: "not executable", args: []string{notExecutable}, want: commandErrorPermission},
+		{name: "superuser", args: []string{"sh", "-c", "exit 1"}, stderr: "powermetrics must be invoked as the superuser", want: commandErrorPermission},
+		{name: "exit code 126", args: []string{"sh", "-c", "exit 126"}, want: commandErrorPermission},
+		{name: "timeout", args: []string{"sh", "-c", "sleep 5"}, timeout: 50 * time.Millisecond, want: commandErrorTimeout},
+		{name: "exit", args: []string{"sh", "-c", "exit 3"}, want: commandErrorExit},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := config.New()
+			cfg.ScrapeTimeout = tc.timeout
+			ctx, cancel := scrapeContext(cfg)
+			defer cancel()
+
+			err := exec.CommandContext(ctx, tc.args[0], tc.args[1:]...).Run()
+			if got := classifyCommandError(ctx, err, tc.stderr); got != tc.want {
+				t.Errorf("Expected error type %d, got %d (err: %v)", tc.want, got, err)
+			}
+		})
+	}
+}
+
+func TestLogCommandFailureRateLimit(t *testing.T) {
+	var buf bytes.Buffer
+	defer slog.SetDefault(slog.Default())
+	slog.SetDefault(slog.New(slog.NewTextHandler(&buf, nil)))
+
+	for range 3 {
+		logCommandFailure("Failed to run command", "test", "rate-limited -n 1", errors.New("exit status 1"), "")
+	}
+	if got := strings.Count(buf.String(), "rate-limited -n 1"); got != 1 {
+		t.Errorf("Expected a repeated failure to be logged once, got %d times:\n%s", got, buf.String())
+	}
+	if !strings.Contains(buf.String(), "level=WARN") {
+		t.Errorf("Expected the failure at warn level, got %q", buf.String())
+	}
+
+	// A different command is logged independently
+	logCommandFailure("Failed to run command", "test", "rate-limited -n 2", errors.New("exit status 1"), "")
+	if !strings.Contains(buf.String(), "rate-limited -n 2") {
+		t.Error("Expected a different command to be logged")
+	}
+}
+
+func TestTailBuffer(t *testing.T) {
+	b := &tailBuffer{max: 8}
+	for _, chunk := range []string{"powermetrics", ": ", "killed\n"} {
+		if n, err := b.Write([]byte(chunk)); n != len(chunk) || err != nil {
+			t.Fatalf("Write(%q) = %d, %v", chunk, n, err)
+		}
+	}
+	if got := b.String(); got != " killed\n" {
+		t.Errorf("Expected the last 8 bytes, got %q", got)
+	}
+
+	// A single write larger than the limit keeps its end
+	b.Write([]byte(strings.Repeat("x", 100) + "the end"))
+	if got := b.String(); got != "xthe end" {
+		t.Errorf("Expected the end of a large write, got %q", got)
+	}
+}
@@ -0,0 +1,93 @@
+package collector
+
+import (
+	"context"
+	"log/slog"
+	"strconv"
+	"strings"
+
+	"mac-powermetrics-exporter/internal/config"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// cpuCoreSysctls maps each core count metric to the sysctl it is read from.
+// Apple Silicon lists performance cores as perflevel0 and efficiency cores as
+// perflevel1; Intel Macs have neither.
+var cpuCoreSysctls = []struct {
+	name   string
+	help   string
+	sysctl string
+}{
+	{"cpu_performance_cores", "Number of physical performance (P) cores.", "hw.perflevel0.physicalcpu"},
+	{"cpu_efficiency_cores", "Number of physical efficiency (E) cores.", "hw.perflevel1.physicalcpu"},
+	{"cpu_logical_cores", "Number of logical CPU cores.", "hw.logicalcpu"},
+}
+
+// CPUCoresCollector reports the CPU core counts read once at startup
+type CPUCoresCollector struct {
+	metrics []prometheus.Metric
+}
+
+func init() {
+	Register("cores", "sysctl", func(cfg *config.Config) prometheus.Collector { return NewCPUCoresCollector(cfg) })
+}
+
+// NewCPUCoresCollector creates a new CPUCoresCollector. The core counts don't
+// change while the exporter runs, so they are read here and every scrape
+// returns the same values. Counts the machine doesn't report are left out.
+func NewCPUCoresCollector(cfg *config.Config) *CPUCoresCollector {
+	return newCPUCoresCollector(cfg, execRunner{})
+}
+
+// newCPUCoresCollector creates a CPUCoresCollector reading the core counts
+// through runner
+func newCPUCoresCollector(cfg *config.Config, runner commandRunner) *CPUCoresCollector {
+	collector := &CPUCoresCollector{}
+
+	ctx, cancel := scrapeContext(cfg)
+	defer cancel()
+	for _, core := range cpuCoreSysctls {
+		count, ok := readSysctlInt(ctx, runner, "cores", core.sysctl)
+		if !ok {
+			continue
+		}
+		desc := prometheus.NewDesc(
+			prometheus.BuildFQName(cfg.Namespace, "system", core.name),
+			core.help,
+			nil,
+			cfg.ConstLabels,
+		)
+		collector.metrics = append(collector.metrics, prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, count))
+	}
+	return collector
+}
+
+// Describe describes metrics to Prometheus
+func (collector *CPUCoresCollector) Describe(ch chan<- *prometheus.Desc) {
+	for _, m := range collector.metrics {
+		ch <- m.Desc()
+	}
+}
+
+// Collect is called by Prometheus when collecting metrics
+func (collector *CPUCoresCollector) Collect(ch chan<- prometheus.Metric) {
+	for _, m := range collector.metrics {
+		ch <- m
+	}
+}
+
+// readSysctlInt reads an integer sysctl for the named collector, returning
+// false if it doesn't exist
+func readSysctlInt(ctx context.Context, runner commandRunner, collector, name string) (float64, bool) {
+	out, err := runner.Run(ctx, "sysctl", "-n", name)
+	if err != nil {
+		slog.Debug("Failed to run command", "collector", collector, "command", commandLine("sysctl", "-n", name), "err", err, "stderr", commandStderr(err))
+		return 0, false
+	}
+	value, err := strconv.ParseFloat(strings.TrimSpace(string(out)), 64)
+	if err != nil {
+		return 0, false
+	}
+	return value, true
+}
@@ -0,0 +1,70 @@
+package collector
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"mac-powermetrics-exporter/internal/config"
+)
+
+// fakeSysctl puts a sysctl on PATH that prints values for the given keys and
+// fails for any other key
+func fakeSysctl(t *testing.T, values map[string]string) {
+	t.Helper()
+	script := "#!/bin/sh\ncase \"$2\" in\n"
+	for key, value := range values {
+		script += key + ") echo " + value + " ;;\n"
+	}
+	script += "*) echo \"sysctl: unknown oid '$2'\" >&2; exit 1 ;;\nesac\n"
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "sysctl"), []byte(script), 0o755); err != nil {
+		t.Fatalf("Failed to write fake sysctl: %v", err)
+	}
+	t.Setenv("PATH", dir)
+}
+
+func TestCPUCoresCollector(t *testing.T) {
+	tests := []struct {
+		name     string
+		sysctls  map[string]string
+		expected map[string]float64
+	}{
+		{
+			name: "apple silicon",
+			sysctls: map[string]string{
+				"hw.perflevel0.physicalcpu": "8",
+				"hw.perflevel1.physicalcpu": "4",
+				"hw.logicalcpu":             "12",
+			},
+			expected: map[string]float64{
+				"system_cpu_performance_cores": 8,
+				"system_cpu_efficiency_cores":  4,
+				"system_cpu_logical_cores":     12,
+			},
+		},
+		{
+			// Intel Macs have no performance levels
+			name:     "intel",
+			sysctls:  map[string]string{"hw.logicalcpu": "16"},
+			expected: map[string]float64{"system_cpu_logical_cores": 16},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fakeSysctl(t, tt.sysctls)
+			values := gatherValues(t, NewCPUCoresCollector(config.New()))
+
+			if len(values) != len(tt.expected) {
+				t.Errorf("Expected %d metrics, got %v", len(tt.expected), values)
+			}
+			for key, want := range tt.expected {
+				if got, ok := values[key]; !ok || got != want {
+					t.Errorf("%s: expected %v, got %v (present=%v)", key, want, got, ok)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,44 @@
+//go:build darwin && cgo
+
+package collector
+
+/*
+#include <mach/mach.h>
+#include <mach/processor_info.h>
+*/
+import "C"
+
+import (
+	"fmt"
+	"unsafe"
+)
+
+// readCPUTicks reads the cumulative per-CPU ticks via host_processor_info
+func readCPUTicks() ([]cpuTicks, error) {
+	var cpuCount C.natural_t
+	var info C.processor_info_array_t
+	var infoCount C.mach_msg_type_number_t
+
+	ret := C.host_processor_info(C.mach_host_self(), C.PROCESSOR_CPU_LOAD_INFO, &cpuCount, &info, &infoCount)
+	if ret != C.KERN_SUCCESS {
+		return nil, fmt.Errorf("host_processor_info failed with kern_return_t %d", int(ret))
+	}
+	defer C.vm_deallocate(
+		C.mach_task_self_,
+		C.vm_address_t(uintptr(unsafe.Pointer(info))),
+		C.vm_size_t(uintptr(infoCount)*unsafe.Sizeof(C.integer_t(0))),
+	)
+
+	loads := unsafe.Slice((*C.integer_t)(unsafe.Pointer(info)), int(infoCount))
+	ticks := make([]cpuTicks, int(cpuCount))
+	for i := range ticks {
+		base := i * C.CPU_STATE_MAX
+		ticks[i] = cpuTicks{
+			User:   uint32(loads[base+C.CPU_STATE_USER]),
+			System: uint32(loads[base+C.CPU_STATE_SYSTEM]),
+			Idle:   uint32(loads[base+C.CPU_STATE_IDLE]),
+			Nice:   uint32(loads[base+C.CPU_STATE_NICE]),
+		}
+	}
+	return ticks, nil
+}
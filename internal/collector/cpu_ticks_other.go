@@ -0,0 +1,10 @@
+//go:build !darwin || !cgo
+
+package collector
+
+import "errors"
+
+// readCPUTicks is only implemented on macOS builds with cgo enabled
+func readCPUTicks() ([]cpuTicks, error) {
+	return nil, errors.New("host_processor_info requires macOS and a cgo-enabled build")
+}
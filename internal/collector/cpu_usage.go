@@ -0,0 +1,160 @@
+package collector
+
+import (
+	"fmt"
+	"sync"
+
+	"mac-powermetrics-exporter/internal/config"
+	"mac-powermetrics-exporter/internal/logging"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// cpuTicks holds the cumulative scheduler ticks of one CPU per mode. The
+// kernel counts them in 32 bits, so they wrap around.
+type cpuTicks struct {
+	User   uint32
+	System uint32
+	Idle   uint32
+	Nice   uint32
+}
+
+// tickDelta holds the ticks of one CPU per mode between two readings
+type tickDelta struct {
+	User   float64
+	System float64
+	Idle   float64
+	Nice   float64
+}
+
+// maxTickDelta bounds the ticks a mode can plausibly advance between two
+// scrapes: at 100 ticks per second, half the counter range takes almost a
+// year. A larger delta means the counter went backwards, e.g. after a reset,
+// rather than wrapped around.
+const maxTickDelta = 1 << 31
+
+// since returns the ticks elapsed from previous to ticks. Unsigned
+// subtraction handles a counter that wrapped around; it reports false when a
+// delta is implausibly large.
+func (ticks cpuTicks) since(previous cpuTicks) (tickDelta, bool) {
+	deltas := [...]uint32{
+		ticks.User - previous.User,
+		ticks.System - previous.System,
+		ticks.Idle - previous.Idle,
+		ticks.Nice - previous.Nice,
+	}
+	for _, delta := range deltas {
+		if delta > maxTickDelta {
+			return tickDelta{}, false
+		}
+	}
+	return tickDelta{
+		User:   float64(deltas[0]),
+		System: float64(deltas[1]),
+		Idle:   float64(deltas[2]),
+		Nice:   float64(deltas[3]),
+	}, true
+}
+
+// CPUUsageCollector computes CPU usage from host_processor_info tick counts.
+// Unlike powermetrics it needs no root privileges.
+type CPUUsageCollector struct {
+	// previous holds the ticks read by the last scrape
+	mu       sync.Mutex
+	previous []cpuTicks
+
+	usage *prometheus.Desc
+}
+
+func init() {
+	Register("cpu", "", func(cfg *config.Config) prometheus.Collector { return NewCPUUsageCollector(cfg) })
+}
+
+// NewCPUUsageCollector creates a new CPUUsageCollector
+func NewCPUUsageCollector(cfg *config.Config) *CPUUsageCollector {
+	return &CPUUsageCollector{
+		usage: prometheus.NewDesc(
+			prometheus.BuildFQName(cfg.Namespace, "mac", "cpu_usage_percent"),
+			"CPU usage percentage per mode since the previous scrape.",
+			[]string{"core", "mode"}, // core is "all" for the aggregate
+			cfg.ConstLabels,
+		),
+	}
+}
+
+// Describe describes metrics to Prometheus
+func (collector *CPUUsageCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- collector.usage
+}
+
+// Collect is called by Prometheus when collecting metrics
+func (collector *CPUUsageCollector) Collect(ch chan<- prometheus.Metric) {
+	current, err := readCPUTicks()
+	if err != nil {
+		logging.Failuref("Failed to read CPU ticks: %v", err)
+		return
+	}
+
+	collector.mu.Lock()
+	previous := collector.previous
+	collector.previous = current
+	collector.mu.Unlock()
+
+	// The first scrape only records a baseline
+	if previous == nil {
+		return
+	}
+
+	for core, modes := range cpuUsagePercent(previous, current) {
+		for mode, percent := range modes {
+			ch <- prometheus.MustNewConstMetric(collector.usage, prometheus.GaugeValue, percent, core, mode)
+		}
+	}
+}
+
+// cpuUsagePercent computes the share of ticks spent in each mode between two
+// readings, per core (cpu0, cpu1, ...) and aggregated over all cores ("all").
+// It returns nil when the readings cover a different number of CPUs. Cores
+// with implausible deltas are left out, of the aggregate too.
+func cpuUsagePercent(previous, current []cpuTicks) map[string]map[string]float64 {
+	if len(previous) != len(current) {
+		return nil
+	}
+
+	usage := make(map[string]map[string]float64)
+	var total tickDelta
+	for i := range current {
+		delta, ok := current[i].since(previous[i])
+		if !ok {
+			logging.Failuref("Skipping cpu%d: implausible tick delta from %+v to %+v", i, previous[i], current[i])
+			continue
+		}
+		total.User += delta.User
+		total.System += delta.System
+		total.Idle += delta.Idle
+		total.Nice += delta.Nice
+
+		if percent := tickPercentages(delta); percent != nil {
+			usage[fmt.Sprintf("cpu%d", i)] = percent
+		}
+	}
+	if percent := tickPercentages(total); percent != nil {
+		usage["all"] = percent
+	}
+	return usage
+}
+
+// tickPercentages converts tick deltas into percentages per mode, returning
+// nil when no ticks elapsed
+func tickPercentages(delta tickDelta) map[string]float64 {
+	sum := delta.User + delta.System + delta.Idle + delta.Nice
+	if sum <= 0 {
+		return nil
+	}
+	return map[string]float64{
+		"user":   delta.User / sum * 100,
+		"system": delta.System / sum * 100,
+		"idle":   delta.Idle / sum * 100,
+		"nice":   delta.Nice / sum * 100,
+	}
+}
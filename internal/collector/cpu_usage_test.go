@@ -0,0 +1,72 @@
+package collector
+
+import (
+	"math"
+	"testing"
+)
+
+func TestCPUUsagePercent(t *testing.T) {
+	previous := []cpuTicks{
+		{User: 1000, System: 500, Idle: 8000, Nice: 0},
+		{User: 2000, System: 1000, Idle: 6000, Nice: 100},
+	}
+	current := []cpuTicks{
+		// 100 ticks: 50 user, 25 system, 25 idle
+		{User: 1050, System: 525, Idle: 8025, Nice: 0},
+		// 300 ticks: 30 user, 0 system, 240 idle, 30 nice
+		{User: 2030, System: 1000, Idle: 6240, Nice: 130},
+	}
+
+	usage := cpuUsagePercent(previous, current)
+
+	expected := map[string]map[string]float64{
+		"cpu0": {"user": 50, "system": 25, "idle": 25, "nice": 0},
+		"cpu1": {"user": 10, "system": 0, "idle": 80, "nice": 10},
+		// 400 ticks: 80 user, 25 system, 265 idle, 30 nice
+		"all": {"user": 20, "system": 6.25, "idle": 66.25, "nice": 7.5},
+	}
+	for core, modes := range expected {
+		for mode, want := range modes {
+			if got := usage[core][mode]; got != want {
+				t.Errorf("%s %s: expected %v, got %v", core, mode, want, got)
+			}
+		}
+	}
+}
+
+func TestCPUUsagePercentSkipsIdleIntervals(t *testing.T) {
+	ticks := []cpuTicks{{User: 10, System: 10, Idle: 10}}
+	if usage := cpuUsagePercent(ticks, ticks); len(usage) != 0 {
+		t.Errorf("Expected no usage without elapsed ticks, got %v", usage)
+	}
+	if usage := cpuUsagePercent(ticks, append(ticks, ticks...)); usage != nil {
+		t.Errorf("Expected nil usage when the CPU count changes, got %v", usage)
+	}
+}
+
+func TestCPUUsagePercentWraparound(t *testing.T) {
+	// 100 ticks across the wrap: 60 user, 40 idle
+	previous := []cpuTicks{{User: math.MaxUint32 - 9, System: 500, Idle: math.MaxUint32 - 19}}
+	current := []cpuTicks{{User: 50, System: 500, Idle: 20}}
+
+	usage := cpuUsagePercent(previous, current)
+	for mode, want := range map[string]float64{"user": 60, "system": 0, "idle": 40} {
+		if got := usage["cpu0"][mode]; got != want {
+			t.Errorf("cpu0 %s: expected %v, got %v", mode, want, got)
+		}
+	}
+}
+
+func TestCPUUsagePercentSkipsImplausibleDeltas(t *testing.T) {
+	// cpu1's counters went backwards, as after a reset
+	previous := []cpuTicks{{User: 100, Idle: 100}, {User: 5000, Idle: 5000}}
+	current := []cpuTicks{{User: 150, Idle: 150}, {User: 10, Idle: 10}}
+
+	usage := cpuUsagePercent(previous, current)
+	if _, ok := usage["cpu1"]; ok {
+		t.Errorf("Expected cpu1 to be skipped, got %v", usage["cpu1"])
+	}
+	if got := usage["all"]["user"]; got != 50 {
+		t.Errorf("Expected the aggregate to cover only cpu0, got %v", usage["all"])
+	}
+}
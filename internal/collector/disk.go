@@ -0,0 +1,90 @@
+package collector
+
+import (
+	"encoding/json"
+
+	"mac-powermetrics-exporter/internal/config"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// DiskCollector collects the temperature of the internal SSD from smartctl
+// (smartmontools), which is not installed on macOS by default
+type DiskCollector struct {
+	config *config.Config
+	runner commandRunner
+
+	temperature           *prometheus.Desc
+	temperatureFahrenheit *prometheus.Desc
+}
+
+func init() {
+	Register("disk", "smartctl", func(cfg *config.Config) prometheus.Collector { return NewDiskCollector(cfg) })
+}
+
+// NewDiskCollector creates a new DiskCollector
+func NewDiskCollector(cfg *config.Config) *DiskCollector {
+	return &DiskCollector{
+		config: cfg,
+		runner: execRunner{},
+		temperature: prometheus.NewDesc(
+			prometheus.BuildFQName(cfg.Namespace, "disk", "temperature_celsius"),
+			"Disk temperature in Celsius as reported by SMART.",
+			[]string{"device"},
+			cfg.ConstLabels,
+		),
+		temperatureFahrenheit: fahrenheitDesc(cfg, "disk", "temperature", "Disk temperature in Fahrenheit as reported by SMART.", []string{"device"}),
+	}
+}
+
+// Describe describes metrics to Prometheus
+func (collector *DiskCollector) Describe(ch chan<- *prometheus.Desc) {
+	describeTemperature(ch, collector.temperature, collector.temperatureFahrenheit)
+}
+
+// Collect is called by Prometheus when collecting metrics
+func (collector *DiskCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := scrapeContext(collector.config)
+	defer cancel()
+
+	for _, device := range collector.config.DiskDevices {
+		// smartctl sets exit status bits for SMART warnings while still
+		// printing the attributes, so the output is parsed regardless
+		args := []string{"--json", "-A", "/dev/" + device}
+		out, err := collector.runner.Run(ctx, "smartctl", args...)
+
+		temperature, ok := parseSmartctlTemperature(out)
+		if !ok {
+			logCommandFailure("Failed to run command", "disk", commandLine("smartctl", args...), err, commandStderr(err))
+			continue
+		}
+		emitTemperature(ch, collector.temperature, collector.temperatureFahrenheit, temperature, device)
+	}
+}
+
+// smartctlOutput is the part of `smartctl --json -A` output holding the
+// temperature. NVMe drives report it in the health log as well.
+type smartctlOutput struct {
+	Temperature *struct {
+		Current *float64 `json:"current"`
+	} `json:"temperature"`
+	NVMeHealth *struct {
+		Temperature *float64 `json:"temperature"`
+	} `json:"nvme_smart_health_information_log"`
+}
+
+// parseSmartctlTemperature returns the current temperature from smartctl JSON
+// output, or false when the output has none
+func parseSmartctlTemperature(out []byte) (float64, bool) {
+	var data smartctlOutput
+	if err := json.Unmarshal(out, &data); err != nil {
+		return 0, false
+	}
+	if data.Temperature != nil && data.Temperature.Current != nil {
+		return *data.Temperature.Current, true
+	}
+	if data.NVMeHealth != nil && data.NVMeHealth.Temperature != nil {
+		return *data.NVMeHealth.Temperature, true
+	}
+	return 0, false
+}
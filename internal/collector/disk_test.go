@@ -0,0 +1,71 @@
+package collector
+
+import (
+	"math"
+	"testing"
+
+	"mac-powermetrics-exporter/internal/config"
+)
+
+func TestParseSmartctlTemperature(t *testing.T) {
+	tests := []struct {
+		name string
+		out  string
+		want float64
+		ok   bool
+	}{
+		{
+			name: "apple ssd",
+			out:  `{"device":{"name":"/dev/disk0","protocol":"NVMe"},"nvme_smart_health_information_log":{"temperature":36,"available_spare":100},"temperature":{"current":36}}`,
+			want: 36,
+			ok:   true,
+		},
+		{
+			name: "health log only",
+			out:  `{"nvme_smart_health_information_log":{"temperature":41}}`,
+			want: 41,
+			ok:   true,
+		},
+		{
+			name: "no temperature",
+			out:  `{"smartctl":{"exit_status":2,"messages":[{"string":"Smartctl open device: /dev/disk9 failed: No such device","severity":"error"}]}}`,
+		},
+		{name: "not json", out: "smartctl: command failed"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := parseSmartctlTemperature([]byte(tt.out))
+			if ok != tt.ok || got != tt.want {
+				t.Errorf("Expected %v (%v), got %v (%v)", tt.want, tt.ok, got, ok)
+			}
+		})
+	}
+}
+
+func TestDiskCollectorFahrenheit(t *testing.T) {
+	runner := fakeRunner{"smartctl --json -A /dev/disk0": {stdout: `{"temperature":{"current":36}}`}}
+	cfg := config.New()
+	cfg.DiskDevices = []string{"disk0"}
+
+	collector := NewDiskCollector(cfg)
+	collector.runner = runner
+	values := gatherValues(t, collector)
+	if got := values[`disk_temperature_celsius{device="disk0"}`]; got != 36 {
+		t.Errorf("Expected 36 °C, got %v", got)
+	}
+	if _, ok := values[`disk_temperature_fahrenheit{device="disk0"}`]; ok {
+		t.Error("Expected no Fahrenheit metric by default")
+	}
+
+	cfg.TemperatureFahrenheit = true
+	collector = NewDiskCollector(cfg)
+	collector.runner = runner
+	values = gatherValues(t, collector)
+	if got := values[`disk_temperature_celsius{device="disk0"}`]; got != 36 {
+		t.Errorf("Expected 36 °C alongside Fahrenheit, got %v", got)
+	}
+	if got := values[`disk_temperature_fahrenheit{device="disk0"}`]; math.Abs(got-96.8) > 1e-9 {
+		t.Errorf("Expected 96.8 °F, got %v", got)
+	}
+}
@@ -0,0 +1,99 @@
+package collector
+
+import (
+	"fmt"
+
+	"mac-powermetrics-exporter/internal/config"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// FanCollector collects SMC fan speeds
+type FanCollector struct {
+	config *config.Config
+	runner commandRunner
+	smc    *SMCReader
+
+	speed  *prometheus.Desc
+	target *prometheus.Desc
+}
+
+func init() {
+	Register("fan", "smc", func(cfg *config.Config) prometheus.Collector { return NewFanCollector(cfg) })
+}
+
+// NewFanCollector creates a new FanCollector
+func NewFanCollector(cfg *config.Config) *FanCollector {
+	return &FanCollector{
+		config: cfg,
+		runner: execRunner{},
+		smc:    NewSMCReader(),
+		speed: prometheus.NewDesc(
+			prometheus.BuildFQName(cfg.Namespace, "smc", "fan_speed_rpm"),
+			"Current fan speed in RPM.",
+			[]string{"fan"},
+			cfg.ConstLabels,
+		),
+		target: prometheus.NewDesc(
+			prometheus.BuildFQName(cfg.Namespace, "smc", "fan_target_rpm"),
+			"Target fan speed in RPM requested by the fan-control loop.",
+			[]string{"fan"},
+			cfg.ConstLabels,
+		),
+	}
+}
+
+// SetSMCReader implements SMCConsumer
+func (collector *FanCollector) SetSMCReader(reader *SMCReader) {
+	collector.smc = reader
+}
+
+// Describe describes metrics to Prometheus
+func (collector *FanCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- collector.speed
+	ch <- collector.target
+}
+
+// Collect is called by Prometheus when collecting metrics
+func (collector *FanCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := scrapeContext(collector.config)
+	defer cancel()
+	keys, err := collector.smc.read(ctx, collector.runner)
+	if err != nil {
+		logCommandFailure("Failed to run command", "fan", smcCommand, err, "")
+		return
+	}
+
+	for _, fan := range parseFans(keys) {
+		if fan.speed != nil {
+			ch <- prometheus.MustNewConstMetric(collector.speed, prometheus.GaugeValue, *fan.speed, fan.index)
+		}
+		if fan.target != nil {
+			ch <- prometheus.MustNewConstMetric(collector.target, prometheus.GaugeValue, *fan.target, fan.index)
+		}
+	}
+}
+
+// fanReading is one fan's current and target speed
+type fanReading struct {
+	index  string
+	speed  *float64
+	target *float64
+}
+
+// parseFans reads the FNum fan count and each fan's F<n>Ac/F<n>Tg keys.
+// Fanless Macs report no FNum (or zero) and yield no readings.
+func parseFans(keys map[string]float64) []fanReading {
+	var fans []fanReading
+	for i := 0; i < int(keys["FNum"]); i++ {
+		fan := fanReading{index: fmt.Sprint(i)}
+		if speed, ok := keys[fmt.Sprintf("F%dAc", i)]; ok {
+			fan.speed = &speed
+		}
+		if target, ok := keys[fmt.Sprintf("F%dTg", i)]; ok {
+			fan.target = &target
+		}
+		fans = append(fans, fan)
+	}
+	return fans
+}
@@ -0,0 +1,105 @@
+package collector
+
+import (
+	"log/slog"
+	"regexp"
+
+	"mac-powermetrics-exporter/internal/config"
+	"mac-powermetrics-exporter/internal/logging"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// filesystemStats holds the sizes of one mounted filesystem in bytes
+type filesystemStats struct {
+	MountPoint string
+	FSType     string
+	Size       float64
+	Free       float64
+	Avail      float64 // free space available to unprivileged users
+}
+
+// FilesystemCollector collects the size and free space of mounted filesystems
+// via statfs
+type FilesystemCollector struct {
+	// exclude matches the mount points that are not reported
+	exclude *regexp.Regexp
+
+	size  *prometheus.Desc
+	free  *prometheus.Desc
+	avail *prometheus.Desc
+}
+
+func init() {
+	Register("filesystem", "", func(cfg *config.Config) prometheus.Collector { return NewFilesystemCollector(cfg) })
+}
+
+// NewFilesystemCollector creates a new FilesystemCollector
+func NewFilesystemCollector(cfg *config.Config) *FilesystemCollector {
+	collector := &FilesystemCollector{
+		size: prometheus.NewDesc(
+			prometheus.BuildFQName(cfg.Namespace, "mac", "filesystem_size_bytes"),
+			"Filesystem size in bytes.",
+			[]string{"mountpoint", "fstype"},
+			cfg.ConstLabels,
+		),
+		free: prometheus.NewDesc(
+			prometheus.BuildFQName(cfg.Namespace, "mac", "filesystem_free_bytes"),
+			"Filesystem free space in bytes.",
+			[]string{"mountpoint", "fstype"},
+			cfg.ConstLabels,
+		),
+		avail: prometheus.NewDesc(
+			prometheus.BuildFQName(cfg.Namespace, "mac", "filesystem_avail_bytes"),
+			"Filesystem space available to non-root users in bytes.",
+			[]string{"mountpoint", "fstype"},
+			cfg.ConstLabels,
+		),
+	}
+	if cfg.FilesystemMountPointsExclude != "" {
+		exclude, err := regexp.Compile(cfg.FilesystemMountPointsExclude)
+		if err != nil {
+			slog.Error("Invalid filesystem mount point exclude pattern, reporting every mount point", "pattern", cfg.FilesystemMountPointsExclude, "err", err)
+		} else {
+			collector.exclude = exclude
+		}
+	}
+	return collector
+}
+
+// Describe describes metrics to Prometheus
+func (collector *FilesystemCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- collector.size
+	ch <- collector.free
+	ch <- collector.avail
+}
+
+// Collect is called by Prometheus when collecting metrics
+func (collector *FilesystemCollector) Collect(ch chan<- prometheus.Metric) {
+	filesystems, err := readFilesystems()
+	if err != nil {
+		logging.Failuref("Failed to read mounted filesystems: %v", err)
+		return
+	}
+
+	for _, fs := range selectFilesystems(filesystems, collector.exclude) {
+		ch <- prometheus.MustNewConstMetric(collector.size, prometheus.GaugeValue, fs.Size, fs.MountPoint, fs.FSType)
+		ch <- prometheus.MustNewConstMetric(collector.free, prometheus.GaugeValue, fs.Free, fs.MountPoint, fs.FSType)
+		ch <- prometheus.MustNewConstMetric(collector.avail, prometheus.GaugeValue, fs.Avail, fs.MountPoint, fs.FSType)
+	}
+}
+
+// selectFilesystems drops the filesystems whose mount point matches exclude
+// and repeated mount points, keeping the first
+func selectFilesystems(filesystems []filesystemStats, exclude *regexp.Regexp) []filesystemStats {
+	seen := make(map[string]bool)
+	var selected []filesystemStats
+	for _, fs := range filesystems {
+		if seen[fs.MountPoint] || (exclude != nil && exclude.MatchString(fs.MountPoint)) {
+			continue
+		}
+		seen[fs.MountPoint] = true
+		selected = append(selected, fs)
+	}
+	return selected
+}
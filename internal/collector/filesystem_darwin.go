@@ -0,0 +1,50 @@
+//go:build darwin
+
+package collector
+
+import (
+	"fmt"
+	"syscall"
+)
+
+// mntNoWait is MNT_NOWAIT from <sys/mount.h>: return cached statistics
+// instead of waiting on unresponsive network mounts
+const mntNoWait = 2
+
+// readFilesystems lists the mounted filesystems via getfsstat
+func readFilesystems() ([]filesystemStats, error) {
+	n, err := syscall.Getfsstat(nil, mntNoWait)
+	if err != nil {
+		return nil, fmt.Errorf("getfsstat: %w", err)
+	}
+	buf := make([]syscall.Statfs_t, n)
+	n, err = syscall.Getfsstat(buf, mntNoWait)
+	if err != nil {
+		return nil, fmt.Errorf("getfsstat: %w", err)
+	}
+
+	filesystems := make([]filesystemStats, 0, n)
+	for _, stat := range buf[:n] {
+		blockSize := float64(stat.Bsize)
+		filesystems = append(filesystems, filesystemStats{
+			MountPoint: cString(stat.Mntonname[:]),
+			FSType:     cString(stat.Fstypename[:]),
+			Size:       float64(stat.Blocks) * blockSize,
+			Free:       float64(stat.Bfree) * blockSize,
+			Avail:      float64(stat.Bavail) * blockSize,
+		})
+	}
+	return filesystems, nil
+}
+
+// cString converts a NUL-terminated C char array to a string
+func cString(chars []int8) string {
+	b := make([]byte, 0, len(chars))
+	for _, c := range chars {
+		if c == 0 {
+			break
+		}
+		b = append(b, byte(c))
+	}
+	return string(b)
+}
@@ -0,0 +1,10 @@
+//go:build !darwin
+
+package collector
+
+import "errors"
+
+// readFilesystems is only implemented on macOS
+func readFilesystems() ([]filesystemStats, error) {
+	return nil, errors.New("getfsstat requires macOS")
+}
@@ -0,0 +1,50 @@
+package collector
+
+import (
+	"regexp"
+	"slices"
+	"testing"
+
+	"mac-powermetrics-exporter/internal/config"
+)
+
+func TestSelectFilesystems(t *testing.T) {
+	filesystems := []filesystemStats{
+		{MountPoint: "/", FSType: "apfs"},
+		{MountPoint: "/dev", FSType: "devfs"},
+		{MountPoint: "/System/Volumes/VM", FSType: "apfs"},
+		{MountPoint: "/System/Volumes/Data", FSType: "apfs"},
+		{MountPoint: "/System/Volumes/Data", FSType: "apfs"},
+		{MountPoint: "/Volumes/Backup", FSType: "hfs"},
+		{MountPoint: "/Volumes/Installer", FSType: "hfs"},
+	}
+
+	tests := []struct {
+		name    string
+		exclude string
+		want    []string
+	}{
+		{
+			name:    "default",
+			exclude: config.New().FilesystemMountPointsExclude,
+			want:    []string{"/", "/System/Volumes/Data", "/Volumes/Backup", "/Volumes/Installer"},
+		},
+		{
+			name:    "disk images",
+			exclude: `^/(dev|Volumes/Installer)($|/)`,
+			want:    []string{"/", "/System/Volumes/VM", "/System/Volumes/Data", "/Volumes/Backup"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, fs := range selectFilesystems(filesystems, regexp.MustCompile(tt.exclude)) {
+				got = append(got, fs.MountPoint)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("Expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,30 @@
+package collector
+
+import "mac-powermetrics-exporter/internal/config"
+
+// frequencyUnit describes the unit frequency metrics are exported in
+type frequencyUnit struct {
+	// suffix ends the metric name, e.g. "hertz"
+	suffix string
+	// help names the unit in help strings
+	help string
+	// perMegahertz converts a frequency in Megahertz to this unit
+	perMegahertz float64
+}
+
+var (
+	hertz     = frequencyUnit{suffix: "hertz", help: "Hertz", perMegahertz: 1e6}
+	megahertz = frequencyUnit{suffix: "megahertz", help: "Megahertz", perMegahertz: 1}
+)
+
+// frequencyUnitFor returns the unit configured by FrequencyUnit, or native
+// when the collector should keep its own unit
+func frequencyUnitFor(cfg *config.Config, native frequencyUnit) frequencyUnit {
+	switch cfg.FrequencyUnit {
+	case config.FrequencyUnitHertz:
+		return hertz
+	case config.FrequencyUnitMegahertz:
+		return megahertz
+	}
+	return native
+}
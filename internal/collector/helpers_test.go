@@ -0,0 +1,73 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// gatherValues collects c through a registry and returns every sample value
+// keyed by metric name and labels, e.g. `powermetrics_cpu_frequency_hertz{core="cpu0",type="E"}`
+func gatherValues(t *testing.T, c prometheus.Collector) map[string]float64 {
+	t.Helper()
+
+	reg := prometheus.NewPedanticRegistry()
+	reg.MustRegister(c)
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatalf("Failed to gather metrics: %v", err)
+	}
+
+	values := make(map[string]float64)
+	for _, family := range families {
+		for _, m := range family.GetMetric() {
+			var labels []string
+			for _, pair := range m.GetLabel() {
+				labels = append(labels, fmt.Sprintf("%s=%q", pair.GetName(), pair.GetValue()))
+			}
+			sort.Strings(labels)
+
+			key := family.GetName()
+			if len(labels) > 0 {
+				key += "{" + strings.Join(labels, ",") + "}"
+			}
+
+			switch {
+			case m.GetGauge() != nil:
+				values[key] = m.GetGauge().GetValue()
+			case m.GetCounter() != nil:
+				values[key] = m.GetCounter().GetValue()
+			case m.GetUntyped() != nil:
+				values[key] = m.GetUntyped().GetValue()
+			}
+		}
+	}
+	return values
+}
+
+// fakeCommand is the canned result of a command run by fakeRunner
+type fakeCommand struct {
+	stdout string
+	stderr string // when set, the command fails with this stderr
+}
+
+// fakeRunner is a commandRunner returning canned results keyed by command
+// line, e.g. "pmset -g therm". Other commands fail as if not installed.
+type fakeRunner map[string]fakeCommand
+
+// Run returns the canned result for the command
+func (runner fakeRunner) Run(_ context.Context, name string, args ...string) ([]byte, error) {
+	command, ok := runner[commandLine(name, args...)]
+	if !ok {
+		return nil, &exec.Error{Name: name, Err: exec.ErrNotFound}
+	}
+	if command.stderr != "" {
+		return []byte(command.stdout), &exec.ExitError{Stderr: []byte(command.stderr)}
+	}
+	return []byte(command.stdout), nil
+}
@@ -0,0 +1,91 @@
+package collector
+
+import (
+	"regexp"
+	"strconv"
+
+	"mac-powermetrics-exporter/internal/config"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// IoregCollector collects the GPU statistics IOKit publishes for each
+// IOAccelerator, which neither powermetrics nor macmon report
+type IoregCollector struct {
+	config *config.Config
+	runner commandRunner
+
+	up                 *prometheus.Desc
+	gpuMemoryUsedBytes *prometheus.Desc
+}
+
+func init() {
+	Register("ioreg", "ioreg", func(cfg *config.Config) prometheus.Collector { return NewIoregCollector(cfg) })
+}
+
+// NewIoregCollector creates a new IoregCollector
+func NewIoregCollector(cfg *config.Config) *IoregCollector {
+	return &IoregCollector{
+		config: cfg,
+		runner: execRunner{},
+		up: prometheus.NewDesc(
+			prometheus.BuildFQName(cfg.Namespace, "ioreg", "up"),
+			"Whether the last ioreg run succeeded (1) or not (0).",
+			nil,
+			cfg.ConstLabels,
+		),
+		gpuMemoryUsedBytes: prometheus.NewDesc(
+			prometheus.BuildFQName(cfg.Namespace, "ioreg", "gpu_memory_used_bytes"),
+			"System memory in use by the GPU in bytes, from IOKit.",
+			nil,
+			cfg.ConstLabels,
+		),
+	}
+}
+
+// Describe describes metrics to Prometheus
+func (collector *IoregCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- collector.up
+	ch <- collector.gpuMemoryUsedBytes
+}
+
+// Collect is called by Prometheus when collecting metrics. The GPU memory is
+// absent on GPUs that don't report it.
+func (collector *IoregCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := scrapeContext(collector.config)
+	defer cancel()
+	args := []string{"-r", "-d", "1", "-w", "0", "-c", "IOAccelerator"}
+	out, err := collector.runner.Run(ctx, "ioreg", args...)
+	if err != nil {
+		logCommandFailure("Failed to run command", "ioreg", commandLine("ioreg", args...), err, commandStderr(err))
+		ch <- prometheus.MustNewConstMetric(collector.up, prometheus.GaugeValue, 0)
+		return
+	}
+	ch <- prometheus.MustNewConstMetric(collector.up, prometheus.GaugeValue, 1)
+
+	if used, ok := parseGPUMemoryInUse(string(out)); ok {
+		ch <- prometheus.MustNewConstMetric(collector.gpuMemoryUsedBytes, prometheus.GaugeValue, used)
+	}
+}
+
+// gpuMemoryInUsePattern matches the in-use memory of an IOAccelerator's
+// PerformanceStatistics, e.g. "In use system memory"=283426816
+var gpuMemoryInUsePattern = regexp.MustCompile(`"In use system memory"=(\d+)`)
+
+// parseGPUMemoryInUse sums the in-use system memory over all accelerators in
+// ioreg output. It returns false when no accelerator reports it.
+func parseGPUMemoryInUse(out string) (float64, bool) {
+	matches := gpuMemoryInUsePattern.FindAllStringSubmatch(out, -1)
+	if len(matches) == 0 {
+		return 0, false
+	}
+	var total float64
+	for _, match := range matches {
+		value, err := strconv.ParseFloat(match[1], 64)
+		if err != nil {
+			return 0, false
+		}
+		total += value
+	}
+	return total, true
+}
@@ -0,0 +1,60 @@
+package collector
+
+import (
+	"testing"
+
+	"mac-powermetrics-exporter/internal/config"
+)
+
+func TestParseGPUMemoryInUse(t *testing.T) {
+	tests := []struct {
+		name string
+		out  string
+		want float64
+		ok   bool
+	}{
+		{
+			name: "apple silicon",
+			out:  `    "PerformanceStatistics" = {"In use system memory (driver)"=0,"Alloc system memory"=1234567168,"In use system memory"=283426816,"Device Utilization %"=3}`,
+			want: 283426816,
+			ok:   true,
+		},
+		{
+			name: "two accelerators",
+			out: `    "PerformanceStatistics" = {"In use system memory"=1000}
+    "PerformanceStatistics" = {"In use system memory"=2000}`,
+			want: 3000,
+			ok:   true,
+		},
+		{name: "not reported", out: `    "PerformanceStatistics" = {"Device Utilization %"=3}`},
+		{name: "no accelerator", out: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := parseGPUMemoryInUse(tt.out)
+			if ok != tt.ok || got != tt.want {
+				t.Errorf("Expected (%v, %v), got (%v, %v)", tt.want, tt.ok, got, ok)
+			}
+		})
+	}
+}
+
+func TestIoregCollector(t *testing.T) {
+	collector := NewIoregCollector(config.New())
+	collector.runner = fakeRunner{"ioreg -r -d 1 -w 0 -c IOAccelerator": {stdout: `    "PerformanceStatistics" = {"In use system memory"=283426816}`}}
+
+	values := gatherValues(t, collector)
+	if got := values["ioreg_gpu_memory_used_bytes"]; got != 283426816 {
+		t.Errorf("Expected 283426816 bytes of GPU memory, got %v", values)
+	}
+	if got := values["ioreg_up"]; got != 1 {
+		t.Errorf("Expected ioreg_up 1, got %v", values)
+	}
+
+	// A failing ioreg reports only that it is down
+	collector.runner = fakeRunner{}
+	if values := gatherValues(t, collector); len(values) != 1 || values["ioreg_up"] != 0 {
+		t.Errorf("Expected only ioreg_up 0, got %v", values)
+	}
+}
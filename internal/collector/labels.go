@@ -0,0 +1,30 @@
+package collector
+
+import (
+	"strings"
+	"unicode"
+)
+
+// sanitizeLabelValue normalizes a label value taken from command output:
+// invalid UTF-8 and control characters are dropped, runs of whitespace become
+// a single space and the result is trimmed. Prometheus rejects label values
+// that are not valid UTF-8, and the rest would split one process or sensor
+// into differently spelled series.
+func sanitizeLabelValue(value string) string {
+	var b strings.Builder
+	space := false
+	for _, r := range strings.ToValidUTF8(value, "") {
+		switch {
+		case unicode.IsSpace(r):
+			space = b.Len() > 0
+		case unicode.IsControl(r) || r == unicode.ReplacementChar:
+		default:
+			if space {
+				b.WriteByte(' ')
+				space = false
+			}
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,29 @@
+package collector
+
+import "testing"
+
+func TestSanitizeLabelValue(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{name: "plain", input: "WindowServer", want: "WindowServer"},
+		{name: "inner spaces", input: "Google Chrome Helper (Renderer)", want: "Google Chrome Helper (Renderer)"},
+		{name: "whitespace runs", input: "  Google\tChrome   Helper\n", want: "Google Chrome Helper"},
+		{name: "control characters", input: "mds\x00_stores\x1b", want: "mds_stores"},
+		{name: "unicode", input: "微信 Helper", want: "微信 Helper"},
+		{name: "non-breaking space", input: "Final\u00a0Cut Pro", want: "Final Cut Pro"},
+		{name: "invalid UTF-8", input: "bad\xffname", want: "badname"},
+		{name: "quotes kept", input: `"quoted" name`, want: `"quoted" name`},
+		{name: "only whitespace", input: " \t ", want: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := sanitizeLabelValue(tt.input); got != tt.want {
+				t.Errorf("Expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
@@ -3,16 +3,30 @@ package collector
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"encoding/json"
 	"strings"
-	"log"
+	"log/slog"
 	"os/exec"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"mac-powermetrics-exporter/internal/config"
+	"mac-powermetrics-exporter/internal/logging"
 
 	"github.com/prometheus/client_golang/prometheus"
 )
 
 // MacMonCollector 定义 Prometheus 指标描述符
 type MacMonCollector struct {
+	config *config.Config
+	runner commandRunner
+	// frequency is the unit of the frequency metrics; macmon reports Megahertz
+	frequency frequencyUnit
+	// powerState records whether each scrape produced data, for power_source_info
+	powerState *PowerSourceState
+
 	allPower            *prometheus.Desc
 	anePower            *prometheus.Desc
 	cpuPower            *prometheus.Desc
@@ -22,138 +36,200 @@ type MacMonCollector struct {
 	sysPower            *prometheus.Desc
 	cpuTempAvg          *prometheus.Desc
 	gpuTempAvg          *prometheus.Desc
+	sensorTemp          *prometheus.Desc
+	cpuTempFahrenheit   *prometheus.Desc
+	gpuTempFahrenheit   *prometheus.Desc
+	sensorFahrenheit    *prometheus.Desc
 	ecpuFrequency       *prometheus.Desc
 	ecpuUsagePercent    *prometheus.Desc
 	pcpuFrequency       *prometheus.Desc
 	pcpuUsagePercent    *prometheus.Desc
+	coreUsagePercent    *prometheus.Desc
 	gpuFrequency        *prometheus.Desc
 	gpuUsagePercent     *prometheus.Desc
 	ramTotalBytes       *prometheus.Desc
 	ramUsedBytes        *prometheus.Desc
 	swapTotalBytes      *prometheus.Desc
 	swapUsedBytes       *prometheus.Desc
+	lastSample          *prometheus.Desc
+	parseErrors         prometheus.Counter
+
+	// latest is the last output read by the background stream, see Run. It
+	// is cleared when the stream exits.
+	latest atomic.Pointer[macmonSample]
+}
+
+// macmonSample is a macmon output line and the time it was read
+type macmonSample struct {
+	output *MacMonOutput
+	time   time.Time
+}
+
+// macmonStaleIntervals is how many MacmonInterval a background sample may
+// age before Collect stops serving it, e.g. when macmon hangs
+const macmonStaleIntervals = 3
+
+func init() {
+	Register("macmon", "macmon", func(cfg *config.Config) prometheus.Collector { return NewMacMonCollector(cfg) })
 }
 
 // NewMacMonCollector 创建新的 Collector 实例
-func NewMacMonCollector() *MacMonCollector {
+func NewMacMonCollector(cfg *config.Config) *MacMonCollector {
+	frequency := frequencyUnitFor(cfg, megahertz)
 	return &MacMonCollector{
+		config:    cfg,
+		runner:    execRunner{},
+		frequency: frequency,
 		allPower: prometheus.NewDesc(
-			"macmon_all_power_watts",
+			prometheus.BuildFQName(cfg.Namespace, "macmon", "all_power_watts"),
 			"Total power consumption in Watts.",
 			nil,
-			nil,
+			cfg.ConstLabels,
 		),
 		anePower: prometheus.NewDesc(
-			"macmon_ane_power_watts",
+			prometheus.BuildFQName(cfg.Namespace, "macmon", "ane_power_watts"),
 			"Current ANE power in Watts.",
 			nil,
-			nil,
+			cfg.ConstLabels,
 		),
 		cpuPower: prometheus.NewDesc(
-			"macmon_cpu_power_watts",
+			prometheus.BuildFQName(cfg.Namespace, "macmon", "cpu_power_watts"),
 			"Current CPU power in Watts.",
 			nil,
-			nil,
+			cfg.ConstLabels,
 		),
 		gpuPower: prometheus.NewDesc(
-			"macmon_gpu_power_watts",
+			prometheus.BuildFQName(cfg.Namespace, "macmon", "gpu_power_watts"),
 			"Current GPU power in Watts.",
 			nil,
-			nil,
+			cfg.ConstLabels,
 		),
 		gpuRAMPower: prometheus.NewDesc(
-			"macmon_gpu_ram_power_watts",
+			prometheus.BuildFQName(cfg.Namespace, "macmon", "gpu_ram_power_watts"),
 			"Current GPU RAM power in Watts.",
 			nil,
-			nil,
+			cfg.ConstLabels,
 		),
 		ramPower: prometheus.NewDesc(
-			"macmon_ram_power_watts",
+			prometheus.BuildFQName(cfg.Namespace, "macmon", "ram_power_watts"),
 			"Current RAM power in Watts.",
 			nil,
-			nil,
+			cfg.ConstLabels,
 		),
 		sysPower: prometheus.NewDesc(
-			"macmon_sys_power_watts",
+			prometheus.BuildFQName(cfg.Namespace, "macmon", "sys_power_watts"),
 			"Current system power in Watts.",
 			nil,
-			nil,
+			cfg.ConstLabels,
 		),
 		cpuTempAvg: prometheus.NewDesc(
-			"macmon_cpu_temperature_celsius",
+			prometheus.BuildFQName(cfg.Namespace, "macmon", "cpu_temperature_celsius"),
 			"Average CPU temperature in Celsius.",
 			nil,
-			nil,
+			cfg.ConstLabels,
 		),
 		gpuTempAvg: prometheus.NewDesc(
-			"macmon_gpu_temperature_celsius",
+			prometheus.BuildFQName(cfg.Namespace, "macmon", "gpu_temperature_celsius"),
 			"Average GPU temperature in Celsius.",
 			nil,
-			nil,
+			cfg.ConstLabels,
+		),
+		sensorTemp: prometheus.NewDesc(
+			prometheus.BuildFQName(cfg.Namespace, "macmon", "sensor_temperature_celsius"),
+			"Temperature of an individual sensor in Celsius, reported by some macmon versions.",
+			[]string{"sensor"},
+			cfg.ConstLabels,
 		),
+		cpuTempFahrenheit: fahrenheitDesc(cfg, "macmon", "cpu_temperature", "Average CPU temperature in Fahrenheit.", nil),
+		gpuTempFahrenheit: fahrenheitDesc(cfg, "macmon", "gpu_temperature", "Average GPU temperature in Fahrenheit.", nil),
+		sensorFahrenheit:  fahrenheitDesc(cfg, "macmon", "sensor_temperature", "Temperature of an individual sensor in Fahrenheit, reported by some macmon versions.", []string{"sensor"}),
 		ecpuFrequency: prometheus.NewDesc(
-			"macmon_ecpu_frequency_megahertz",
-			"Efficiency CPU frequency in Megahertz.",
-			nil,
+			prometheus.BuildFQName(cfg.Namespace, "macmon", "ecpu_frequency_"+frequency.suffix),
+			"Efficiency CPU frequency in "+frequency.help+".",
 			nil,
+			cfg.ConstLabels,
 		),
 		ecpuUsagePercent: prometheus.NewDesc(
-			"macmon_ecpu_usage_percent",
+			prometheus.BuildFQName(cfg.Namespace, "macmon", "ecpu_usage_percent"),
 			"Efficiency CPU usage percentage.",
 			nil,
-			nil,
+			cfg.ConstLabels,
 		),
 		pcpuFrequency: prometheus.NewDesc(
-			"macmon_pcpu_frequency_megahertz",
-			"Performance CPU frequency in Megahertz.",
-			nil,
+			prometheus.BuildFQName(cfg.Namespace, "macmon", "pcpu_frequency_"+frequency.suffix),
+			"Performance CPU frequency in "+frequency.help+".",
 			nil,
+			cfg.ConstLabels,
 		),
 		pcpuUsagePercent: prometheus.NewDesc(
-			"macmon_pcpu_usage_percent",
+			prometheus.BuildFQName(cfg.Namespace, "macmon", "pcpu_usage_percent"),
 			"Performance CPU usage percentage.",
 			nil,
-			nil,
+			cfg.ConstLabels,
+		),
+		coreUsagePercent: prometheus.NewDesc(
+			prometheus.BuildFQName(cfg.Namespace, "macmon", "cpu_core_usage_percent"),
+			"Per-core CPU usage percentage, reported by newer macmon versions.",
+			[]string{"core", "cluster"},
+			cfg.ConstLabels,
 		),
 		gpuFrequency: prometheus.NewDesc(
-			"macmon_gpu_frequency_megahertz",
-			"GPU frequency in Megahertz.",
-			nil,
+			prometheus.BuildFQName(cfg.Namespace, "macmon", "gpu_frequency_"+frequency.suffix),
+			"GPU frequency in "+frequency.help+".",
 			nil,
+			cfg.ConstLabels,
 		),
 		gpuUsagePercent: prometheus.NewDesc(
-			"macmon_gpu_usage_percent",
+			prometheus.BuildFQName(cfg.Namespace, "macmon", "gpu_usage_percent"),
 			"GPU usage percentage.",
 			nil,
-			nil,
+			cfg.ConstLabels,
 		),
 		ramTotalBytes: prometheus.NewDesc(
-			"macmon_memory_ram_total_bytes",
+			prometheus.BuildFQName(cfg.Namespace, "macmon", "memory_ram_total_bytes"),
 			"Total RAM size in bytes.",
 			nil,
-			nil,
+			cfg.ConstLabels,
 		),
 		ramUsedBytes: prometheus.NewDesc(
-			"macmon_memory_ram_used_bytes",
+			prometheus.BuildFQName(cfg.Namespace, "macmon", "memory_ram_used_bytes"),
 			"Used RAM size in bytes.",
 			nil,
-			nil,
+			cfg.ConstLabels,
 		),
 		swapTotalBytes: prometheus.NewDesc(
-			"macmon_memory_swap_total_bytes",
+			prometheus.BuildFQName(cfg.Namespace, "macmon", "memory_swap_total_bytes"),
 			"Total swap size in bytes.",
 			nil,
-			nil,
+			cfg.ConstLabels,
 		),
 		swapUsedBytes: prometheus.NewDesc(
-			"macmon_memory_swap_used_bytes",
+			prometheus.BuildFQName(cfg.Namespace, "macmon", "memory_swap_used_bytes"),
 			"Used swap size in bytes.",
 			nil,
+			cfg.ConstLabels,
+		),
+		lastSample: prometheus.NewDesc(
+			prometheus.BuildFQName(cfg.Namespace, "macmon", "last_sample_timestamp_seconds"),
+			"Unix time at which the last macmon output was read.",
 			nil,
+			cfg.ConstLabels,
 		),
+		parseErrors: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace:   cfg.Namespace,
+			Subsystem:   "macmon",
+			Name:        "parse_errors_total",
+			Help:        "Number of macmon output lines that could not be parsed as JSON.",
+			ConstLabels: cfg.ConstLabels,
+		}),
 	}
 }
 
+// SetPowerSourceState implements PowerBackend
+func (collector *MacMonCollector) SetPowerSourceState(state *PowerSourceState) {
+	collector.powerState = state
+}
+
 // Describe 方法注册指标到 Prometheus
 func (collector *MacMonCollector) Describe(ch chan<- *prometheus.Desc) {
 	ch <- collector.allPower
@@ -163,18 +239,22 @@ func (collector *MacMonCollector) Describe(ch chan<- *prometheus.Desc) {
 	ch <- collector.gpuRAMPower
 	ch <- collector.ramPower
 	ch <- collector.sysPower
-	ch <- collector.cpuTempAvg
-	ch <- collector.gpuTempAvg
+	describeTemperature(ch, collector.cpuTempAvg, collector.cpuTempFahrenheit)
+	describeTemperature(ch, collector.gpuTempAvg, collector.gpuTempFahrenheit)
+	describeTemperature(ch, collector.sensorTemp, collector.sensorFahrenheit)
 	ch <- collector.ecpuFrequency
 	ch <- collector.ecpuUsagePercent
 	ch <- collector.pcpuFrequency
 	ch <- collector.pcpuUsagePercent
+	ch <- collector.coreUsagePercent
 	ch <- collector.gpuFrequency
 	ch <- collector.gpuUsagePercent
 	ch <- collector.ramTotalBytes
 	ch <- collector.ramUsedBytes
 	ch <- collector.swapTotalBytes
 	ch <- collector.swapUsedBytes
+	ch <- collector.lastSample
+	ch <- collector.parseErrors.Desc()
 }
 
 // 定义 JSON 输出结构体
@@ -186,12 +266,9 @@ type MacMonOutput struct {
 	GPURAMPower float64        `json:"gpu_ram_power"`
 	RAMPower   float64         `json:"ram_power"`
 	SysPower   float64         `json:"sys_power"`
-	Temp       struct {
-		CPUTempAvg float64 `json:"cpu_temp_avg"`
-		GPUTempAvg float64 `json:"gpu_temp_avg"`
-	} `json:"temp"`
-	ECPUsage []float64 `json:"ecpu_usage"` // [frequency(MHz), usage(%)]
-	PCPUsage []float64 `json:"pcpu_usage"` // [frequency(MHz), usage(%)]
+	Temp       MacMonTemp      `json:"temp"`
+	ECPUsage MacMonClusterUsage `json:"ecpu_usage"`
+	PCPUsage MacMonClusterUsage `json:"pcpu_usage"`
 	GPUUsage []float64 `json:"gpu_usage"`  // [frequency(MHz), usage(%)]
 	Memory   struct {
 		RAMTotal int64 `json:"ram_total"`
@@ -203,55 +280,290 @@ type MacMonOutput struct {
 
 // Collect 方法执行命令并发送数据到 Prometheus
 func (collector *MacMonCollector) Collect(ch chan<- prometheus.Metric) {
-	cmd := exec.Command("macmon", "pipe", "-s", "1")
-	var out bytes.Buffer
-	cmd.Stdout = &out
-	err := cmd.Run()
+	defer func() { ch <- collector.parseErrors }()
+
+	ctx, cancel := scrapeContext(collector.config)
+	defer cancel()
+
+	if collector.config.MacmonMode == config.MacmonModeBackground {
+		sample := collector.latest.Load()
+		if sample != nil && time.Since(sample.time) > macmonStaleIntervals*collector.config.MacmonInterval {
+			logging.Failuref("macmon sample from %v is stale, not reporting it", sample.time.Format(time.RFC3339))
+			sample = nil
+		}
+		collector.powerState.set("macmon", sample != nil)
+		if sample == nil {
+			logging.Failuref("No macmon sample available")
+			return
+		}
+		collector.emit(ch, sample.output)
+		collector.emitLastSample(ch, sample.time)
+		return
+	}
+
+	out, err := collector.runner.Run(ctx, "macmon", "pipe", "-s", "1", "-i", collector.intervalMillis())
 	if err != nil {
-		log.Printf("Failed to run macmon: %v", err)
+		logCommandFailure("Failed to run command", "macmon", commandLine("macmon", "pipe", "-s", "1", "-i", collector.intervalMillis()), err, commandStderr(err))
+		collector.powerState.set("macmon", false)
 		return
 	}
 
-	scanner := bufio.NewScanner(strings.NewReader(out.String()))
+	emitted := collector.collectOutput(ch, out)
+	if emitted {
+		collector.emitLastSample(ch, time.Now())
+	}
+	collector.powerState.set("macmon", emitted)
+}
+
+// emitLastSample reports when the macmon output just emitted was read
+func (collector *MacMonCollector) emitLastSample(ch chan<- prometheus.Metric, read time.Time) {
+	ch <- prometheus.MustNewConstMetric(collector.lastSample, prometheus.GaugeValue, float64(read.UnixNano())/1e9)
+}
+
+// collectOutput emits the metrics for each JSON line of macmon output. Lines
+// that fail to parse are logged and counted so a macmon format change is
+// visible instead of silently dropping every metric. It reports whether any
+// line was emitted.
+func (collector *MacMonCollector) collectOutput(ch chan<- prometheus.Metric, out []byte) bool {
+	emitted := false
+	scanner := bufio.NewScanner(bytes.NewReader(out))
 	for scanner.Scan() {
-		line := scanner.Text()
+		if data, ok := collector.parseLine(scanner.Text()); ok {
+			collector.emit(ch, data)
+			emitted = true
+		}
+	}
+	return emitted
+}
 
-		// 解析 JSON 数据
-		var data MacMonOutput
-		if err := json.Unmarshal([]byte(line), &data); err != nil {
-			log.Printf("Failed to parse JSON: %v", err)
-			continue
+// Run keeps `macmon pipe` running in MacmonModeBackground and caches the
+// latest output for Collect, restarting macmon with backoff when it exits
+func (collector *MacMonCollector) Run(ctx context.Context) {
+	if collector.config.MacmonMode != config.MacmonModeBackground {
+		return
+	}
+
+	backoff := minStreamBackoff
+	for {
+		if collector.stream(ctx) {
+			backoff = minStreamBackoff
+		}
+		if ctx.Err() != nil {
+			return
+		}
+
+		logging.Failuref("macmon stream exited, restarting in %v", backoff)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
 		}
+		backoff = min(backoff*2, maxStreamBackoff)
+	}
+}
+
+// stream runs a single long-lived `macmon pipe` process and caches each JSON
+// line as it arrives. The cache is cleared when the process exits, so that
+// scrapes don't keep serving its last line. It reports whether any line was
+// cached.
+func (collector *MacMonCollector) stream(ctx context.Context) bool {
+	defer collector.latest.Store(nil)
+
+	cmd := exec.CommandContext(ctx, "macmon", "pipe", "-i", collector.intervalMillis())
+	stderr := &tailBuffer{max: streamStderrLimit}
+	cmd.Stderr = stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		logging.Failuref("Failed to open macmon stdout: %v", err)
+		return false
+	}
+	if err := cmd.Start(); err != nil {
+		logCommandFailure("Failed to start command", "macmon", strings.Join(cmd.Args, " "), err, "")
+		return false
+	}
 
-		// 发送指标
+	published := false
+	scanner := bufio.NewScanner(stdout)
+	for scanner.Scan() {
+		if data, ok := collector.parseLine(scanner.Text()); ok {
+			collector.latest.Store(&macmonSample{output: data, time: time.Now()})
+			published = true
+		}
+	}
+	if err := scanner.Err(); err != nil && ctx.Err() == nil {
+		logging.Failuref("Failed to read macmon output: %v", err)
+	}
+
+	if err := cmd.Wait(); err != nil && ctx.Err() == nil {
+		logCommandFailure("Command exited", "macmon", strings.Join(cmd.Args, " "), err, strings.TrimSpace(stderr.String()))
+	}
+	return published
+}
+
+// intervalMillis returns MacmonInterval as the milliseconds macmon's -i
+// flag expects
+func (collector *MacMonCollector) intervalMillis() string {
+	return strconv.FormatInt(collector.config.MacmonInterval.Milliseconds(), 10)
+}
+
+// parseLine parses one JSON line of macmon output, counting and logging
+// lines that fail to parse
+func (collector *MacMonCollector) parseLine(line string) (*MacMonOutput, bool) {
+	slog.Debug("Parsing macmon line", "line", line)
+	var data MacMonOutput
+	if err := json.Unmarshal([]byte(line), &data); err != nil {
+		collector.parseErrors.Inc()
+		logging.Failuref("Failed to parse JSON: %v: %q", err, truncateLine(line, maxLoggedLineLength))
+		return nil, false
+	}
+	return &data, true
+}
+
+// emit sends the metrics for one macmon output
+func (collector *MacMonCollector) emit(ch chan<- prometheus.Metric, data *MacMonOutput) {
+	// The power metrics powermetrics also reports are left to it when it is
+	// the PowerSource
+	if collector.config.PowerSource != config.PowerSourcePowermetrics {
 		ch <- prometheus.MustNewConstMetric(collector.allPower, prometheus.GaugeValue, data.AllPower)
 		ch <- prometheus.MustNewConstMetric(collector.anePower, prometheus.GaugeValue, data.ANEPower)
 		ch <- prometheus.MustNewConstMetric(collector.cpuPower, prometheus.GaugeValue, data.CPUPower)
 		ch <- prometheus.MustNewConstMetric(collector.gpuPower, prometheus.GaugeValue, data.GPUPower)
-		ch <- prometheus.MustNewConstMetric(collector.gpuRAMPower, prometheus.GaugeValue, data.GPURAMPower)
-		ch <- prometheus.MustNewConstMetric(collector.ramPower, prometheus.GaugeValue, data.RAMPower)
-		ch <- prometheus.MustNewConstMetric(collector.sysPower, prometheus.GaugeValue, data.SysPower)
-		ch <- prometheus.MustNewConstMetric(collector.cpuTempAvg, prometheus.GaugeValue, data.Temp.CPUTempAvg)
-		ch <- prometheus.MustNewConstMetric(collector.gpuTempAvg, prometheus.GaugeValue, data.Temp.GPUTempAvg)
-
-		if len(data.ECPUsage) >= 2 {
-			ch <- prometheus.MustNewConstMetric(collector.ecpuFrequency, prometheus.GaugeValue, data.ECPUsage[0])
-			ch <- prometheus.MustNewConstMetric(collector.ecpuUsagePercent, prometheus.GaugeValue, data.ECPUsage[1])
+	}
+	ch <- prometheus.MustNewConstMetric(collector.gpuRAMPower, prometheus.GaugeValue, data.GPURAMPower)
+	ch <- prometheus.MustNewConstMetric(collector.ramPower, prometheus.GaugeValue, data.RAMPower)
+	ch <- prometheus.MustNewConstMetric(collector.sysPower, prometheus.GaugeValue, data.SysPower)
+	emitTemperature(ch, collector.cpuTempAvg, collector.cpuTempFahrenheit, data.Temp.CPUTempAvg)
+	emitTemperature(ch, collector.gpuTempAvg, collector.gpuTempFahrenheit, data.Temp.GPUTempAvg)
+	for sensor, temp := range data.Temp.Sensors {
+		emitTemperature(ch, collector.sensorTemp, collector.sensorFahrenheit, temp, sensor)
+	}
+
+	if data.ECPUsage.Valid {
+		ch <- prometheus.MustNewConstMetric(collector.ecpuFrequency, prometheus.GaugeValue, data.ECPUsage.Frequency*collector.frequency.perMegahertz)
+		ch <- prometheus.MustNewConstMetric(collector.ecpuUsagePercent, prometheus.GaugeValue, data.ECPUsage.Usage)
+	}
+	for i, usage := range data.ECPUsage.CoreUsage {
+		ch <- prometheus.MustNewConstMetric(collector.coreUsagePercent, prometheus.GaugeValue, usage, strconv.Itoa(i), "E")
+	}
+
+	if data.PCPUsage.Valid {
+		ch <- prometheus.MustNewConstMetric(collector.pcpuFrequency, prometheus.GaugeValue, data.PCPUsage.Frequency*collector.frequency.perMegahertz)
+		ch <- prometheus.MustNewConstMetric(collector.pcpuUsagePercent, prometheus.GaugeValue, data.PCPUsage.Usage)
+	}
+	for i, usage := range data.PCPUsage.CoreUsage {
+		ch <- prometheus.MustNewConstMetric(collector.coreUsagePercent, prometheus.GaugeValue, usage, strconv.Itoa(i), "P")
+	}
+
+	if len(data.GPUUsage) >= 2 {
+		ch <- prometheus.MustNewConstMetric(collector.gpuFrequency, prometheus.GaugeValue, data.GPUUsage[0]*collector.frequency.perMegahertz)
+		ch <- prometheus.MustNewConstMetric(collector.gpuUsagePercent, prometheus.GaugeValue, data.GPUUsage[1])
+	}
+
+	ch <- prometheus.MustNewConstMetric(collector.ramTotalBytes, prometheus.GaugeValue, float64(data.Memory.RAMTotal))
+	ch <- prometheus.MustNewConstMetric(collector.ramUsedBytes, prometheus.GaugeValue, float64(data.Memory.RAMUsage))
+	ch <- prometheus.MustNewConstMetric(collector.swapTotalBytes, prometheus.GaugeValue, float64(data.Memory.SwapTotal))
+	ch <- prometheus.MustNewConstMetric(collector.swapUsedBytes, prometheus.GaugeValue, float64(data.Memory.SwapUsage))
+}
+
+// maxLoggedLineLength bounds how much of an unparsable line is logged
+const maxLoggedLineLength = 200
+
+// truncateLine shortens line to at most n bytes for logging
+func truncateLine(line string, n int) string {
+	if len(line) <= n {
+		return line
+	}
+	return line[:n] + "..."
+}
+
+// MacMonTemp holds the temperatures reported by macmon. Besides the CPU and
+// GPU averages, some versions report individual sensors, either as further
+// numeric fields or grouped in a nested object; both end up in Sensors.
+type MacMonTemp struct {
+	CPUTempAvg float64
+	GPUTempAvg float64
+	// Sensors holds per-sensor temperatures keyed by sensor name
+	Sensors map[string]float64
+}
+
+// UnmarshalJSON decodes the averages and collects every other numeric field
+// as a sensor
+func (t *MacMonTemp) UnmarshalJSON(data []byte) error {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+	*t = MacMonTemp{}
+	for name, raw := range fields {
+		var value float64
+		if err := json.Unmarshal(raw, &value); err == nil {
+			switch name {
+			case "cpu_temp_avg":
+				t.CPUTempAvg = value
+			case "gpu_temp_avg":
+				t.GPUTempAvg = value
+			default:
+				t.addSensor(name, value)
+			}
+			continue
 		}
 
-		if len(data.PCPUsage) >= 2 {
-			ch <- prometheus.MustNewConstMetric(collector.pcpuFrequency, prometheus.GaugeValue, data.PCPUsage[0])
-			ch <- prometheus.MustNewConstMetric(collector.pcpuUsagePercent, prometheus.GaugeValue, data.PCPUsage[1])
+		var group map[string]float64
+		if err := json.Unmarshal(raw, &group); err == nil {
+			for sensor, value := range group {
+				t.addSensor(sensor, value)
+			}
 		}
+	}
+	return nil
+}
 
-		if len(data.GPUUsage) >= 2 {
-			ch <- prometheus.MustNewConstMetric(collector.gpuFrequency, prometheus.GaugeValue, data.GPUUsage[0])
-			ch <- prometheus.MustNewConstMetric(collector.gpuUsagePercent, prometheus.GaugeValue, data.GPUUsage[1])
+// addSensor records the temperature of one sensor
+func (t *MacMonTemp) addSensor(name string, value float64) {
+	if t.Sensors == nil {
+		t.Sensors = make(map[string]float64)
+	}
+	t.Sensors[sanitizeLabelValue(name)] = value
+}
+
+// MacMonClusterUsage is the usage of one CPU cluster. Older macmon versions
+// print it as [frequency(MHz), usage(%)]; newer ones print one such pair per
+// core, in which case the cluster values are the mean over the cores.
+type MacMonClusterUsage struct {
+	Frequency float64
+	Usage     float64
+	CoreUsage []float64
+	// Valid is false when the field was missing or too short
+	Valid bool
+}
+
+// UnmarshalJSON accepts both the cluster pair and the per-core pairs shape
+func (u *MacMonClusterUsage) UnmarshalJSON(data []byte) error {
+	var pair []float64
+	if err := json.Unmarshal(data, &pair); err == nil {
+		if len(pair) >= 2 {
+			*u = MacMonClusterUsage{Frequency: pair[0], Usage: pair[1], Valid: true}
 		}
+		return nil
+	}
 
-		ch <- prometheus.MustNewConstMetric(collector.ramTotalBytes, prometheus.GaugeValue, float64(data.Memory.RAMTotal))
-		ch <- prometheus.MustNewConstMetric(collector.ramUsedBytes, prometheus.GaugeValue, float64(data.Memory.RAMUsage))
-		ch <- prometheus.MustNewConstMetric(collector.swapTotalBytes, prometheus.GaugeValue, float64(data.Memory.SwapTotal))
-		ch <- prometheus.MustNewConstMetric(collector.swapUsedBytes, prometheus.GaugeValue, float64(data.Memory.SwapUsage))
+	var cores [][]float64
+	if err := json.Unmarshal(data, &cores); err != nil {
+		return err
+	}
+	*u = MacMonClusterUsage{}
+	for _, core := range cores {
+		if len(core) < 2 {
+			continue
+		}
+		u.Frequency += core[0]
+		u.Usage += core[1]
+		u.CoreUsage = append(u.CoreUsage, core[1])
+	}
+	if n := len(u.CoreUsage); n > 0 {
+		u.Frequency /= float64(n)
+		u.Usage /= float64(n)
+		u.Valid = true
 	}
+	return nil
 }
@@ -0,0 +1,209 @@
+package collector
+
+import (
+	"context"
+	"encoding/json"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"mac-powermetrics-exporter/internal/config"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestMacMonClusterUsage(t *testing.T) {
+	tests := []struct {
+		name      string
+		input     string
+		frequency float64
+		usage     float64
+		cores     []float64
+		valid     bool
+	}{
+		{name: "cluster pair", input: `[1020, 12.5]`, frequency: 1020, usage: 12.5, valid: true},
+		{name: "per-core pairs", input: `[[1000, 10], [1200, 30]]`, frequency: 1100, usage: 20, cores: []float64{10, 30}, valid: true},
+		{name: "too short", input: `[1020]`},
+		{name: "missing", input: `null`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var u MacMonClusterUsage
+			if err := json.Unmarshal([]byte(tt.input), &u); err != nil {
+				t.Fatalf("Failed to unmarshal: %v", err)
+			}
+			if u.Valid != tt.valid || u.Frequency != tt.frequency || u.Usage != tt.usage || !slices.Equal(u.CoreUsage, tt.cores) {
+				t.Errorf("Unexpected usage: %+v", u)
+			}
+		})
+	}
+}
+
+func TestMacMonOutputShapes(t *testing.T) {
+	line := `{"all_power":5.1,"ecpu_usage":[972,8.5],"pcpu_usage":[[3204,40],[3204,20]],"gpu_usage":[338,2.1]}`
+
+	var data MacMonOutput
+	if err := json.Unmarshal([]byte(line), &data); err != nil {
+		t.Fatalf("Failed to unmarshal: %v", err)
+	}
+	if !data.ECPUsage.Valid || data.ECPUsage.Usage != 8.5 || len(data.ECPUsage.CoreUsage) != 0 {
+		t.Errorf("Unexpected E-cluster usage: %+v", data.ECPUsage)
+	}
+	if data.PCPUsage.Usage != 30 || !slices.Equal(data.PCPUsage.CoreUsage, []float64{40, 20}) {
+		t.Errorf("Unexpected P-cluster usage: %+v", data.PCPUsage)
+	}
+}
+
+func TestMacMonTemp(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		cpu     float64
+		gpu     float64
+		sensors map[string]float64
+	}{
+		{name: "averages only", input: `{"cpu_temp_avg":45.2,"gpu_temp_avg":38.9}`, cpu: 45.2, gpu: 38.9},
+		{
+			name:    "flat sensors",
+			input:   `{"cpu_temp_avg":45.2,"gpu_temp_avg":38.9,"Tp01":47.5,"Tg05":39.1}`,
+			cpu:     45.2,
+			gpu:     38.9,
+			sensors: map[string]float64{"Tp01": 47.5, "Tg05": 39.1},
+		},
+		{
+			name:    "nested sensors",
+			input:   `{"cpu_temp_avg":45.2,"gpu_temp_avg":38.9,"sensors":{"pACC MTR Temp Sensor0":44.0},"label":"ignored"}`,
+			cpu:     45.2,
+			gpu:     38.9,
+			sensors: map[string]float64{"pACC MTR Temp Sensor0": 44.0},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var temp MacMonTemp
+			if err := json.Unmarshal([]byte(tt.input), &temp); err != nil {
+				t.Fatalf("Failed to unmarshal: %v", err)
+			}
+			if temp.CPUTempAvg != tt.cpu || temp.GPUTempAvg != tt.gpu {
+				t.Errorf("Expected averages %v and %v, got %v and %v", tt.cpu, tt.gpu, temp.CPUTempAvg, temp.GPUTempAvg)
+			}
+			if !maps.Equal(temp.Sensors, tt.sensors) {
+				t.Errorf("Expected sensors %v, got %v", tt.sensors, temp.Sensors)
+			}
+		})
+	}
+}
+
+func TestMacMonParseErrors(t *testing.T) {
+	collector := NewMacMonCollector(config.New())
+	out := []byte(`{"all_power":5.1,"ecpu_usage":[972,8.5]}
+macmon: unexpected banner
+{"all_power":"not a number"}
+`)
+
+	ch := make(chan prometheus.Metric, 100)
+	collector.collectOutput(ch, out)
+
+	if got := testutil.ToFloat64(collector.parseErrors); got != 2 {
+		t.Errorf("Expected 2 parse errors, got %v", got)
+	}
+}
+
+func TestMacMonBackground(t *testing.T) {
+	// A macmon that checks the interval, prints one sample and keeps running
+	script := "#!/bin/sh\n[ \"$2 $3\" = \"-i 250\" ] || exit 1\necho '{\"all_power\":5.1,\"ecpu_usage\":[972,8.5]}'\nexec sleep 60\n"
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "macmon"), []byte(script), 0o755); err != nil {
+		t.Fatalf("Failed to write fake macmon: %v", err)
+	}
+	t.Setenv("PATH", dir+":"+os.Getenv("PATH"))
+
+	cfg := config.New()
+	cfg.MacmonMode = config.MacmonModeBackground
+	cfg.MacmonInterval = 250 * time.Millisecond
+	collector := NewMacMonCollector(cfg)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		collector.Run(ctx)
+		close(done)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for collector.latest.Load() == nil {
+		if time.Now().After(deadline) {
+			t.Fatal("Timed out waiting for the macmon stream")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	values := gatherValues(t, collector)
+	if got := values["macmon_all_power_watts"]; got != 5.1 {
+		t.Errorf("Expected all power 5.1 from the stream, got %v", got)
+	}
+	if got := values["macmon_ecpu_frequency_megahertz"]; got != 972 {
+		t.Errorf("Expected E-cluster frequency 972, got %v", got)
+	}
+	if got := values["macmon_last_sample_timestamp_seconds"]; time.Since(time.Unix(int64(got), 0)) > time.Minute {
+		t.Errorf("Expected a recent last sample timestamp, got %v", got)
+	}
+}
+
+func TestMacMonBackgroundStale(t *testing.T) {
+	cfg := config.New()
+	cfg.MacmonMode = config.MacmonModeBackground
+	collector := NewMacMonCollector(cfg)
+	collector.runner = fakeRunner{}
+
+	// A sample older than macmonStaleIntervals is not served
+	collector.latest.Store(&macmonSample{output: &MacMonOutput{AllPower: 5.1}, time: time.Now().Add(-time.Minute)})
+	if values := gatherValues(t, collector); len(values) != 1 {
+		t.Errorf("Expected only the parse error counter for a stale sample, got %v", values)
+	}
+
+	// Nor is the last line of a macmon that exited
+	dir := t.TempDir()
+	script := "#!/bin/sh\necho '{\"all_power\":5.1}'\n"
+	if err := os.WriteFile(filepath.Join(dir, "macmon"), []byte(script), 0o755); err != nil {
+		t.Fatalf("Failed to write fake macmon: %v", err)
+	}
+	t.Setenv("PATH", dir)
+	if !collector.stream(context.Background()) {
+		t.Fatal("Expected the stream to read a sample")
+	}
+	if collector.latest.Load() != nil {
+		t.Error("Expected the sample to be cleared once macmon exited")
+	}
+}
+
+func TestMacMonPowerSource(t *testing.T) {
+	cfg := config.New()
+	cfg.PowerSource = config.PowerSourcePowermetrics
+	collector := NewMacMonCollector(cfg)
+
+	ch := make(chan prometheus.Metric, 100)
+	collector.emit(ch, &MacMonOutput{CPUPower: 1.5, GPUPower: 0.5, RAMPower: 0.2})
+	close(ch)
+
+	emitted := make(map[string]bool)
+	for m := range ch {
+		emitted[m.Desc().String()] = true
+	}
+	if emitted[collector.cpuPower.String()] || emitted[collector.gpuPower.String()] || emitted[collector.allPower.String()] {
+		t.Error("Expected the CPU, GPU and total power to be left to powermetrics")
+	}
+	if !emitted[collector.ramPower.String()] {
+		t.Error("Expected the RAM power, which powermetrics doesn't report, to be kept")
+	}
+}
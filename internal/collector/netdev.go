@@ -0,0 +1,127 @@
+package collector
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+
+	"mac-powermetrics-exporter/internal/config"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// NetDevCollector collects per-interface traffic counters from netstat
+type NetDevCollector struct {
+	config *config.Config
+	runner commandRunner
+
+	receiveBytes  *prometheus.Desc
+	transmitBytes *prometheus.Desc
+}
+
+func init() {
+	Register("netdev", "netstat", func(cfg *config.Config) prometheus.Collector { return NewNetDevCollector(cfg) })
+}
+
+// NewNetDevCollector creates a new NetDevCollector
+func NewNetDevCollector(cfg *config.Config) *NetDevCollector {
+	return &NetDevCollector{
+		config: cfg,
+		runner: execRunner{},
+		receiveBytes: prometheus.NewDesc(
+			prometheus.BuildFQName(cfg.Namespace, "mac", "network_receive_bytes_total"),
+			"Bytes received by the network interface.",
+			[]string{"device"},
+			cfg.ConstLabels,
+		),
+		transmitBytes: prometheus.NewDesc(
+			prometheus.BuildFQName(cfg.Namespace, "mac", "network_transmit_bytes_total"),
+			"Bytes transmitted by the network interface.",
+			[]string{"device"},
+			cfg.ConstLabels,
+		),
+	}
+}
+
+// Describe describes metrics to Prometheus
+func (collector *NetDevCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- collector.receiveBytes
+	ch <- collector.transmitBytes
+}
+
+// Collect is called by Prometheus when collecting metrics
+func (collector *NetDevCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := scrapeContext(collector.config)
+	defer cancel()
+	out, err := collector.runner.Run(ctx, "netstat", "-ib")
+	if err != nil {
+		logCommandFailure("Failed to run command", "netdev", commandLine("netstat", "-ib"), err, commandStderr(err))
+		return
+	}
+
+	for _, iface := range parseNetstat(bytes.NewReader(out)) {
+		if !collector.config.NetDevIncludeLoopback && iface.loopback() {
+			continue
+		}
+		if !collector.config.NetDevIncludeDown && !iface.up {
+			continue
+		}
+		ch <- prometheus.MustNewConstMetric(collector.receiveBytes, prometheus.CounterValue, iface.receiveBytes, iface.name)
+		ch <- prometheus.MustNewConstMetric(collector.transmitBytes, prometheus.CounterValue, iface.transmitBytes, iface.name)
+	}
+}
+
+// netInterface holds the counters of one interface
+type netInterface struct {
+	name          string
+	up            bool
+	receiveBytes  float64
+	transmitBytes float64
+}
+
+// loopback reports whether the interface is a loopback interface
+func (iface netInterface) loopback() bool {
+	return strings.HasPrefix(iface.name, "lo")
+}
+
+// parseNetstat parses `netstat -ib` output. Each interface is listed once per
+// address, so only its <Link#n> row is used. The Address column is empty for
+// interfaces without a hardware address, so values are read from the right
+// using the column count of the header. Down interfaces have a trailing *.
+func parseNetstat(r io.Reader) []netInterface {
+	var interfaces []netInterface
+	var header []string
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) > 0 && fields[0] == "Name" {
+			header = fields
+			continue
+		}
+		if header == nil || len(fields) < 3 || !strings.HasPrefix(fields[2], "<Link#") {
+			continue
+		}
+
+		values := make(map[string]string)
+		for i := 1; i <= len(header) && i <= len(fields); i++ {
+			values[header[len(header)-i]] = fields[len(fields)-i]
+		}
+		iface := netInterface{name: strings.TrimSuffix(fields[0], "*"), up: !strings.HasSuffix(fields[0], "*")}
+		var err error
+		if iface.receiveBytes, err = strconv.ParseFloat(values["Ibytes"], 64); err != nil {
+			continue
+		}
+		if iface.transmitBytes, err = strconv.ParseFloat(values["Obytes"], 64); err != nil {
+			continue
+		}
+		if slices.ContainsFunc(interfaces, func(seen netInterface) bool { return seen.name == iface.name }) {
+			continue
+		}
+		interfaces = append(interfaces, iface)
+	}
+	return interfaces
+}
@@ -0,0 +1,44 @@
+package collector
+
+import (
+	"os"
+	"testing"
+)
+
+func TestParseNetstat(t *testing.T) {
+	f, err := os.Open("testdata/netstat_ib.txt")
+	if err != nil {
+		t.Fatalf("Failed to open fixture: %v", err)
+	}
+	defer f.Close()
+
+	interfaces := parseNetstat(f)
+
+	byName := make(map[string]netInterface)
+	for _, iface := range interfaces {
+		byName[iface.name] = iface
+	}
+	if len(byName) != len(interfaces) {
+		t.Errorf("Expected one row per interface, got %v", interfaces)
+	}
+
+	expected := map[string]netInterface{
+		"lo0":   {name: "lo0", up: true, receiveBytes: 234567890, transmitBytes: 234567890},
+		"en0":   {name: "en0", up: true, receiveBytes: 6543210987, transmitBytes: 456789012},
+		"en5":   {name: "en5", up: false},
+		"utun0": {name: "utun0", up: true, receiveBytes: 1234, transmitBytes: 5678},
+	}
+	for name, want := range expected {
+		got, ok := byName[name]
+		if !ok {
+			t.Errorf("Expected interface %s not found", name)
+			continue
+		}
+		if got != want {
+			t.Errorf("%s: expected %+v, got %+v", name, want, got)
+		}
+	}
+	if !byName["lo0"].loopback() || byName["en0"].loopback() {
+		t.Error("Expected only lo0 to be a loopback interface")
+	}
+}
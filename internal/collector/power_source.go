@@ -0,0 +1,88 @@
+package collector
+
+import (
+	"sync"
+
+	"mac-powermetrics-exporter/internal/config"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// PowerBackend is implemented by the collectors that report CPU and GPU
+// power, so the server can share one PowerSourceState between them
+type PowerBackend interface {
+	prometheus.Collector
+	// SetPowerSourceState makes the collector record the outcome of each
+	// scrape in state
+	SetPowerSourceState(state *PowerSourceState)
+}
+
+// PowerSourceState holds whether the last scrape of each power backend
+// produced data, keyed by collector name. A nil state records nothing.
+type PowerSourceState struct {
+	mu     sync.Mutex
+	active map[string]bool
+}
+
+// NewPowerSourceState creates an empty PowerSourceState
+func NewPowerSourceState() *PowerSourceState {
+	return &PowerSourceState{active: make(map[string]bool)}
+}
+
+// set records the outcome of a power backend's scrape
+func (state *PowerSourceState) set(backend string, active bool) {
+	if state == nil {
+		return
+	}
+	state.mu.Lock()
+	defer state.mu.Unlock()
+	state.active[backend] = active
+}
+
+// isActive reports whether the last scrape of backend produced data
+func (state *PowerSourceState) isActive(backend string) bool {
+	state.mu.Lock()
+	defer state.mu.Unlock()
+	return state.active[backend]
+}
+
+// PowerSourceCollector reports which of the enabled power backends produced
+// data, so mixed deployments can tell which power metrics to trust
+type PowerSourceCollector struct {
+	backends []string
+	state    *PowerSourceState
+	info     *prometheus.Desc
+}
+
+// NewPowerSourceCollector creates a PowerSourceCollector for the enabled
+// power backends, which record their scrapes in state
+func NewPowerSourceCollector(cfg *config.Config, backends []string, state *PowerSourceState) *PowerSourceCollector {
+	return &PowerSourceCollector{
+		backends: backends,
+		state:    state,
+		info: prometheus.NewDesc(
+			prometheus.BuildFQName(cfg.Namespace, "power", "source_info"),
+			"Enabled power backend; active is 1 when its last scrape produced data.",
+			[]string{"backend", "active"},
+			cfg.ConstLabels,
+		),
+	}
+}
+
+// Describe describes metrics to Prometheus
+func (collector *PowerSourceCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- collector.info
+}
+
+// Collect is called by Prometheus when collecting metrics. Collectors are
+// gathered concurrently, so a backend's state may be that of the previous
+// scrape; before its first scrape a backend is reported inactive.
+func (collector *PowerSourceCollector) Collect(ch chan<- prometheus.Metric) {
+	for _, backend := range collector.backends {
+		active := "0"
+		if collector.state.isActive(backend) {
+			active = "1"
+		}
+		ch <- prometheus.MustNewConstMetric(collector.info, prometheus.GaugeValue, 1, backend, active)
+	}
+}
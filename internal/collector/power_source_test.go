@@ -0,0 +1,46 @@
+package collector
+
+import (
+	"testing"
+
+	"mac-powermetrics-exporter/internal/config"
+)
+
+func TestPowerSourceCollector(t *testing.T) {
+	cfg := config.New()
+	cfg.PowermetricsInputFile = "testdata/powermetrics_apple_silicon.txt"
+	state := NewPowerSourceState()
+	powermetrics := NewPowermetricsCollector(cfg)
+	powermetrics.SetPowerSourceState(state)
+	gatherValues(t, powermetrics)
+	state.set("macmon", false)
+
+	values := gatherValues(t, NewPowerSourceCollector(cfg, []string{"powermetrics", "macmon"}, state))
+	for key, want := range map[string]float64{
+		`power_source_info{active="1",backend="powermetrics"}`: 1,
+		`power_source_info{active="0",backend="macmon"}`:       1,
+	} {
+		if got, ok := values[key]; !ok || got != want {
+			t.Errorf("%s: expected %v, got %v (present=%v)", key, want, got, ok)
+		}
+	}
+
+	// Only the enabled backends are reported
+	if values := gatherValues(t, NewPowerSourceCollector(cfg, []string{"macmon"}, state)); len(values) != 1 {
+		t.Errorf("Expected only the macmon series, got %v", values)
+	}
+}
+
+func TestPowerSourceStateIsPerServer(t *testing.T) {
+	cfg := config.New()
+	cfg.PowermetricsInputFile = "testdata/powermetrics_apple_silicon.txt"
+	powermetrics := NewPowermetricsCollector(cfg)
+	powermetrics.SetPowerSourceState(NewPowerSourceState())
+	gatherValues(t, powermetrics)
+
+	// Another exporter instance in the same process has its own state
+	values := gatherValues(t, NewPowerSourceCollector(cfg, []string{"powermetrics"}, NewPowerSourceState()))
+	if _, ok := values[`power_source_info{active="0",backend="powermetrics"}`]; !ok {
+		t.Errorf("Expected powermetrics to be inactive in a fresh state, got %v", values)
+	}
+}
@@ -3,92 +3,457 @@ package collector
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"encoding/xml"
+	"errors"
 	"fmt"
-	"log"
+	"io"
+	"log/slog"
+	"os"
 	"os/exec"
+	"regexp"
 	"strconv"
 	"strings"
+	"sync/atomic"
+	"time"
+
+	"mac-powermetrics-exporter/internal/config"
+	"mac-powermetrics-exporter/internal/logging"
 
 	"github.com/prometheus/client_golang/prometheus"
 )
 
 // PowermetricsCollector collects powermetrics information
 type PowermetricsCollector struct {
+	config *config.Config
+	runner commandRunner
+	// powerState records whether each scrape produced data, for power_source_info
+	powerState *PowerSourceState
+
+	// latest holds the most recent sample streamed in background mode, and
+	// latestText its raw output for Capture
+	latest     atomic.Pointer[streamedSample]
+	latestText atomic.Pointer[string]
+	// history holds the samples within PowermetricsAverageWindow, if enabled
+	history *sampleRing
+
+	sample  sampleDescs // instantaneous values
+	average sampleDescs // values averaged over PowermetricsAverageWindow
+
+	cpuTemperature   *prometheus.Desc
+	fieldsParsed     *prometheus.Desc
+	linesTotal       *prometheus.Desc
+	up               *prometheus.Desc
+	truncated        *prometheus.Desc
+	powerModelError  *prometheus.Desc
+	gpuEngine        *prometheus.Desc
+	idleWakeups      *prometheus.Desc
+	interruptWakeups *prometheus.Desc
+	onlineCores      *prometheus.Desc
+	thermalPressure  *prometheus.Desc
+	sampleTimestamp  *prometheus.Desc
+
+	// Power extremes over the samples of one scrape, see SamplesPerScrape
+	cpuPowerMin *prometheus.Desc
+	cpuPowerMax *prometheus.Desc
+	gpuPowerMin *prometheus.Desc
+	gpuPowerMax *prometheus.Desc
+
+	// aneUsage reports the ANE usage of the sample
+	aneUsage *prometheus.Desc
+
+	// utilization buffers GPU and ANE usage observed since the last scrape
+	utilization     *utilizationWindow
+	gpuUsage        *prometheus.Desc
+	aneUsageSummary *prometheus.Desc
+
+	// cpuPowerSummary and gpuPowerSummary observe every background sample
+	// when PowerSummaries is set
+	cpuPowerSummary prometheus.Summary
+	gpuPowerSummary prometheus.Summary
+
+	// guard keeps concurrent scrapes from running powermetrics concurrently
+	guard *scrapeGuard
+
+	// permissionDenied is set while powermetrics fails for lack of root
+	permissionDenied atomic.Bool
+	permissionError  *prometheus.Desc
+
+	// lastErrorType holds the commandErrorType of the last powermetrics run
+	lastErrorType atomic.Int32
+	lastError     *prometheus.Desc
+
+	// lastScrape and scrapeOverrun report how long each Collect took, and
+	// whether that exceeded ExpectedScrapeInterval
+	lastScrape    *prometheus.Desc
+	scrapeOverrun *prometheus.Desc
+
+	// samplers holds which powermetrics samplers this macOS supports
+	samplers         samplerProbe
+	samplerAvailable *prometheus.Desc
+
+	// smcAvailable reports whether the smc tool for measured power is installed
+	smcAvailable bool
+	smc          *SMCReader
+}
+
+// sampleDescs describes the metrics emitted for the values of a PowermetricsSample
+type sampleDescs struct {
+	// frequencyScale converts the sampled Hertz to the exported unit
+	frequencyScale float64
+	// suppressPower drops the power metrics when macmon is the PowerSource
+	suppressPower bool
+
 	cpuFrequency       *prometheus.Desc
-	cpuTemperature     *prometheus.Desc
 	cpuPower           *prometheus.Desc
 	gpuPower           *prometheus.Desc
+	combinedPower      *prometheus.Desc
 	cpuActiveResidency *prometheus.Desc
 	cpuIdleResidency   *prometheus.Desc
+	cpuDownResidency   *prometheus.Desc
+	clusterActive      *prometheus.Desc
+	clusterIdle        *prometheus.Desc
 	gpuActiveResidency *prometheus.Desc
 	gpuIdleResidency   *prometheus.Desc
 }
 
+func init() {
+	Register("powermetrics", "powermetrics", func(cfg *config.Config) prometheus.Collector { return NewPowermetricsCollector(cfg) })
+}
+
 // NewPowermetricsCollector creates a new PowermetricsCollector
-func NewPowermetricsCollector() *PowermetricsCollector {
-	return &PowermetricsCollector{
-		cpuFrequency: prometheus.NewDesc(
-			"powermetrics_cpu_frequency_hertz",
-			"Current CPU frequency in Hertz.",
-			[]string{"core"}, // frequency per core
-			nil,
-		),
+func NewPowermetricsCollector(cfg *config.Config) *PowermetricsCollector {
+	collector := &PowermetricsCollector{
+		config:   cfg,
+		runner:   execRunner{},
+		sample:   newSampleDescs(cfg, "", "Current"),
+		average:  newSampleDescs(cfg, "_avg", "Average"),
+		guard:    &scrapeGuard{share: cfg.PowermetricsConcurrency == config.PowermetricsConcurrencyShare},
+		samplers: samplerProbe{requested: powermetricsSamplers(cfg)},
+		smc:      NewSMCReader(),
 		cpuTemperature: prometheus.NewDesc(
-			"powermetrics_cpu_temperature_celsius",
+			prometheus.BuildFQName(cfg.Namespace, "powermetrics", "cpu_temperature_celsius"),
 			"Current CPU temperature in Celsius.",
 			[]string{"sensor_id"}, // temperature per sensor ID
+			cfg.ConstLabels,
+		),
+		fieldsParsed: prometheus.NewDesc(
+			prometheus.BuildFQName(cfg.Namespace, "powermetrics", "fields_parsed"),
+			"Number of recognized fields in the last powermetrics output.",
 			nil,
+			cfg.ConstLabels,
 		),
-		cpuPower: prometheus.NewDesc(
-			"powermetrics_cpu_power_milliwatts",
-			"Current CPU power in milliwatts.",
-			nil, // total CPU power
+		linesTotal: prometheus.NewDesc(
+			prometheus.BuildFQName(cfg.Namespace, "powermetrics", "lines_total"),
+			"Number of lines scanned in the last powermetrics output.",
 			nil,
+			cfg.ConstLabels,
 		),
-		gpuPower: prometheus.NewDesc(
-			"powermetrics_gpu_power_milliwatts",
-			"Current GPU power in milliwatts.",
-			nil, // total GPU power
+		aneUsage: prometheus.NewDesc(
+			prometheus.BuildFQName(cfg.Namespace, "powermetrics", "ane_usage_percent"),
+			"ANE active residency percentage, on powermetrics versions that report it.",
 			nil,
+			cfg.ConstLabels,
 		),
-		cpuActiveResidency: prometheus.NewDesc(
-			"powermetrics_cpu_active_residency_percent",
-			"Current CPU active residency percentage.",
-			[]string{"core"},
+		powerModelError: prometheus.NewDesc(
+			prometheus.BuildFQName(cfg.Namespace, "powermetrics", "power_model_error_milliwatts"),
+			"SMC-measured system power minus the modeled CPU + GPU + ANE power in milliwatts.",
 			nil,
+			cfg.ConstLabels,
 		),
-		cpuIdleResidency: prometheus.NewDesc(
-			"powermetrics_cpu_idle_residency_percent",
-			"Current CPU idle residency percentage.",
-			[]string{"core"},
+		gpuEngine: prometheus.NewDesc(
+			prometheus.BuildFQName(cfg.Namespace, "powermetrics", "gpu_engine_active_residency_percent"),
+			"Current GPU active residency percentage per engine.",
+			[]string{"engine"},
+			cfg.ConstLabels,
+		),
+		idleWakeups: prometheus.NewDesc(
+			prometheus.BuildFQName(cfg.Namespace, "powermetrics", "idle_wakeups_per_second"),
+			"System-wide package idle wakeups per second.",
 			nil,
+			cfg.ConstLabels,
 		),
-		gpuActiveResidency: prometheus.NewDesc(
-			"powermetrics_gpu_active_residency_percent",
-			"Current GPU active residency percentage.",
+		interruptWakeups: prometheus.NewDesc(
+			prometheus.BuildFQName(cfg.Namespace, "powermetrics", "interrupt_wakeups_per_second"),
+			"System-wide interrupt wakeups per second.",
 			nil,
+			cfg.ConstLabels,
+		),
+		onlineCores: prometheus.NewDesc(
+			prometheus.BuildFQName(cfg.Namespace, "system", "cpu_online_cores"),
+			"Number of CPU cores with non-zero active residency in the powermetrics sample.",
 			nil,
+			cfg.ConstLabels,
 		),
-		gpuIdleResidency: prometheus.NewDesc(
-			"powermetrics_gpu_idle_residency_percent",
-			"Current GPU idle residency percentage.",
+		thermalPressure: prometheus.NewDesc(
+			prometheus.BuildFQName(cfg.Namespace, "system", "thermal_pressure_level"),
+			"Thermal pressure level from the powermetrics thermal sampler: 0 nominal, 1 moderate, 2 heavy, 3 trapping, 4 sleeping.",
 			nil,
+			cfg.ConstLabels,
+		),
+		sampleTimestamp: prometheus.NewDesc(
+			prometheus.BuildFQName(cfg.Namespace, "powermetrics", "last_sample_timestamp_seconds"),
+			"Unix time the last powermetrics sample was taken.",
+			nil,
+			cfg.ConstLabels,
+		),
+		cpuPowerMin: prometheus.NewDesc(
+			prometheus.BuildFQName(cfg.Namespace, "powermetrics", "cpu_power_milliwatts_min"),
+			"Lowest CPU power in milliwatts over the samples of the last scrape.",
 			nil,
+			cfg.ConstLabels,
 		),
+		cpuPowerMax: prometheus.NewDesc(
+			prometheus.BuildFQName(cfg.Namespace, "powermetrics", "cpu_power_milliwatts_max"),
+			"Highest CPU power in milliwatts over the samples of the last scrape.",
+			nil,
+			cfg.ConstLabels,
+		),
+		gpuPowerMin: prometheus.NewDesc(
+			prometheus.BuildFQName(cfg.Namespace, "powermetrics", "gpu_power_milliwatts_min"),
+			"Lowest GPU power in milliwatts over the samples of the last scrape.",
+			nil,
+			cfg.ConstLabels,
+		),
+		gpuPowerMax: prometheus.NewDesc(
+			prometheus.BuildFQName(cfg.Namespace, "powermetrics", "gpu_power_milliwatts_max"),
+			"Highest GPU power in milliwatts over the samples of the last scrape.",
+			nil,
+			cfg.ConstLabels,
+		),
+		truncated: prometheus.NewDesc(
+			prometheus.BuildFQName(cfg.Namespace, "powermetrics", "output_truncated"),
+			"Whether the last powermetrics output exceeded the line limit (1) or not (0).",
+			nil,
+			cfg.ConstLabels,
+		),
+		permissionError: prometheus.NewDesc(
+			prometheus.BuildFQName(cfg.Namespace, "powermetrics_exporter", "permission_error"),
+			"Whether the last powermetrics run failed because the exporter is not running as root (1) or not (0).",
+			nil,
+			cfg.ConstLabels,
+		),
+		lastError: prometheus.NewDesc(
+			prometheus.BuildFQName(cfg.Namespace, "powermetrics_exporter", "last_error_type"),
+			"Why the last powermetrics run failed: 0 no error, 1 binary not found, 2 permission denied, 3 killed by the scrape timeout, 4 other failure.",
+			nil,
+			cfg.ConstLabels,
+		),
+		lastScrape: prometheus.NewDesc(
+			prometheus.BuildFQName(cfg.Namespace, "powermetrics_exporter", "last_scrape_seconds"),
+			"How long the last powermetrics scrape took in seconds.",
+			nil,
+			cfg.ConstLabels,
+		),
+		scrapeOverrun: prometheus.NewDesc(
+			prometheus.BuildFQName(cfg.Namespace, "powermetrics_exporter", "scrape_overrun"),
+			"Whether the last powermetrics scrape took longer than the expected scrape interval (1) or not (0).",
+			nil,
+			cfg.ConstLabels,
+		),
+		samplerAvailable: prometheus.NewDesc(
+			prometheus.BuildFQName(cfg.Namespace, "powermetrics", "sampler_available"),
+			"Whether the powermetrics sampler is supported on this macOS (1) or skipped (0).",
+			[]string{"sampler"},
+			cfg.ConstLabels,
+		),
+		up: prometheus.NewDesc(
+			prometheus.BuildFQName(cfg.Namespace, "powermetrics", "up"),
+			"Whether the last powermetrics run produced a sample (1) or not (0).",
+			nil,
+			cfg.ConstLabels,
+		),
+	}
+	if _, err := exec.LookPath("smc"); err == nil {
+		collector.smcAvailable = true
+	}
+	if cfg.PowermetricsMode == config.PowermetricsModeBackground && cfg.UtilizationSummaries {
+		collector.utilization = &utilizationWindow{}
+		collector.gpuUsage = prometheus.NewDesc(
+			prometheus.BuildFQName(cfg.Namespace, "powermetrics", "gpu_usage_percent"),
+			"GPU active residency percentage over the samples since the previous scrape.",
+			nil,
+			cfg.ConstLabels,
+		)
+		// The summary has its own name, so ane_usage_percent stays a gauge
+		collector.aneUsageSummary = prometheus.NewDesc(
+			prometheus.BuildFQName(cfg.Namespace, "powermetrics", "ane_usage_distribution_percent"),
+			"ANE active residency percentage over the samples since the previous scrape.",
+			nil,
+			cfg.ConstLabels,
+		)
 	}
+	if cfg.PowermetricsMode == config.PowermetricsModeBackground && cfg.PowerSummaries && !collector.sample.suppressPower {
+		collector.cpuPowerSummary = newPowerSummary(cfg, "cpu_power_distribution_milliwatts", "CPU")
+		collector.gpuPowerSummary = newPowerSummary(cfg, "gpu_power_distribution_milliwatts", "GPU")
+	}
+	if size := cfg.PowermetricsAverageSamples(); size > 0 {
+		collector.history = newSampleRing(size)
+	}
+	return collector
+}
+
+// newPowerSummary creates a summary of the power of component observed by
+// the background sampler
+func newPowerSummary(cfg *config.Config, name, component string) prometheus.Summary {
+	return prometheus.NewSummary(prometheus.SummaryOpts{
+		Namespace:   cfg.Namespace,
+		Subsystem:   "powermetrics",
+		Name:        name,
+		Help:        component + " power in milliwatts observed by the background sampler over the last 10 minutes.",
+		Objectives:  map[float64]float64{0.5: 0.05, 0.9: 0.01, 0.99: 0.001},
+		MaxAge:      10 * time.Minute,
+		ConstLabels: cfg.ConstLabels,
+	})
+}
+
+// newSampleDescs creates the sample metric descriptors. suffix is appended to
+// every metric name and qualifier starts every help string.
+func newSampleDescs(cfg *config.Config, suffix, qualifier string) sampleDescs {
+	unit := frequencyUnitFor(cfg, hertz)
+	return sampleDescs{
+		frequencyScale: unit.perMegahertz / hertz.perMegahertz,
+		suppressPower:  cfg.PowerSource == config.PowerSourceMacmon,
+		cpuFrequency: prometheus.NewDesc(
+			prometheus.BuildFQName(cfg.Namespace, "powermetrics", "cpu_frequency_"+unit.suffix+suffix),
+			qualifier+" CPU frequency in "+unit.help+".",
+			[]string{"core", "type"}, // frequency per core
+			cfg.ConstLabels,
+		),
+		cpuPower: prometheus.NewDesc(
+			prometheus.BuildFQName(cfg.Namespace, "powermetrics", "cpu_power_milliwatts"+suffix),
+			qualifier+" CPU power in milliwatts.",
+			nil, // total CPU power
+			cfg.ConstLabels,
+		),
+		gpuPower: prometheus.NewDesc(
+			prometheus.BuildFQName(cfg.Namespace, "powermetrics", "gpu_power_milliwatts"+suffix),
+			qualifier+" GPU power in milliwatts.",
+			[]string{"gpu", "gpu_index"}, // integrated or discrete, and the index powermetrics numbers it with
+			cfg.ConstLabels,
+		),
+		combinedPower: prometheus.NewDesc(
+			prometheus.BuildFQName(cfg.Namespace, "powermetrics", "combined_power_milliwatts"+suffix),
+			qualifier+" combined CPU + GPU + ANE power in milliwatts.",
+			nil,
+			cfg.ConstLabels,
+		),
+		cpuActiveResidency: prometheus.NewDesc(
+			prometheus.BuildFQName(cfg.Namespace, "powermetrics", "cpu_active_residency_percent"+suffix),
+			qualifier+" CPU active residency percentage.",
+			[]string{"core", "type"},
+			cfg.ConstLabels,
+		),
+		cpuIdleResidency: prometheus.NewDesc(
+			prometheus.BuildFQName(cfg.Namespace, "powermetrics", "cpu_idle_residency_percent"+suffix),
+			qualifier+" CPU idle residency percentage.",
+			[]string{"core", "type"},
+			cfg.ConstLabels,
+		),
+		cpuDownResidency: prometheus.NewDesc(
+			prometheus.BuildFQName(cfg.Namespace, "powermetrics", "cpu_down_residency_percent"+suffix),
+			qualifier+" CPU down residency percentage, the time the core was powered off.",
+			[]string{"core", "type"},
+			cfg.ConstLabels,
+		),
+		clusterActive: prometheus.NewDesc(
+			prometheus.BuildFQName(cfg.Namespace, "powermetrics", "cluster_active_residency_percent"+suffix),
+			qualifier+" CPU cluster active residency percentage.",
+			[]string{"cluster"},
+			cfg.ConstLabels,
+		),
+		clusterIdle: prometheus.NewDesc(
+			prometheus.BuildFQName(cfg.Namespace, "powermetrics", "cluster_idle_residency_percent"+suffix),
+			qualifier+" CPU cluster idle residency percentage, the time every core of the cluster was idle.",
+			[]string{"cluster"},
+			cfg.ConstLabels,
+		),
+		gpuActiveResidency: prometheus.NewDesc(
+			prometheus.BuildFQName(cfg.Namespace, "powermetrics", "gpu_active_residency_percent"+suffix),
+			qualifier+" GPU active residency percentage.",
+			[]string{"gpu", "gpu_index"},
+			cfg.ConstLabels,
+		),
+		gpuIdleResidency: prometheus.NewDesc(
+			prometheus.BuildFQName(cfg.Namespace, "powermetrics", "gpu_idle_residency_percent"+suffix),
+			qualifier+" GPU idle residency percentage.",
+			[]string{"gpu", "gpu_index"},
+			cfg.ConstLabels,
+		),
+	}
+}
+
+// ShareScrapeGuard makes the collector run powermetrics through the scrape
+// guard of other, so that two instances never run it at the same time
+func (collector *PowermetricsCollector) ShareScrapeGuard(other *PowermetricsCollector) {
+	collector.guard = other.guard
+}
+
+// SetSMCReader implements SMCConsumer
+func (collector *PowermetricsCollector) SetSMCReader(reader *SMCReader) {
+	collector.smc = reader
+}
+
+// SetPowerSourceState implements PowerBackend
+func (collector *PowermetricsCollector) SetPowerSourceState(state *PowerSourceState) {
+	collector.powerState = state
 }
 
 // Describe describes metrics to Prometheus
 func (collector *PowermetricsCollector) Describe(ch chan<- *prometheus.Desc) {
-	ch <- collector.cpuFrequency
+	collector.sample.describe(ch)
+	if collector.history != nil {
+		collector.average.describe(ch)
+	}
 	ch <- collector.cpuTemperature
-	ch <- collector.cpuPower
-	ch <- collector.gpuPower
-	ch <- collector.cpuActiveResidency
-	ch <- collector.cpuIdleResidency
-	ch <- collector.gpuActiveResidency
-	ch <- collector.gpuIdleResidency
+	ch <- collector.fieldsParsed
+	ch <- collector.linesTotal
+	ch <- collector.up
+	ch <- collector.permissionError
+	ch <- collector.lastError
+	ch <- collector.lastScrape
+	if collector.config.ExpectedScrapeInterval > 0 {
+		ch <- collector.scrapeOverrun
+	}
+	ch <- collector.samplerAvailable
+	ch <- collector.truncated
+	ch <- collector.powerModelError
+	ch <- collector.gpuEngine
+	ch <- collector.idleWakeups
+	ch <- collector.interruptWakeups
+	ch <- collector.onlineCores
+	ch <- collector.thermalPressure
+	ch <- collector.sampleTimestamp
+	if collector.config.SamplesPerScrape > 1 {
+		ch <- collector.cpuPowerMin
+		ch <- collector.cpuPowerMax
+		ch <- collector.gpuPowerMin
+		ch <- collector.gpuPowerMax
+	}
+	ch <- collector.aneUsage
+	if collector.utilization != nil {
+		ch <- collector.gpuUsage
+		ch <- collector.aneUsageSummary
+	}
+	if collector.cpuPowerSummary != nil {
+		collector.cpuPowerSummary.Describe(ch)
+		collector.gpuPowerSummary.Describe(ch)
+	}
+}
+
+// describe sends all sample descriptors
+func (descs sampleDescs) describe(ch chan<- *prometheus.Desc) {
+	ch <- descs.cpuFrequency
+	ch <- descs.cpuPower
+	ch <- descs.gpuPower
+	ch <- descs.combinedPower
+	ch <- descs.cpuActiveResidency
+	ch <- descs.cpuIdleResidency
+	ch <- descs.cpuDownResidency
+	ch <- descs.clusterActive
+	ch <- descs.clusterIdle
+	ch <- descs.gpuActiveResidency
+	ch <- descs.gpuIdleResidency
 }
 
 // Partial plist structure definitions
@@ -111,161 +476,974 @@ type PlistValue struct {
 	ArrayOfDicts []PlistDict `xml:"array>dict"` // added for <array><dict>...</dict></array> structure
 }
 
+// PowermetricsSample holds the values parsed from powermetrics text output
+type PowermetricsSample struct {
+	CPUPower           *float64
+	GPUPower           *float64
+	GPUActiveResidency *float64
+	GPUIdleResidency   *float64
+	ANEActiveResidency *float64
+	CPUFrequency       map[string]float64 // Hz, keyed by core label
+	CPUActiveResidency map[string]float64 // percent, keyed by core label
+	CPUIdleResidency   map[string]float64 // percent, keyed by core label
+	CPUDownResidency   map[string]float64 // percent, keyed by core label
+	CPUType            map[string]string  // "E" or "P" cluster, keyed by core label
+
+	// ClusterActiveResidency and ClusterIdleResidency are percentages keyed
+	// by Apple Silicon cluster name (e.g. E, P0)
+	ClusterActiveResidency map[string]float64
+	ClusterIdleResidency   map[string]float64
+
+	// GPUPowerByIndex, GPUActiveResidencyByIndex and GPUIdleResidencyByIndex
+	// hold the values of each GPU section Intel Macs print, keyed by the GPU
+	// index (e.g. 1 for "GPU 1 (AMD Radeon Pro 5500M):"), and GPUKind whether
+	// that GPU is "integrated" or "discrete". The GPU fields above describe
+	// the integrated GPU. Apple Silicon prints no GPU sections.
+	GPUPowerByIndex           map[string]float64
+	GPUActiveResidencyByIndex map[string]float64
+	GPUIdleResidencyByIndex   map[string]float64
+	GPUKind                   map[string]string
+
+	// GPUEngineActiveResidency is the per-engine breakdown of
+	// GPUActiveResidency, keyed by engine (e.g. render, compute)
+	GPUEngineActiveResidency map[string]float64
+
+	// CPUPowerMin, CPUPowerMax, GPUPowerMin and GPUPowerMax are the power
+	// extremes over the samples averaged into this one. They are nil for a
+	// single parsed sample.
+	CPUPowerMin, CPUPowerMax *float64
+	GPUPowerMin, GPUPowerMax *float64
+
+	// InterruptWakeups and IdleWakeups are the system-wide interrupt and
+	// package idle wakeups per second, from the tasks sampler
+	InterruptWakeups, IdleWakeups *float64
+
+	// ThermalPressure is the level of the thermal sampler, see
+	// thermalPressureLevels. Averaged samples keep the highest level.
+	ThermalPressure *float64
+
+	// CombinedPower is powermetrics' modeled CPU + GPU + ANE power in mW
+	CombinedPower *float64
+	// MeasuredPower is the SMC-measured system power in mW. It is not part of
+	// the powermetrics output and is filled in by the collector when available.
+	MeasuredPower *float64
+
+	// Timestamp is when powermetrics took the sample, from the sample header.
+	// It is zero when the output has no header.
+	Timestamp time.Time
+
+	LinesTotal   int  // number of lines scanned
+	FieldsParsed int  // number of recognized fields
+	Truncated    bool // scanning stopped at the line limit
+}
+
 // Collect is called by Prometheus when collecting metrics
 func (collector *PowermetricsCollector) Collect(ch chan<- prometheus.Metric) {
-	// powermetrics --samplers cpu_power,gpu_power -i 1 -n 1
+	start := time.Now()
+	defer func() {
+		collector.emitScrapeDuration(ch, time.Since(start))
+		permissionError := 0.0
+		if collector.permissionDenied.Load() {
+			permissionError = 1
+		}
+		ch <- prometheus.MustNewConstMetric(collector.permissionError, prometheus.GaugeValue, permissionError)
+		ch <- prometheus.MustNewConstMetric(collector.lastError, prometheus.GaugeValue, float64(collector.lastErrorType.Load()))
+		collector.emitSamplerAvailability(ch)
+	}()
+
+	if collector.config.PowermetricsInputFile != "" {
+		collector.collectFile(ch, collector.config.PowermetricsInputFile)
+		return
+	}
+
+	if collector.config.PowermetricsMode == config.PowermetricsModeBackground {
+		streamed := collector.latest.Load()
+		if streamed != nil && time.Since(streamed.received) > powermetricsStaleIntervals*collector.config.PowermetricsInterval {
+			logging.Failuref("powermetrics sample from %v is stale, not reporting it", streamed.received.Format(time.RFC3339))
+			streamed = nil
+		}
+		if streamed == nil {
+			logging.Failuref("No powermetrics sample available")
+			collector.emitUp(ch, false)
+			return
+		}
+		sample := streamed.sample
+		// Background samples are stamped with the time powermetrics took them
+		// rather than the scrape time
+		emitWithTimestamp(ch, sample.Timestamp, func(ch chan<- prometheus.Metric) {
+			collector.emit(ch, sample)
+		})
+		if collector.history != nil {
+			average := averagePowermetricsSamples(collector.history.snapshot())
+			emitWithTimestamp(ch, average.Timestamp, func(ch chan<- prometheus.Metric) {
+				collector.average.emit(ch, average)
+			})
+		}
+		if collector.utilization != nil {
+			gpu, ane := collector.utilization.drain()
+			ch <- newQuantileSummary(collector.gpuUsage, gpu)
+			ch <- newQuantileSummary(collector.aneUsageSummary, ane)
+		}
+		if collector.cpuPowerSummary != nil {
+			collector.cpuPowerSummary.Collect(ch)
+			collector.gpuPowerSummary.Collect(ch)
+		}
+		collector.emitUp(ch, true)
+		return
+	}
+
+	// powermetrics --samplers cpu_power,gpu_power,thermal -i 1000 -n 1, plus tasks for
+	// PowermetricsWakeups, minus any sampler this macOS does not support
 	// Get CPU power and GPU power information (runs as root via LaunchDaemon)
-	cmd := exec.Command("powermetrics", "--samplers", "cpu_power,gpu_power", "-i", "1", "-n", "1")
-	var out bytes.Buffer
-	cmd.Stdout = &out
-	err := cmd.Run()
+	ctx, cancel := scrapeContext(collector.config)
+	defer cancel()
+	run := collector.guard.do(func() powermetricsRun { return collector.run(ctx) })
+	if collector.checkPermission(run.err, run.stderr) {
+		collector.emitUp(ch, false)
+		return
+	}
+	if run.err != nil {
+		collector.emitUp(ch, false)
+		return
+	}
+
+	collector.collectOutput(ctx, ch, run.out)
+}
+
+// run runs powermetrics once for a scrape, logging failures
+func (collector *PowermetricsCollector) run(ctx context.Context) powermetricsRun {
+	samplers := collector.samplers.samplers(ctx, collector.runner)
+	args := powermetricsArgs(samplers, collector.config.PowermetricsInterval, max(collector.config.SamplesPerScrape, 1)+collector.config.DiscardFirstSamples)
+	out, err := collector.runner.Run(ctx, "powermetrics", args...)
+	stderr := commandStderr(err)
+	// Lack of root is logged with a hint by checkPermission instead
+	if errType := collector.recordError(ctx, err, stderr); errType != commandErrorPermission {
+		logCommandError("powermetrics", commandLine("powermetrics", args...), errType, err, stderr)
+	}
+	return powermetricsRun{out: out, stderr: stderr, err: err}
+}
+
+// powermetricsArgs returns the arguments a scrape runs powermetrics with to
+// take the given number of samples from the given samplers. powermetrics
+// takes the interval in milliseconds.
+func powermetricsArgs(samplers []string, interval time.Duration, samples int) []string {
+	return []string{"--samplers", strings.Join(samplers, ","), "-i", strconv.FormatInt(interval.Milliseconds(), 10), "-n", strconv.Itoa(samples)}
+}
+
+// emitSamplerAvailability reports which samplers powermetrics is run with,
+// once they have been probed
+func (collector *PowermetricsCollector) emitSamplerAvailability(ch chan<- prometheus.Metric) {
+	available, ok := collector.samplers.availability()
+	if !ok {
+		return
+	}
+	for sampler, supported := range available {
+		value := 0.0
+		if supported {
+			value = 1
+		}
+		ch <- prometheus.MustNewConstMetric(collector.samplerAvailable, prometheus.GaugeValue, value, sampler)
+	}
+}
+
+// Capture returns the raw output of one powermetrics sample as a scrape sees
+// it, to compare what the parser sees with what it emits: the
+// PowermetricsInputFile when set, the latest streamed sample in background
+// mode, and otherwise a one-sample run with the probed samplers. That run
+// goes through the scrape guard, so it never runs alongside a scrape's.
+func (collector *PowermetricsCollector) Capture(ctx context.Context) (stdout []byte, stderr string, err error) {
+	if collector.config.PowermetricsInputFile != "" {
+		stdout, err = os.ReadFile(collector.config.PowermetricsInputFile)
+		return stdout, "", err
+	}
+	if collector.config.PowermetricsMode == config.PowermetricsModeBackground {
+		text := collector.latestText.Load()
+		if text == nil {
+			return nil, "", errors.New("no powermetrics sample available yet")
+		}
+		return []byte(*text), "", nil
+	}
+
+	run := collector.guard.do(func() powermetricsRun {
+		samplers := collector.samplers.samplers(ctx, collector.runner)
+		out, err := collector.runner.Run(ctx, "powermetrics", powermetricsArgs(samplers, collector.config.PowermetricsInterval, 1)...)
+		return powermetricsRun{out: out, stderr: commandStderr(err), err: err}
+	})
+	return run.out, run.stderr, run.err
+}
+
+// collectFile emits the metrics for powermetrics output captured in a file,
+// for running without powermetrics (e.g. in CI)
+func (collector *PowermetricsCollector) collectFile(ch chan<- prometheus.Metric, path string) {
+	out, err := os.ReadFile(path)
+	if err != nil {
+		logging.Failuref("Failed to read powermetrics input file: %v", err)
+		collector.emitUp(ch, false)
+		return
+	}
+
+	ctx, cancel := scrapeContext(collector.config)
+	defer cancel()
+	collector.collectOutput(ctx, ch, out)
+}
+
+// collectOutput emits the metrics for the output of one powermetrics run. A
+// run that exits successfully without printing a sample (seen occasionally
+// right after boot) is reported as a failed scrape.
+func (collector *PowermetricsCollector) collectOutput(ctx context.Context, ch chan<- prometheus.Metric, out []byte) {
+	if !bytes.Contains(out, []byte(sampleHeader)) {
+		logging.Failuref("powermetrics produced no samples (%d bytes of output)", len(out))
+		collector.emitUp(ch, false)
+		return
+	}
+
+	sample := collector.parseOutput(out)
+	collector.addMeasuredPower(ctx, sample)
+	collector.emit(ch, sample)
+	collector.emitUp(ch, true)
+}
+
+// parseOutput parses the output of one powermetrics run. The first
+// DiscardFirstSamples samples are skipped, and with SamplesPerScrape above 1
+// the remaining ones are averaged.
+func (collector *PowermetricsCollector) parseOutput(out []byte) *PowermetricsSample {
+	discard := collector.config.DiscardFirstSamples
+	if collector.config.SamplesPerScrape <= 1 && discard <= 0 {
+		return parsePowermetrics(bytes.NewReader(out), collector.config.MaxScanLines)
+	}
+
+	var samples []*PowermetricsSample
+	err := scanPowermetricsSamples(bytes.NewReader(out), true, func(text string) {
+		samples = append(samples, parsePowermetrics(strings.NewReader(text), collector.config.MaxScanLines))
+	})
+	if err != nil {
+		logging.Failuref("Failed to read powermetrics output: %v", err)
+	}
+	// A run cut short may end within the warm-up; its last sample is still
+	// better than none
+	if discard >= len(samples) {
+		discard = len(samples) - 1
+	}
+	samples = samples[max(discard, 0):]
+	if collector.config.SamplesPerScrape <= 1 && len(samples) > 0 {
+		return samples[len(samples)-1]
+	}
+	return averagePowermetricsSamples(samples)
+}
+
+// addMeasuredPower reads the SMC system power into sample when the smc tool
+// is installed. A replayed input file was not sampled on this machine, or
+// not now, so the live SMC is not read for it.
+func (collector *PowermetricsCollector) addMeasuredPower(ctx context.Context, sample *PowermetricsSample) {
+	if !collector.smcAvailable || collector.config.PowermetricsInputFile != "" {
+		return
+	}
+	keys, err := collector.smc.read(ctx, collector.runner)
+	if err != nil {
+		logCommandFailure("Failed to run command", "powermetrics", smcCommand, err, "")
+		return
+	}
+	sample.MeasuredPower = smcSystemPower(keys)
+}
+
+// Backoff bounds for restarting a powermetrics or macmon stream that exited
+const (
+	minStreamBackoff = time.Second
+	maxStreamBackoff = time.Minute
+)
+
+// Run streams powermetrics samples until ctx is canceled, publishing each
+// parsed sample for Collect. If the powermetrics process dies it is restarted
+// with exponential backoff. It returns immediately unless the collector is in
+// background mode and reads from powermetrics rather than an input file.
+func (collector *PowermetricsCollector) Run(ctx context.Context) {
+	if collector.config.PowermetricsMode != config.PowermetricsModeBackground || collector.config.PowermetricsInputFile != "" {
+		return
+	}
+
+	backoff := minStreamBackoff
+	for {
+		if collector.stream(ctx) {
+			backoff = minStreamBackoff
+		}
+		if ctx.Err() != nil {
+			return
+		}
+
+		logging.Failuref("powermetrics stream exited, restarting in %v", backoff)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, maxStreamBackoff)
+	}
+}
+
+// stream runs a single long-lived `powermetrics -n 0` process and publishes
+// samples as they arrive. It reports whether any sample was published.
+func (collector *PowermetricsCollector) stream(ctx context.Context) bool {
+	// Scrapes report powermetrics down until the next process publishes
+	defer collector.latest.Store(nil)
+	interval := strconv.FormatInt(collector.config.PowermetricsInterval.Milliseconds(), 10)
+	samplers := strings.Join(collector.samplers.samplers(ctx, collector.runner), ",")
+	cmd := exec.CommandContext(ctx, "powermetrics", "--samplers", samplers, "-i", interval, "-n", "0")
+	stderr := &tailBuffer{max: streamStderrLimit}
+	cmd.Stderr = stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		logging.Failuref("Failed to open powermetrics stdout: %v", err)
+		return false
+	}
+	if err := cmd.Start(); err != nil {
+		logCommandError("powermetrics", strings.Join(cmd.Args, " "), collector.recordError(ctx, err, ""), err, "")
+		return false
+	}
+
+	published := false
+	discard := collector.config.DiscardFirstSamples
+	// The process only exits when it fails or is stopped, so the sample
+	// being printed then is dropped
+	err = scanPowermetricsSamples(stdout, false, func(text string) {
+		// Each new powermetrics process warms up again
+		if discard > 0 {
+			discard--
+			return
+		}
+		sample := parsePowermetrics(strings.NewReader(text), collector.config.MaxScanLines)
+		collector.addMeasuredPower(ctx, sample)
+		collector.latestText.Store(&text)
+		collector.record(sample)
+		published = true
+	})
+	if err != nil && ctx.Err() == nil {
+		logging.Failuref("Failed to read powermetrics output: %v", err)
+	}
+
+	err = cmd.Wait()
+	if ctx.Err() != nil {
+		return published
+	}
+	errType := collector.recordError(ctx, err, stderr.String())
+	if !collector.checkPermission(err, stderr.String()) {
+		logCommandError("powermetrics", strings.Join(cmd.Args, " "), errType, err, stderr.String())
+	}
+	return published
+}
+
+// emitScrapeDuration reports how long a scrape took and, when
+// ExpectedScrapeInterval is set, whether it overran the scrape interval. A
+// scrape is killed once ScrapeTimeout elapses, which with the defaults is
+// before the scrape interval, so reaching the timeout is an overrun too.
+func (collector *PowermetricsCollector) emitScrapeDuration(ch chan<- prometheus.Metric, elapsed time.Duration) {
+	ch <- prometheus.MustNewConstMetric(collector.lastScrape, prometheus.GaugeValue, elapsed.Seconds())
+	if limit := collector.config.ExpectedScrapeInterval; limit > 0 {
+		if timeout := collector.config.ScrapeTimeout; timeout > 0 && timeout < limit {
+			limit = timeout
+		}
+		overrun := 0.0
+		if elapsed >= limit {
+			overrun = 1
+		}
+		ch <- prometheus.MustNewConstMetric(collector.scrapeOverrun, prometheus.GaugeValue, overrun)
+	}
+}
+
+// recordError classifies the outcome of a powermetrics run for
+// powermetrics_exporter_last_error_type and returns its type
+func (collector *PowermetricsCollector) recordError(ctx context.Context, err error, stderr string) commandErrorType {
+	errType := classifyCommandError(ctx, err, stderr)
+	collector.lastErrorType.Store(int32(errType))
+	return errType
+}
+
+// emitUp reports whether the scrape produced a sample, both as
+// powermetrics_up and to power_source_info
+func (collector *PowermetricsCollector) emitUp(ch chan<- prometheus.Metric, up bool) {
+	collector.powerState.set("powermetrics", up)
+	value := 0.0
+	if up {
+		value = 1
+	}
+	ch <- prometheus.MustNewConstMetric(collector.up, prometheus.GaugeValue, value)
+}
+
+// checkPermission records whether a powermetrics run failed because the
+// exporter isn't running as root, logging how to fix it. It reports whether
+// that was the case.
+func (collector *PowermetricsCollector) checkPermission(err error, stderr string) bool {
+	denied := err != nil && isPermissionError(stderr)
+	collector.permissionDenied.Store(denied)
+	if denied {
+		logging.Failuref("powermetrics must run as root: load the exporter as a LaunchDaemon or start it with sudo (%s)", strings.TrimSpace(stderr))
+	}
+	return denied
+}
+
+// isPermissionError reports whether powermetrics stderr says it needs root,
+// e.g. "powermetrics must be invoked as the superuser"
+func isPermissionError(stderr string) bool {
+	stderr = strings.ToLower(stderr)
+	return strings.Contains(stderr, "superuser") ||
+		strings.Contains(stderr, "must be run as root") ||
+		strings.Contains(stderr, "operation not permitted")
+}
+
+// sampleHeader starts every sample in powermetrics text output, e.g.
+// *** Sampled system activity (Mon Jun  3 14:20:05 2024 +0200) (1003.56ms elapsed) ***
+const sampleHeader = "*** Sampled system activity"
+
+// sampleTimeLayout is the format of the time in the sample header
+const sampleTimeLayout = "Mon Jan _2 15:04:05 2006 -0700"
+
+// parseSampleTime extracts the sampling time from a sample header line
+func parseSampleTime(line string) (time.Time, bool) {
+	start := strings.Index(line, "(")
+	end := strings.Index(line, ")")
+	if start < 0 || end < start {
+		return time.Time{}, false
+	}
+	timestamp, err := time.Parse(sampleTimeLayout, strings.TrimSpace(line[start+1:end]))
 	if err != nil {
-		log.Printf("Failed to run powermetrics: %v", err)
+		return time.Time{}, false
+	}
+	return timestamp, true
+}
+
+// thermalPressureLevels maps the pressure levels powermetrics prints to the
+// values of system_thermal_pressure_level
+var thermalPressureLevels = map[string]float64{
+	"nominal":  0,
+	"moderate": 1,
+	"heavy":    2,
+	"trapping": 3,
+	"sleeping": 4,
+}
+
+// parseThermalPressure returns the level of a thermal sampler line, e.g.
+//
+//	Current pressure level: Nominal
+func parseThermalPressure(line string) (float64, bool) {
+	name, ok := strings.CutPrefix(strings.TrimSpace(line), "Current pressure level:")
+	if !ok {
+		return 0, false
+	}
+	level, ok := thermalPressureLevels[strings.ToLower(strings.TrimSpace(name))]
+	return level, ok
+}
+
+// scanPowermetricsSamples splits a stream of powermetrics text output into
+// samples and calls fn with the text of each one. A sample is complete once
+// the next header arrives. The text after the last header is only passed to
+// fn with keepLast, for the output of a run that finished its -n samples; a
+// stream ending otherwise may have cut it short. Anything before the first
+// header (machine model, boot time) is discarded.
+func scanPowermetricsSamples(r io.Reader, keepLast bool, fn func(text string)) error {
+	var current strings.Builder
+	inSample := false
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, sampleHeader) {
+			if inSample {
+				fn(current.String())
+			}
+			current.Reset()
+			inSample = true
+		}
+		if inSample {
+			current.WriteString(line)
+			current.WriteByte('\n')
+		}
+	}
+	if inSample && keepLast {
+		fn(current.String())
+	}
+	return scanner.Err()
+}
+
+// streamedSample is a background sample and the time the stream read it
+type streamedSample struct {
+	sample   *PowermetricsSample
+	received time.Time
+}
+
+// powermetricsStaleIntervals is how many PowermetricsInterval a background
+// sample may age before Collect stops serving it, e.g. when powermetrics
+// hangs. A sample is only read once the next one starts, so it is already
+// an interval old when published.
+const powermetricsStaleIntervals = 3
+
+// record publishes a streamed sample for Collect
+func (collector *PowermetricsCollector) record(sample *PowermetricsSample) {
+	if sample.Timestamp.IsZero() {
+		sample.Timestamp = time.Now()
+	}
+	collector.latest.Store(&streamedSample{sample: sample, received: time.Now()})
+	if collector.history != nil {
+		collector.history.add(sample)
+	}
+	if collector.utilization != nil {
+		collector.utilization.observe(sample)
+	}
+	if collector.cpuPowerSummary != nil {
+		if sample.CPUPower != nil {
+			collector.cpuPowerSummary.Observe(*sample.CPUPower)
+		}
+		if sample.GPUPower != nil {
+			collector.gpuPowerSummary.Observe(*sample.GPUPower)
+		}
+	}
+}
+
+// emit sends the metrics for a parsed sample
+func (collector *PowermetricsCollector) emit(ch chan<- prometheus.Metric, sample *PowermetricsSample) {
+	collector.sample.emit(ch, sample)
+	ch <- prometheus.MustNewConstMetric(collector.fieldsParsed, prometheus.GaugeValue, float64(sample.FieldsParsed))
+	ch <- prometheus.MustNewConstMetric(collector.linesTotal, prometheus.GaugeValue, float64(sample.LinesTotal))
+	truncated := 0.0
+	if sample.Truncated {
+		truncated = 1
+	}
+	ch <- prometheus.MustNewConstMetric(collector.truncated, prometheus.GaugeValue, truncated)
+	timestamp := sample.Timestamp
+	if timestamp.IsZero() {
+		timestamp = time.Now()
+	}
+	ch <- prometheus.MustNewConstMetric(collector.sampleTimestamp, prometheus.GaugeValue, float64(timestamp.UnixNano())/1e9)
+	// Every metric derived from the CPU and GPU power is left to macmon when
+	// it is the PowerSource
+	if !collector.sample.suppressPower {
+		collector.emitDerivedPower(ch, sample)
+	}
+	for engine, residency := range sample.GPUEngineActiveResidency {
+		ch <- prometheus.MustNewConstMetric(collector.gpuEngine, prometheus.GaugeValue, residency, engine)
+	}
+	if sample.IdleWakeups != nil {
+		ch <- prometheus.MustNewConstMetric(collector.idleWakeups, prometheus.GaugeValue, *sample.IdleWakeups)
+	}
+	if sample.InterruptWakeups != nil {
+		ch <- prometheus.MustNewConstMetric(collector.interruptWakeups, prometheus.GaugeValue, *sample.InterruptWakeups)
+	}
+	if sample.ANEActiveResidency != nil {
+		ch <- prometheus.MustNewConstMetric(collector.aneUsage, prometheus.GaugeValue, *sample.ANEActiveResidency)
+	}
+	if online, ok := onlineCores(sample); ok {
+		ch <- prometheus.MustNewConstMetric(collector.onlineCores, prometheus.GaugeValue, online)
+	}
+	if sample.ThermalPressure != nil {
+		ch <- prometheus.MustNewConstMetric(collector.thermalPressure, prometheus.GaugeValue, *sample.ThermalPressure)
+	}
+
+	// Temperature information may need to be obtained separately if needed
+	// If temperature information is not included in the current powermetrics output,
+	// consider using --samplers thermal separately or other methods
+}
+
+// emitDerivedPower sends the model error and the min/max metrics computed
+// from the power of sample
+func (collector *PowermetricsCollector) emitDerivedPower(ch chan<- prometheus.Metric, sample *PowermetricsSample) {
+	if sample.MeasuredPower != nil && sample.CombinedPower != nil {
+		ch <- prometheus.MustNewConstMetric(collector.powerModelError, prometheus.GaugeValue, *sample.MeasuredPower-*sample.CombinedPower)
+	}
+	if collector.config.SamplesPerScrape > 1 {
+		if sample.CPUPowerMin != nil && sample.CPUPowerMax != nil {
+			ch <- prometheus.MustNewConstMetric(collector.cpuPowerMin, prometheus.GaugeValue, *sample.CPUPowerMin)
+			ch <- prometheus.MustNewConstMetric(collector.cpuPowerMax, prometheus.GaugeValue, *sample.CPUPowerMax)
+		}
+		if sample.GPUPowerMin != nil && sample.GPUPowerMax != nil {
+			ch <- prometheus.MustNewConstMetric(collector.gpuPowerMin, prometheus.GaugeValue, *sample.GPUPowerMin)
+			ch <- prometheus.MustNewConstMetric(collector.gpuPowerMax, prometheus.GaugeValue, *sample.GPUPowerMax)
+		}
+	}
+}
+
+// onlineCores counts the cores the scheduler ran work on during the sample:
+// those with non-zero active residency. Parked and powered-down cores report
+// none. It reports false when the sample has no per-core residency, as on
+// Intel Macs.
+func onlineCores(sample *PowermetricsSample) (float64, bool) {
+	if len(sample.CPUActiveResidency) == 0 {
+		return 0, false
+	}
+	online := 0
+	for _, residency := range sample.CPUActiveResidency {
+		if residency > 0 {
+			online++
+		}
+	}
+	return float64(online), true
+}
+
+// emitWithTimestamp forwards the metrics sent by emit to ch with timestamp
+// attached. A zero timestamp leaves them at the scrape time.
+func emitWithTimestamp(ch chan<- prometheus.Metric, timestamp time.Time, emit func(ch chan<- prometheus.Metric)) {
+	if timestamp.IsZero() {
+		emit(ch)
+		return
+	}
+	stamped := make(chan prometheus.Metric)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for m := range stamped {
+			ch <- prometheus.NewMetricWithTimestamp(timestamp, m)
+		}
+	}()
+	emit(stamped)
+	close(stamped)
+	<-done
+}
+
+// emitPower sends the power metrics of sample using descs
+func (descs sampleDescs) emitPower(ch chan<- prometheus.Metric, sample *PowermetricsSample) {
+	if sample.CPUPower != nil {
+		ch <- prometheus.MustNewConstMetric(descs.cpuPower, prometheus.GaugeValue, *sample.CPUPower)
+	}
+	emitGPU(ch, descs.gpuPower, sample, sample.GPUPower, sample.GPUPowerByIndex)
+	if sample.CombinedPower != nil {
+		ch <- prometheus.MustNewConstMetric(descs.combinedPower, prometheus.GaugeValue, *sample.CombinedPower)
+	}
+}
+
+// emit sends the value metrics of sample using descs
+func (descs sampleDescs) emit(ch chan<- prometheus.Metric, sample *PowermetricsSample) {
+	if !descs.suppressPower {
+		descs.emitPower(ch, sample)
+	}
+	for core, freq := range sample.CPUFrequency {
+		ch <- prometheus.MustNewConstMetric(descs.cpuFrequency, prometheus.GaugeValue, freq*descs.frequencyScale, core, sample.CPUType[core])
+	}
+	for core, residency := range sample.CPUActiveResidency {
+		ch <- prometheus.MustNewConstMetric(descs.cpuActiveResidency, prometheus.GaugeValue, residency, core, sample.CPUType[core])
+	}
+	for core, residency := range sample.CPUIdleResidency {
+		ch <- prometheus.MustNewConstMetric(descs.cpuIdleResidency, prometheus.GaugeValue, residency, core, sample.CPUType[core])
+	}
+	for core, residency := range sample.CPUDownResidency {
+		ch <- prometheus.MustNewConstMetric(descs.cpuDownResidency, prometheus.GaugeValue, residency, core, sample.CPUType[core])
+	}
+	for cluster, residency := range sample.ClusterActiveResidency {
+		ch <- prometheus.MustNewConstMetric(descs.clusterActive, prometheus.GaugeValue, residency, cluster)
+	}
+	for cluster, residency := range sample.ClusterIdleResidency {
+		ch <- prometheus.MustNewConstMetric(descs.clusterIdle, prometheus.GaugeValue, residency, cluster)
+	}
+	emitGPU(ch, descs.gpuActiveResidency, sample, sample.GPUActiveResidency, sample.GPUActiveResidencyByIndex)
+	emitGPU(ch, descs.gpuIdleResidency, sample, sample.GPUIdleResidency, sample.GPUIdleResidencyByIndex)
+}
+
+// emitGPU sends a per-GPU value for each GPU section of sample. Without
+// sections, as on Apple Silicon, the single GPU's value is sent as the
+// integrated GPU 0.
+func emitGPU(ch chan<- prometheus.Metric, desc *prometheus.Desc, sample *PowermetricsSample, single *float64, byIndex map[string]float64) {
+	if len(sample.GPUKind) == 0 {
+		if single != nil {
+			ch <- prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, *single, "integrated", "0")
+		}
 		return
 	}
+	for index, value := range byIndex {
+		ch <- prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, value, sample.GPUKind[index], index)
+	}
+}
+
+// clusterPattern matches the E-Cluster / P0-Cluster lines that precede the
+// cores of each cluster on Apple Silicon
+var clusterPattern = regexp.MustCompile(`^([EP])\d*-Cluster `)
+
+// clusterResidencyPattern matches the cluster residency lines and captures
+// the cluster name, the kind of residency and the percentage
+var clusterResidencyPattern = regexp.MustCompile(`^([EP]\d*)-Cluster (HW active|idle) residency:\s+([\d.]+)%`)
+
+// cpuCorePattern matches the per-core lines and captures the core number
+var cpuCorePattern = regexp.MustCompile(`^CPU (\d+) `)
+
+// gpuSectionPattern matches the header of a per-GPU section and captures the
+// GPU index and name
+var gpuSectionPattern = regexp.MustCompile(`^GPU (\d+) \((.+)\):$`)
+
+// isDiscreteGPU reports whether the named GPU is a discrete one. Intel and
+// Apple GPUs are integrated; anything else, e.g. AMD Radeon, is discrete.
+func isDiscreteGPU(name string) bool {
+	return !strings.Contains(name, "Intel") && !strings.HasPrefix(name, "Apple")
+}
+
+// parsePowermetrics extracts power, frequency and residency information from
+// powermetrics text output. When maxLines is positive, scanning stops after
+// that many lines and the sample is marked as truncated.
+func parsePowermetrics(r io.Reader, maxLines int) *PowermetricsSample {
+	sample := &PowermetricsSample{
+		CPUFrequency:       make(map[string]float64),
+		CPUActiveResidency: make(map[string]float64),
+		CPUIdleResidency:   make(map[string]float64),
+		CPUDownResidency:   make(map[string]float64),
+		CPUType:            make(map[string]string),
 
-	// Flags to prevent duplicate metric submissions
-	var cpuPowerSent, gpuPowerSent bool
+		ClusterActiveResidency:   make(map[string]float64),
+		ClusterIdleResidency:     make(map[string]float64),
+		GPUEngineActiveResidency: make(map[string]float64),
 
-	// Extract power information and frequency information from text output
-	scanner := bufio.NewScanner(strings.NewReader(out.String()))
+		GPUPowerByIndex:           make(map[string]float64),
+		GPUActiveResidencyByIndex: make(map[string]float64),
+		GPUIdleResidencyByIndex:   make(map[string]float64),
+		GPUKind:                   make(map[string]string),
+	}
+
+	var cluster string
+	var tasksHeader []string
+	var gpu string       // index of the GPU section being scanned
+	var discreteGPU bool // inside the section of a discrete GPU
+	scanner := bufio.NewScanner(r)
 	for scanner.Scan() {
+		if maxLines > 0 && sample.LinesTotal >= maxLines {
+			logging.Failuref("powermetrics output exceeded %d lines, ignoring the rest", maxLines)
+			sample.Truncated = true
+			break
+		}
 		line := scanner.Text()
+		sample.LinesTotal++
+		slog.Debug("Parsing powermetrics line", "line", line)
 
-		// Look for CPU Power: 1339 mW format
-		if !cpuPowerSent && strings.Contains(line, "CPU Power:") && strings.Contains(line, "mW") {
-			parts := strings.Fields(line)
-			for i, part := range parts {
-				if part == "Power:" && i+1 < len(parts) {
-					powerStr := parts[i+1]
-					if power, err := strconv.ParseFloat(powerStr, 64); err == nil {
-						ch <- prometheus.MustNewConstMetric(collector.cpuPower, prometheus.GaugeValue, power)
-						cpuPowerSent = true
-					}
-					break
-				}
+		// Look for *** Sampled system activity (Mon Jun  3 14:20:05 2024 +0200) (1003.56ms elapsed) *** format
+		if sample.Timestamp.IsZero() && strings.HasPrefix(line, sampleHeader) {
+			if timestamp, ok := parseSampleTime(line); ok {
+				sample.Timestamp = timestamp
 			}
 		}
 
-		// Look for GPU Power: 6 mW format
-		if !gpuPowerSent && strings.Contains(line, "GPU Power:") && strings.Contains(line, "mW") {
-			parts := strings.Fields(line)
-			for i, part := range parts {
-				if part == "Power:" && i+1 < len(parts) {
-					powerStr := parts[i+1]
-					if power, err := strconv.ParseFloat(powerStr, 64); err == nil {
-						ch <- prometheus.MustNewConstMetric(collector.gpuPower, prometheus.GaugeValue, power)
-						gpuPowerSent = true
-					}
-					break
+		// Extract the system-wide wakeups from the tasks table summary row
+		// Look for ALL_TASKS  -2  312.45  61.44  12.95  0.00  902.01  96.61 ... format
+		if header := parseTaskHeader(line); header != nil {
+			tasksHeader = header
+		}
+		if tasksHeader != nil && strings.HasPrefix(line, "ALL_TASKS ") {
+			if name, values, ok := splitTaskRow(line, tasksHeader); ok && name == "ALL_TASKS" {
+				if interrupt, idle, ok := parseWakeups(values, tasksHeader); ok {
+					sample.InterruptWakeups = &interrupt
+					sample.IdleWakeups = &idle
+					sample.FieldsParsed += 2
 				}
 			}
 		}
 
-		// Extract CPU frequency information
-		// Look for CPU 0 frequency: 2064 MHz format
-		if strings.Contains(line, "frequency:") && strings.Contains(line, "MHz") && strings.Contains(line, "CPU") {
-			parts := strings.Fields(line)
-			var cpuCore string
-			var freqValue float64
+		// Look for Current pressure level: Nominal format
+		if level, ok := parseThermalPressure(line); ok {
+			sample.ThermalPressure = &level
+			sample.FieldsParsed++
+		}
 
-			for i, part := range parts {
-				if part == "CPU" && i+1 < len(parts) {
-					cpuCore = parts[i+1]
+		// Look for CPU Power: 1339 mW format
+		// GPU Power is printed in both the processor and GPU sections, so only
+		// the first occurrence of each is kept
+		if sample.CPUPower == nil && strings.Contains(line, "CPU Power:") && strings.Contains(line, "mW") {
+			if power, ok := parseFieldAfter(line, "Power:"); ok {
+				sample.CPUPower = &power
+				sample.FieldsParsed++
+			}
+		}
+
+		// Intel Macs print a section for each GPU
+		// Look for GPU 1 (AMD Radeon Pro 5500M): format
+		if match := gpuSectionPattern.FindStringSubmatch(line); match != nil {
+			gpu = match[1]
+			discreteGPU = isDiscreteGPU(match[2])
+			sample.GPUKind[gpu] = "integrated"
+			if discreteGPU {
+				sample.GPUKind[gpu] = "discrete"
+			}
+		}
+
+		// Look for GPU Power: 6 mW format
+		if strings.Contains(line, "GPU Power:") && strings.Contains(line, "mW") {
+			if power, ok := parseFieldAfter(line, "Power:"); ok {
+				_, seen := sample.GPUPowerByIndex[gpu]
+				stored := false
+				if gpu != "" && !seen {
+					sample.GPUPowerByIndex[gpu] = power
+					stored = true
+				}
+				if !discreteGPU && sample.GPUPower == nil {
+					sample.GPUPower = &power
+					stored = true
 				}
-				if part == "frequency:" && i+1 < len(parts) {
-					freqStr := parts[i+1]
-					if freq, err := strconv.ParseFloat(freqStr, 64); err == nil {
-						freqValue = freq * 1000000 // Convert MHz to Hz
-					}
+				if stored {
+					sample.FieldsParsed++
 				}
 			}
+		}
 
-			if cpuCore != "" && freqValue > 0 {
-				ch <- prometheus.MustNewConstMetric(collector.cpuFrequency, prometheus.GaugeValue, freqValue, fmt.Sprintf("cpu%s", cpuCore))
+		// Look for Combined Power (CPU + GPU + ANE): 465 mW format
+		if sample.CombinedPower == nil && strings.HasPrefix(line, "Combined Power") && strings.Contains(line, "mW") {
+			if power, ok := parseValueAfterColon(line); ok {
+				sample.CombinedPower = &power
+				sample.FieldsParsed++
 			}
 		}
 
-		// Extract CPU active residency
-		// Look for CPU 0 active residency:  99.96% format
-		if strings.Contains(line, "active residency:") && strings.Contains(line, "%") && strings.Contains(line, "CPU") {
-			parts := strings.Fields(line)
-			var cpuCore string
-			var residencyValue float64
+		// Track the cluster the following cores belong to
+		// Look for E-Cluster / P0-Cluster HW active frequency: 1216 MHz format
+		if match := clusterPattern.FindStringSubmatch(line); match != nil {
+			cluster = match[1]
+		}
+		if match := cpuCorePattern.FindStringSubmatch(line); match != nil && cluster != "" {
+			sample.CPUType["cpu"+match[1]] = cluster
+		}
 
-			for i, part := range parts {
-				if part == "CPU" && i+1 < len(parts) {
-					cpuCore = parts[i+1]
-				}
-				if part == "residency:" && i+1 < len(parts) {
-					residencyStr := strings.TrimSuffix(parts[i+1], "%")
-					if residency, err := strconv.ParseFloat(residencyStr, 64); err == nil {
-						residencyValue = residency
-					}
+		// Extract cluster residency
+		// Look for E-Cluster HW active residency:  41.02% / P0-Cluster idle residency:  94.36% format
+		if match := clusterResidencyPattern.FindStringSubmatch(line); match != nil {
+			if residency, err := strconv.ParseFloat(match[3], 64); err == nil {
+				if match[2] == "idle" {
+					sample.ClusterIdleResidency[match[1]] = residency
+				} else {
+					sample.ClusterActiveResidency[match[1]] = residency
 				}
+				sample.FieldsParsed++
 			}
+		}
 
-			if cpuCore != "" && residencyValue >= 0 {
-				ch <- prometheus.MustNewConstMetric(collector.cpuActiveResidency, prometheus.GaugeValue, residencyValue, fmt.Sprintf("cpu%s", cpuCore))
+		// Extract CPU frequency information
+		// Look for CPU 0 frequency: 2064 MHz format
+		if strings.Contains(line, "frequency:") && strings.Contains(line, "MHz") && strings.Contains(line, "CPU") {
+			cpuCore := parseCPUCore(line)
+			freq, ok := parseFieldAfter(line, "frequency:")
+			if cpuCore != "" && ok && freq > 0 {
+				sample.CPUFrequency[cpuCore] = freq * 1000000 // Convert MHz to Hz
+				sample.FieldsParsed++
+			}
+		}
+
+		// Extract CPU active residency
+		// Look for CPU 0 active residency:  99.96% format
+		if strings.Contains(line, "active residency:") && strings.Contains(line, "%") && strings.Contains(line, "CPU") {
+			cpuCore := parseCPUCore(line)
+			if residency, ok := parseFieldAfter(line, "residency:"); cpuCore != "" && ok {
+				sample.CPUActiveResidency[cpuCore] = residency
+				sample.FieldsParsed++
 			}
 		}
 
 		// Extract CPU idle residency
 		// Look for CPU 0 idle residency:   0.04% format
 		if strings.Contains(line, "idle residency:") && strings.Contains(line, "%") && strings.Contains(line, "CPU") {
-			parts := strings.Fields(line)
-			var cpuCore string
-			var residencyValue float64
-
-			for i, part := range parts {
-				if part == "CPU" && i+1 < len(parts) {
-					cpuCore = parts[i+1]
-				}
-				if part == "residency:" && i+1 < len(parts) {
-					residencyStr := strings.TrimSuffix(parts[i+1], "%")
-					if residency, err := strconv.ParseFloat(residencyStr, 64); err == nil {
-						residencyValue = residency
-					}
-				}
+			cpuCore := parseCPUCore(line)
+			if residency, ok := parseFieldAfter(line, "residency:"); cpuCore != "" && ok {
+				sample.CPUIdleResidency[cpuCore] = residency
+				sample.FieldsParsed++
 			}
+		}
 
-			if cpuCore != "" && residencyValue >= 0 {
-				ch <- prometheus.MustNewConstMetric(collector.cpuIdleResidency, prometheus.GaugeValue, residencyValue, fmt.Sprintf("cpu%s", cpuCore))
+		// Extract CPU down residency, printed for cores that can be powered off
+		// Look for CPU 4 down residency:  35.20% format
+		if strings.Contains(line, "down residency:") && strings.Contains(line, "%") && strings.Contains(line, "CPU") {
+			cpuCore := parseCPUCore(line)
+			if residency, ok := parseFieldAfter(line, "residency:"); cpuCore != "" && ok {
+				sample.CPUDownResidency[cpuCore] = residency
+				sample.FieldsParsed++
 			}
 		}
 
 		// Extract GPU HW active residency
 		// Look for GPU HW active residency:   2.25% format
 		if strings.Contains(line, "GPU HW active residency:") && strings.Contains(line, "%") {
-			parts := strings.Fields(line)
-			for i, part := range parts {
-				if part == "residency:" && i+1 < len(parts) {
-					residencyStr := strings.TrimSuffix(parts[i+1], "%")
-					if residency, err := strconv.ParseFloat(residencyStr, 64); err == nil {
-						ch <- prometheus.MustNewConstMetric(collector.gpuActiveResidency, prometheus.GaugeValue, residency)
-					}
-					break
+			if residency, ok := parseFieldAfter(line, "residency:"); ok {
+				if gpu != "" {
+					sample.GPUActiveResidencyByIndex[gpu] = residency
 				}
+				if !discreteGPU {
+					sample.GPUActiveResidency = &residency
+				}
+				sample.FieldsParsed++
+			}
+		}
+
+		// Extract per-engine GPU active residency
+		// Look for GPU render active residency:   1.80% format
+		if engine := parseGPUEngine(line); engine != "" && !discreteGPU && strings.Contains(line, "%") {
+			if residency, ok := parseFieldAfter(line, "residency:"); ok {
+				sample.GPUEngineActiveResidency[sanitizeLabelValue(engine)] = residency
+				sample.FieldsParsed++
+			}
+		}
+
+		// Extract ANE active residency, printed by some powermetrics versions
+		// Look for ANE HW active residency:   1.20% / ANE active residency:   1.20% format
+		if strings.HasPrefix(line, "ANE ") && strings.Contains(line, "active residency:") && strings.Contains(line, "%") {
+			if residency, ok := parseFieldAfter(line, "residency:"); ok {
+				sample.ANEActiveResidency = &residency
+				sample.FieldsParsed++
 			}
 		}
 
 		// Extract GPU idle residency
 		// Look for GPU idle residency:  97.75% format
 		if strings.Contains(line, "GPU idle residency:") && strings.Contains(line, "%") {
-			parts := strings.Fields(line)
-			for i, part := range parts {
-				if part == "residency:" && i+1 < len(parts) {
-					residencyStr := strings.TrimSuffix(parts[i+1], "%")
-					if residency, err := strconv.ParseFloat(residencyStr, 64); err == nil {
-						ch <- prometheus.MustNewConstMetric(collector.gpuIdleResidency, prometheus.GaugeValue, residency)
-					}
-					break
+			if residency, ok := parseFieldAfter(line, "residency:"); ok {
+				if gpu != "" {
+					sample.GPUIdleResidencyByIndex[gpu] = residency
+				}
+				if !discreteGPU {
+					sample.GPUIdleResidency = &residency
 				}
+				sample.FieldsParsed++
 			}
 		}
 	}
 
-	// Temperature information may need to be obtained separately if needed
-	// If temperature information is not included in the current powermetrics output,
-	// consider using --samplers thermal separately or other methods
+	return sample
+}
+
+// parseFieldAfter parses the number following the first field equal to
+// label, ignoring a trailing percent sign
+func parseFieldAfter(line, label string) (float64, bool) {
+	parts := strings.Fields(line)
+	for i, part := range parts {
+		if part == label && i+1 < len(parts) {
+			value, err := strconv.ParseFloat(strings.TrimSuffix(parts[i+1], "%"), 64)
+			return value, err == nil
+		}
+	}
+	return 0, false
+}
+
+// parseValueAfterColon parses the number following the last colon in line
+func parseValueAfterColon(line string) (float64, bool) {
+	idx := strings.LastIndex(line, ":")
+	if idx < 0 {
+		return 0, false
+	}
+	parts := strings.Fields(line[idx+1:])
+	if len(parts) == 0 {
+		return 0, false
+	}
+	value, err := strconv.ParseFloat(strings.TrimSuffix(parts[0], "%"), 64)
+	return value, err == nil
+}
+
+// parseGPUEngine returns the engine label (e.g. render) for a "GPU <engine>
+// active residency:" line, or "" for other lines and the aggregate HW line
+func parseGPUEngine(line string) string {
+	line = strings.TrimSpace(line)
+	end := strings.Index(line, " active residency:")
+	if !strings.HasPrefix(line, "GPU ") || end < 0 {
+		return ""
+	}
+	engine := strings.TrimSpace(line[len("GPU "):end])
+	if engine == "" || engine == "HW" {
+		return ""
+	}
+	return strings.ToLower(strings.ReplaceAll(engine, " ", "_"))
+}
+
+// parseCPUCore returns the core label (e.g. cpu0) for a "CPU N ..." line
+func parseCPUCore(line string) string {
+	parts := strings.Fields(line)
+	for i, part := range parts {
+		if part == "CPU" && i+1 < len(parts) {
+			return fmt.Sprintf("cpu%s", parts[i+1])
+		}
+	}
+	return ""
 }
@@ -0,0 +1,1016 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"mac-powermetrics-exporter/internal/config"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+func TestPowermetricsFixtures(t *testing.T) {
+	tests := []struct {
+		name     string
+		fixture  string
+		expected map[string]float64
+		absent   []string
+	}{
+		{
+			name:    "apple silicon",
+			fixture: "testdata/powermetrics_apple_silicon.txt",
+			expected: map[string]float64{
+				"powermetrics_cpu_power_milliwatts":                                         453,
+				`powermetrics_gpu_power_milliwatts{gpu="integrated",gpu_index="0"}`:         12,
+				`powermetrics_cpu_frequency_hertz{core="cpu0",type="E"}`:                    1320e6,
+				`powermetrics_cpu_frequency_hertz{core="cpu7",type="P"}`:                    2614e6,
+				`powermetrics_cpu_active_residency_percent{core="cpu0",type="E"}`:           27.65,
+				`powermetrics_cpu_active_residency_percent{core="cpu4",type="P"}`:           4.10,
+				`powermetrics_cpu_idle_residency_percent{core="cpu0",type="E"}`:             72.35,
+				`powermetrics_cpu_idle_residency_percent{core="cpu7",type="P"}`:             99.76,
+				`powermetrics_gpu_active_residency_percent{gpu="integrated",gpu_index="0"}`: 2.25,
+				`powermetrics_gpu_idle_residency_percent{gpu="integrated",gpu_index="0"}`:   97.75,
+				`powermetrics_cluster_active_residency_percent{cluster="E"}`:                41.02,
+				`powermetrics_cluster_idle_residency_percent{cluster="E"}`:                  58.98,
+				`powermetrics_cluster_active_residency_percent{cluster="P"}`:                5.64,
+				`powermetrics_cluster_idle_residency_percent{cluster="P"}`:                  94.36,
+				"powermetrics_fields_parsed":                                                33,
+				"system_cpu_online_cores":                                                   8,
+				"powermetrics_last_sample_timestamp_seconds":                                1717417205,
+				"powermetrics_up": 1,
+			},
+		},
+		{
+			// Intel Macs report duty cycles and C-states instead of per-core
+			// residency, and no separate CPU power line
+			name:    "intel",
+			fixture: "testdata/powermetrics_intel.txt",
+			expected: map[string]float64{
+				`powermetrics_gpu_power_milliwatts{gpu="integrated",gpu_index="0"}`:         214,
+				`powermetrics_gpu_active_residency_percent{gpu="integrated",gpu_index="0"}`: 3.10,
+				`powermetrics_gpu_idle_residency_percent{gpu="integrated",gpu_index="0"}`:   96.90,
+				"powermetrics_fields_parsed":                 3,
+				"powermetrics_last_sample_timestamp_seconds": 1661274922,
+				"powermetrics_up":                            1,
+			},
+			absent: []string{
+				"powermetrics_cpu_power_milliwatts",
+				"system_cpu_online_cores",
+				`powermetrics_cpu_frequency_hertz{core="cpu0",type=""}`,
+				`powermetrics_cpu_active_residency_percent{core="cpu0",type=""}`,
+			},
+		},
+		{
+			// MacBook Pros with a discrete GPU print a section per GPU
+			name:    "intel dual gpu",
+			fixture: "testdata/powermetrics_intel_dual_gpu.txt",
+			expected: map[string]float64{
+				`powermetrics_gpu_power_milliwatts{gpu="integrated",gpu_index="0"}`:         214,
+				`powermetrics_gpu_power_milliwatts{gpu="discrete",gpu_index="1"}`:           5120,
+				`powermetrics_gpu_active_residency_percent{gpu="integrated",gpu_index="0"}`: 3.10,
+				`powermetrics_gpu_active_residency_percent{gpu="discrete",gpu_index="1"}`:   12.40,
+				`powermetrics_gpu_idle_residency_percent{gpu="integrated",gpu_index="0"}`:   96.90,
+				`powermetrics_gpu_idle_residency_percent{gpu="discrete",gpu_index="1"}`:     87.60,
+				"powermetrics_fields_parsed": 6,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := os.Open(tt.fixture)
+			if err != nil {
+				t.Fatalf("Failed to open fixture: %v", err)
+			}
+			defer f.Close()
+
+			cfg := config.New()
+			cfg.PowermetricsMode = config.PowermetricsModeBackground
+			collector := NewPowermetricsCollector(cfg)
+			collector.record(parsePowermetrics(f, 0))
+
+			values := gatherValues(t, collector)
+			for key, want := range tt.expected {
+				got, ok := values[key]
+				if !ok {
+					t.Errorf("Expected metric %s not found", key)
+					continue
+				}
+				if got != want {
+					t.Errorf("%s: expected %v, got %v", key, want, got)
+				}
+			}
+			for _, key := range tt.absent {
+				if _, ok := values[key]; ok {
+					t.Errorf("Expected metric %s to be absent", key)
+				}
+			}
+		})
+	}
+}
+
+func TestParsePowermetricsCoverage(t *testing.T) {
+	f, err := os.Open("testdata/powermetrics_apple_silicon.txt")
+	if err != nil {
+		t.Fatalf("Failed to open fixture: %v", err)
+	}
+	defer f.Close()
+
+	sample := parsePowermetrics(f, 0)
+
+	// CPU, GPU and combined power, 8 cores x (frequency, active, idle),
+	// 2 clusters x (active, idle), GPU active and idle
+	if sample.FieldsParsed != 33 {
+		t.Errorf("Expected 33 fields parsed, got %d", sample.FieldsParsed)
+	}
+	if sample.LinesTotal != 57 {
+		t.Errorf("Expected 57 lines scanned, got %d", sample.LinesTotal)
+	}
+}
+
+func TestPowermetricsTimestampFallback(t *testing.T) {
+	sample := parsePowermetrics(strings.NewReader("CPU Power: 453 mW\n"), 0)
+	if !sample.Timestamp.IsZero() {
+		t.Fatalf("Expected no timestamp without a header, got %v", sample.Timestamp)
+	}
+
+	cfg := config.New()
+	cfg.PowermetricsMode = config.PowermetricsModeBackground
+	collector := NewPowermetricsCollector(cfg)
+	before := float64(time.Now().Unix())
+	collector.record(sample)
+	after := float64(time.Now().Unix()) + 1
+
+	got := gatherValues(t, collector)["powermetrics_last_sample_timestamp_seconds"]
+	if got < before || got > after {
+		t.Errorf("Expected a timestamp between %v and %v, got %v", before, after, got)
+	}
+}
+
+func TestPowermetricsBackgroundStale(t *testing.T) {
+	fixture, err := filepath.Abs("testdata/powermetrics_apple_silicon.txt")
+	if err != nil {
+		t.Fatalf("Failed to resolve fixture: %v", err)
+	}
+	cfg := config.New()
+	cfg.PowermetricsMode = config.PowermetricsModeBackground
+	collector := NewPowermetricsCollector(cfg)
+	collector.runner = fakeRunner{}
+
+	// A sample older than powermetricsStaleIntervals is not served
+	power := 453.0
+	collector.latest.Store(&streamedSample{sample: &PowermetricsSample{CPUPower: &power}, received: time.Now().Add(-time.Minute)})
+	values := gatherValues(t, collector)
+	if values["powermetrics_up"] != 0 {
+		t.Errorf("Expected powermetrics_up 0 for a stale sample, got %v", values["powermetrics_up"])
+	}
+	if _, ok := values["powermetrics_cpu_power_milliwatts"]; ok {
+		t.Error("Expected no CPU power from a stale sample")
+	}
+
+	// Nor is the last sample of a powermetrics that exited
+	dir := t.TempDir()
+	script := "#!/bin/sh\n/bin/cat " + fixture + " " + fixture + "\n"
+	if err := os.WriteFile(filepath.Join(dir, "powermetrics"), []byte(script), 0o755); err != nil {
+		t.Fatalf("Failed to write fake powermetrics: %v", err)
+	}
+	t.Setenv("PATH", dir)
+	if !collector.stream(context.Background()) {
+		t.Fatal("Expected the stream to read a sample")
+	}
+	if collector.latest.Load() != nil {
+		t.Error("Expected the sample to be cleared once powermetrics exited")
+	}
+	if values := gatherValues(t, collector); values["powermetrics_up"] != 0 {
+		t.Errorf("Expected powermetrics_up 0 once powermetrics exited, got %v", values["powermetrics_up"])
+	}
+}
+
+func TestPowermetricsThermalPressure(t *testing.T) {
+	data, err := os.ReadFile("testdata/powermetrics_thermal.txt")
+	if err != nil {
+		t.Fatalf("Failed to read fixture: %v", err)
+	}
+	sample := parsePowermetrics(strings.NewReader(string(data)), 0)
+	if sample.ThermalPressure == nil || *sample.ThermalPressure != 1 {
+		t.Fatalf("Expected the moderate level 1, got %v", sample.ThermalPressure)
+	}
+	if _, ok := parseThermalPressure("Current pressure level: Unknown"); ok {
+		t.Error("Expected an unknown level to be rejected")
+	}
+
+	collector := NewPowermetricsCollector(config.New())
+	collector.runner = fakeRunner{"powermetrics --samplers cpu_power,gpu_power,thermal -i 1000 -n 1": {stdout: string(data)}}
+	if got := gatherValues(t, collector)["system_thermal_pressure_level"]; got != 1 {
+		t.Errorf("Expected system_thermal_pressure_level 1, got %v", got)
+	}
+
+	// Averaged samples report the highest level
+	nominal, heavy := 0.0, 2.0
+	average := averagePowermetricsSamples([]*PowermetricsSample{{ThermalPressure: &heavy}, {ThermalPressure: &nominal}})
+	if average.ThermalPressure == nil || *average.ThermalPressure != 2 {
+		t.Errorf("Expected the heavy level 2, got %v", average.ThermalPressure)
+	}
+}
+
+func TestScanPowermetricsSamples(t *testing.T) {
+	data, err := os.ReadFile("testdata/powermetrics_apple_silicon.txt")
+	if err != nil {
+		t.Fatalf("Failed to read fixture: %v", err)
+	}
+	// Simulate a stream: preamble, then the same sample twice
+	text := string(data)
+	sample := text[strings.Index(text, sampleHeader):]
+	stream := text + "\n" + sample
+
+	var samples []*PowermetricsSample
+	err = scanPowermetricsSamples(strings.NewReader(stream), true, func(text string) {
+		if !strings.HasPrefix(text, sampleHeader) {
+			t.Errorf("Expected sample to start with header, got %q", text[:40])
+		}
+		samples = append(samples, parsePowermetrics(strings.NewReader(text), 0))
+	})
+	if err != nil {
+		t.Fatalf("scanPowermetricsSamples returned error: %v", err)
+	}
+
+	if len(samples) != 2 {
+		t.Fatalf("Expected 2 samples, got %d", len(samples))
+	}
+	for i, s := range samples {
+		if s.FieldsParsed != 33 {
+			t.Errorf("Sample %d: expected 33 fields parsed, got %d", i, s.FieldsParsed)
+		}
+		if s.CPUPower == nil || *s.CPUPower != 453 {
+			t.Errorf("Sample %d: expected CPU power 453, got %v", i, s.CPUPower)
+		}
+	}
+
+	// A stream cut off within its last sample drops it
+	cut := stream[:len(stream)-len(sample)/2]
+	count := 0
+	if err := scanPowermetricsSamples(strings.NewReader(cut), false, func(string) { count++ }); err != nil {
+		t.Fatalf("scanPowermetricsSamples returned error: %v", err)
+	}
+	if count != 1 {
+		t.Errorf("Expected only the complete sample, got %d", count)
+	}
+}
+
+func TestPowermetricsAverageWindow(t *testing.T) {
+	cfg := config.New()
+	cfg.PowermetricsMode = config.PowermetricsModeBackground
+	cfg.PowermetricsInterval = time.Second
+	cfg.PowermetricsAverageWindow = 3 * time.Second
+	collector := NewPowermetricsCollector(cfg)
+
+	// Four samples into a three-sample window: the first one falls out
+	for _, power := range []float64{1000, 100, 200, 600} {
+		power := power
+		collector.record(&PowermetricsSample{
+			CPUPower:           &power,
+			CPUFrequency:       map[string]float64{"cpu0": power * 1e6},
+			CPUActiveResidency: map[string]float64{},
+			CPUIdleResidency:   map[string]float64{},
+			CPUType:            map[string]string{"cpu0": "E"},
+		})
+	}
+
+	values := gatherValues(t, collector)
+	expected := map[string]float64{
+		"powermetrics_cpu_power_milliwatts":                          600,
+		"powermetrics_cpu_power_milliwatts_avg":                      300,
+		`powermetrics_cpu_frequency_hertz{core="cpu0",type="E"}`:     600e6,
+		`powermetrics_cpu_frequency_hertz_avg{core="cpu0",type="E"}`: 300e6,
+	}
+	for key, want := range expected {
+		got, ok := values[key]
+		if !ok {
+			t.Errorf("Expected metric %s not found", key)
+			continue
+		}
+		if got != want {
+			t.Errorf("%s: expected %v, got %v", key, want, got)
+		}
+	}
+	if _, ok := values[`powermetrics_gpu_power_milliwatts_avg{gpu="integrated",gpu_index="0"}`]; ok {
+		t.Error("Expected no GPU power average when no sample has GPU power")
+	}
+}
+
+func TestPowermetricsAverageDisabledByDefault(t *testing.T) {
+	cfg := config.New()
+	cfg.PowermetricsMode = config.PowermetricsModeBackground
+	collector := NewPowermetricsCollector(cfg)
+
+	power := 500.0
+	collector.record(&PowermetricsSample{CPUPower: &power})
+
+	values := gatherValues(t, collector)
+	if _, ok := values["powermetrics_cpu_power_milliwatts_avg"]; ok {
+		t.Error("Expected no averaged metrics without an average window")
+	}
+	if values["powermetrics_cpu_power_milliwatts"] != 500 {
+		t.Errorf("Expected instantaneous CPU power 500, got %v", values["powermetrics_cpu_power_milliwatts"])
+	}
+}
+
+func TestPowermetricsNamespace(t *testing.T) {
+	cfg := config.New()
+	cfg.Namespace = "myorg"
+	cfg.PowermetricsMode = config.PowermetricsModeBackground
+	collector := NewPowermetricsCollector(cfg)
+
+	power := 500.0
+	collector.record(&PowermetricsSample{CPUPower: &power})
+
+	values := gatherValues(t, collector)
+	if values["myorg_powermetrics_cpu_power_milliwatts"] != 500 {
+		t.Errorf("Expected namespaced CPU power metric, got %v", values)
+	}
+}
+
+func TestPowermetricsFrequencyUnit(t *testing.T) {
+	cfg := config.New()
+	cfg.FrequencyUnit = config.FrequencyUnitMegahertz
+	cfg.PowermetricsMode = config.PowermetricsModeBackground
+	collector := NewPowermetricsCollector(cfg)
+
+	collector.record(&PowermetricsSample{
+		CPUFrequency: map[string]float64{"cpu0": 1320e6},
+		CPUType:      map[string]string{"cpu0": "E"},
+	})
+
+	values := gatherValues(t, collector)
+	if got := values[`powermetrics_cpu_frequency_megahertz{core="cpu0",type="E"}`]; got != 1320 {
+		t.Errorf("Expected the frequency in MHz, got %v", values)
+	}
+	if _, ok := values[`powermetrics_cpu_frequency_hertz{core="cpu0",type="E"}`]; ok {
+		t.Error("Expected no Hertz metric with the Megahertz unit")
+	}
+}
+
+func TestPowermetricsPowerSource(t *testing.T) {
+	cfg := config.New()
+	cfg.PowerSource = config.PowerSourceMacmon
+	cfg.PowermetricsInputFile = "testdata/powermetrics_apple_silicon.txt"
+
+	values := gatherValues(t, NewPowermetricsCollector(cfg))
+	for _, key := range []string{"powermetrics_cpu_power_milliwatts", `powermetrics_gpu_power_milliwatts{gpu="integrated",gpu_index="0"}`, "powermetrics_combined_power_milliwatts"} {
+		if _, ok := values[key]; ok {
+			t.Errorf("Expected %s to be left to macmon", key)
+		}
+	}
+	if _, ok := values[`powermetrics_cpu_frequency_hertz{core="cpu0",type="E"}`]; !ok {
+		t.Error("Expected the non-power metrics to be kept")
+	}
+}
+
+func TestPowermetricsPowerSourceDerived(t *testing.T) {
+	cfg := config.New()
+	cfg.PowerSource = config.PowerSourceMacmon
+	cfg.PowermetricsMode = config.PowermetricsModeBackground
+	cfg.PowerSummaries = true
+	cfg.SamplesPerScrape = 2
+	collector := NewPowermetricsCollector(cfg)
+
+	power, measured := 500.0, 900.0
+	collector.record(&PowermetricsSample{
+		CPUPower:      &power,
+		CPUPowerMin:   &power,
+		CPUPowerMax:   &power,
+		GPUPower:      &power,
+		GPUPowerMin:   &power,
+		GPUPowerMax:   &power,
+		CombinedPower: &power,
+		MeasuredPower: &measured,
+	})
+
+	for name := range gatherValues(t, collector) {
+		if strings.Contains(name, "_power_") {
+			t.Errorf("Expected %s to be left to macmon", name)
+		}
+	}
+}
+
+func TestPowermetricsConstLabels(t *testing.T) {
+	cfg := config.New()
+	cfg.ConstLabels = map[string]string{"host": "studio-1"}
+	cfg.PowermetricsMode = config.PowermetricsModeBackground
+	collector := NewPowermetricsCollector(cfg)
+
+	power := 500.0
+	collector.record(&PowermetricsSample{
+		CPUPower:     &power,
+		CPUFrequency: map[string]float64{"cpu0": 1e9},
+		CPUType:      map[string]string{"cpu0": "E"},
+	})
+
+	values := gatherValues(t, collector)
+	for _, key := range []string{
+		`powermetrics_cpu_power_milliwatts{host="studio-1"}`,
+		`powermetrics_cpu_frequency_hertz{core="cpu0",host="studio-1",type="E"}`,
+		`powermetrics_up{host="studio-1"}`,
+	} {
+		if _, ok := values[key]; !ok {
+			t.Errorf("Expected metric %s, got %v", key, values)
+		}
+	}
+}
+
+func TestPowermetricsEmptyOutputIsAFailure(t *testing.T) {
+	collector := NewPowermetricsCollector(config.New())
+
+	for name, out := range map[string]string{
+		"empty":       "",
+		"header only": "Machine model: Mac14,2\nOS version: 23F79\nBoot arguments:\n",
+	} {
+		t.Run(name, func(t *testing.T) {
+			ch := make(chan prometheus.Metric, 10)
+			collector.collectOutput(context.Background(), ch, []byte(out))
+			close(ch)
+
+			var metrics []prometheus.Metric
+			for m := range ch {
+				metrics = append(metrics, m)
+			}
+			if len(metrics) != 1 {
+				t.Fatalf("Expected only the up metric, got %d metrics", len(metrics))
+			}
+			if metrics[0].Desc() != collector.up {
+				t.Fatalf("Expected the up metric, got %v", metrics[0].Desc())
+			}
+			var m dto.Metric
+			if err := metrics[0].Write(&m); err != nil {
+				t.Fatalf("Failed to read metric: %v", err)
+			}
+			if m.GetGauge().GetValue() != 0 {
+				t.Errorf("Expected up=0 for %s output, got %v", name, m.GetGauge().GetValue())
+			}
+		})
+	}
+}
+
+func TestPowermetricsSampleIsASuccess(t *testing.T) {
+	collector := NewPowermetricsCollector(config.New())
+	out, err := os.ReadFile("testdata/powermetrics_apple_silicon.txt")
+	if err != nil {
+		t.Fatalf("Failed to read fixture: %v", err)
+	}
+
+	ch := make(chan prometheus.Metric, 100)
+	collector.collectOutput(context.Background(), ch, out)
+	close(ch)
+
+	up := -1.0
+	for metric := range ch {
+		if metric.Desc() == collector.up {
+			var m dto.Metric
+			if err := metric.Write(&m); err != nil {
+				t.Fatalf("Failed to read metric: %v", err)
+			}
+			up = m.GetGauge().GetValue()
+		}
+	}
+	if up != 1 {
+		t.Errorf("Expected up=1 for a sample, got %v", up)
+	}
+}
+
+func TestPowermetricsSamplesPerScrape(t *testing.T) {
+	data, err := os.ReadFile("testdata/powermetrics_apple_silicon.txt")
+	if err != nil {
+		t.Fatalf("Failed to read fixture: %v", err)
+	}
+	// The output of powermetrics -n 2: preamble, then two samples
+	text := string(data)
+	second := strings.NewReplacer(
+		"CPU Power: 453 mW", "CPU Power: 553 mW",
+		"(Mon Jun  3 14:20:05 2024 +0200)", "(Mon Jun  3 14:20:06 2024 +0200)",
+	).Replace(text[strings.Index(text, sampleHeader):])
+	path := filepath.Join(t.TempDir(), "powermetrics.txt")
+	if err := os.WriteFile(path, []byte(text+second), 0o644); err != nil {
+		t.Fatalf("Failed to write input file: %v", err)
+	}
+
+	cfg := config.New()
+	cfg.SamplesPerScrape = 2
+	cfg.PowermetricsInputFile = path
+	values := gatherValues(t, NewPowermetricsCollector(cfg))
+
+	expected := map[string]float64{
+		"powermetrics_cpu_power_milliwatts":                                 503,
+		"powermetrics_cpu_power_milliwatts_min":                             453,
+		"powermetrics_cpu_power_milliwatts_max":                             553,
+		"powermetrics_gpu_power_milliwatts_min":                             12,
+		"powermetrics_gpu_power_milliwatts_max":                             12,
+		`powermetrics_gpu_power_milliwatts{gpu="integrated",gpu_index="0"}`: 12,
+		`powermetrics_cpu_frequency_hertz{core="cpu0",type="E"}`:            1320e6,
+		"powermetrics_last_sample_timestamp_seconds":                        1717417206,
+		"powermetrics_up": 1,
+	}
+	for key, want := range expected {
+		if got, ok := values[key]; !ok || got != want {
+			t.Errorf("%s: expected %v, got %v (present=%v)", key, want, got, ok)
+		}
+	}
+}
+
+func TestPowermetricsDiscardFirstSamples(t *testing.T) {
+	data, err := os.ReadFile("testdata/powermetrics_apple_silicon.txt")
+	if err != nil {
+		t.Fatalf("Failed to read fixture: %v", err)
+	}
+	// The output of powermetrics -n 2, whose first sample is discarded
+	text := string(data)
+	second := strings.NewReplacer(
+		"CPU Power: 453 mW", "CPU Power: 553 mW",
+	).Replace(text[strings.Index(text, sampleHeader):])
+	path := filepath.Join(t.TempDir(), "powermetrics.txt")
+	if err := os.WriteFile(path, []byte(text+second), 0o644); err != nil {
+		t.Fatalf("Failed to write input file: %v", err)
+	}
+
+	cfg := config.New()
+	cfg.DiscardFirstSamples = 1
+	cfg.PowermetricsInputFile = path
+	values := gatherValues(t, NewPowermetricsCollector(cfg))
+
+	if got := values["powermetrics_cpu_power_milliwatts"]; got != 553 {
+		t.Errorf("Expected the second sample's CPU power 553, got %v", got)
+	}
+	if _, ok := values["powermetrics_cpu_power_milliwatts_min"]; ok {
+		t.Error("Expected no min/max gauges for a single kept sample")
+	}
+}
+
+func TestParsePowermetricsMaxScanLines(t *testing.T) {
+	f, err := os.Open("testdata/powermetrics_apple_silicon.txt")
+	if err != nil {
+		t.Fatalf("Failed to open fixture: %v", err)
+	}
+	defer f.Close()
+
+	// The limit ends the scan inside the E-Cluster, after CPU 0 and CPU 1
+	sample := parsePowermetrics(f, 20)
+
+	if !sample.Truncated {
+		t.Error("Expected sample to be marked truncated")
+	}
+	if sample.LinesTotal != 20 {
+		t.Errorf("Expected 20 lines scanned, got %d", sample.LinesTotal)
+	}
+	if len(sample.CPUFrequency) != 2 {
+		t.Errorf("Expected frequencies for 2 cores before the limit, got %v", sample.CPUFrequency)
+	}
+	if sample.CPUPower != nil {
+		t.Error("Expected CPU power after the limit to be ignored")
+	}
+}
+
+func TestPowermetricsPowerModelError(t *testing.T) {
+	pm, err := os.Open("testdata/powermetrics_apple_silicon.txt")
+	if err != nil {
+		t.Fatalf("Failed to open fixture: %v", err)
+	}
+	defer pm.Close()
+	smc, err := os.Open("testdata/smc_zones.txt")
+	if err != nil {
+		t.Fatalf("Failed to open fixture: %v", err)
+	}
+	defer smc.Close()
+
+	sample := parsePowermetrics(pm, 0)
+	sample.MeasuredPower = smcSystemPower(parseSMCKeys(smc))
+
+	cfg := config.New()
+	cfg.PowermetricsMode = config.PowermetricsModeBackground
+	collector := NewPowermetricsCollector(cfg)
+	collector.record(sample)
+
+	// PSTR 5.25 W measured, 465 mW modeled
+	values := gatherValues(t, collector)
+	if got := values["powermetrics_power_model_error_milliwatts"]; got != 4785 {
+		t.Errorf("Expected model error 4785 mW, got %v", got)
+	}
+
+	// Without a measured figure the error is not emitted
+	sample.MeasuredPower = nil
+	collector.record(sample)
+	if _, ok := gatherValues(t, collector)["powermetrics_power_model_error_milliwatts"]; ok {
+		t.Error("Expected no model error without measured power")
+	}
+}
+
+func TestPowermetricsInputFileSkipsSMC(t *testing.T) {
+	smc, err := os.ReadFile("testdata/smc_zones.txt")
+	if err != nil {
+		t.Fatalf("Failed to read fixture: %v", err)
+	}
+	cfg := config.New()
+	cfg.PowermetricsInputFile = "testdata/powermetrics_apple_silicon.txt"
+	collector := NewPowermetricsCollector(cfg)
+	collector.smcAvailable = true
+	collector.runner = fakeRunner{smcCommand: {stdout: string(smc)}}
+
+	values := gatherValues(t, collector)
+	if _, ok := values["powermetrics_power_model_error_milliwatts"]; ok {
+		t.Error("Expected no model error against the live SMC for a replayed file")
+	}
+	if got := values["powermetrics_up"]; got != 1 {
+		t.Errorf("Expected the replayed file to be collected, got %v", values)
+	}
+}
+
+func TestParsePowermetricsGPUEngines(t *testing.T) {
+	input := `**** GPU usage ****
+
+GPU HW active frequency: 444 MHz
+GPU HW active residency:   3.10% (389 MHz: 3.1% 486 MHz:   0%)
+GPU render active residency:   2.40%
+GPU compute active residency:   0.70%
+GPU idle residency:  96.90%
+`
+	sample := parsePowermetrics(strings.NewReader(input), 0)
+
+	if sample.GPUActiveResidency == nil || *sample.GPUActiveResidency != 3.10 {
+		t.Errorf("Expected the aggregate GPU residency to stay 3.10, got %v", sample.GPUActiveResidency)
+	}
+	expected := map[string]float64{"render": 2.40, "compute": 0.70}
+	if len(sample.GPUEngineActiveResidency) != len(expected) {
+		t.Errorf("Expected engines %v, got %v", expected, sample.GPUEngineActiveResidency)
+	}
+	for engine, residency := range expected {
+		if got := sample.GPUEngineActiveResidency[engine]; got != residency {
+			t.Errorf("Engine %s: expected %v, got %v", engine, residency, got)
+		}
+	}
+}
+
+func TestParsePowermetricsMultipleGPUs(t *testing.T) {
+	// A Mac Pro with two discrete GPUs and no integrated one
+	out := `*** Sampled system activity (Mon Jun  3 14:20:05 2024 +0200) (1003.56ms elapsed) ***
+
+**** GPU usage ****
+
+GPU 0 (AMD Radeon Pro W6800X):
+GPU HW active residency:  10.00%
+GPU idle residency:  90.00%
+GPU Power: 4000 mW
+
+GPU 1 (AMD Radeon Pro W6800X):
+GPU HW active residency:  30.00%
+GPU idle residency:  70.00%
+GPU Power: 9000 mW
+`
+	cfg := config.New()
+	path := filepath.Join(t.TempDir(), "powermetrics.txt")
+	if err := os.WriteFile(path, []byte(out), 0o644); err != nil {
+		t.Fatalf("Failed to write input file: %v", err)
+	}
+	cfg.PowermetricsInputFile = path
+	values := gatherValues(t, NewPowermetricsCollector(cfg))
+
+	expected := map[string]float64{
+		`powermetrics_gpu_power_milliwatts{gpu="discrete",gpu_index="0"}`:         4000,
+		`powermetrics_gpu_power_milliwatts{gpu="discrete",gpu_index="1"}`:         9000,
+		`powermetrics_gpu_active_residency_percent{gpu="discrete",gpu_index="0"}`: 10,
+		`powermetrics_gpu_active_residency_percent{gpu="discrete",gpu_index="1"}`: 30,
+		`powermetrics_gpu_idle_residency_percent{gpu="discrete",gpu_index="0"}`:   90,
+		`powermetrics_gpu_idle_residency_percent{gpu="discrete",gpu_index="1"}`:   70,
+	}
+	for key, want := range expected {
+		if got, ok := values[key]; !ok || got != want {
+			t.Errorf("%s: expected %v, got %v (present=%v)", key, want, got, ok)
+		}
+	}
+	if _, ok := values[`powermetrics_gpu_power_milliwatts{gpu="integrated",gpu_index="0"}`]; ok {
+		t.Error("Expected no integrated GPU")
+	}
+}
+
+func TestParsePowermetricsDownResidency(t *testing.T) {
+	input := `P0-Cluster HW active frequency: 1020 MHz
+CPU 4 frequency: 3204 MHz
+CPU 4 active residency:   4.10% (3204 MHz: 4.1%)
+CPU 4 idle residency:  60.70%
+CPU 4 down residency:  35.20%
+CPU 5 frequency: 3204 MHz
+CPU 5 active residency:   0.00% (3204 MHz:   0%)
+CPU 5 idle residency:   0.00%
+CPU 5 down residency: 100.00%
+`
+	sample := parsePowermetrics(strings.NewReader(input), 0)
+
+	expected := map[string]float64{"cpu4": 35.20, "cpu5": 100}
+	if len(sample.CPUDownResidency) != len(expected) {
+		t.Errorf("Expected down residency %v, got %v", expected, sample.CPUDownResidency)
+	}
+	for core, residency := range expected {
+		if got := sample.CPUDownResidency[core]; got != residency {
+			t.Errorf("Core %s: expected %v, got %v", core, residency, got)
+		}
+	}
+	// The down residency line must not be taken for the idle residency
+	if got := sample.CPUIdleResidency["cpu4"]; got != 60.70 {
+		t.Errorf("Expected idle residency 60.70 for cpu4, got %v", got)
+	}
+}
+
+func TestPowermetricsANEUsage(t *testing.T) {
+	input := "*** Sampled system activity (Mon Jun  3 14:05:12 2024 +0800) (1004.12ms elapsed) ***\n" +
+		"ANE Power: 120 mW\n" +
+		"ANE HW active residency:   1.20%\n"
+	sample := parsePowermetrics(strings.NewReader(input), 0)
+	if sample.ANEActiveResidency == nil || *sample.ANEActiveResidency != 1.20 {
+		t.Fatalf("Expected ANE residency 1.20, got %v", sample.ANEActiveResidency)
+	}
+
+	cfg := config.New()
+	cfg.PowermetricsMode = config.PowermetricsModeBackground
+	collector := NewPowermetricsCollector(cfg)
+	collector.record(sample)
+	if got := gatherValues(t, collector)["powermetrics_ane_usage_percent"]; got != 1.20 {
+		t.Errorf("Expected ANE usage gauge 1.20, got %v", got)
+	}
+
+	// The utilization summary doesn't change the type of the gauge
+	cfg.UtilizationSummaries = true
+	collector = NewPowermetricsCollector(cfg)
+	collector.record(sample)
+	if got := gatherValues(t, collector)["powermetrics_ane_usage_percent"]; got != 1.20 {
+		t.Errorf("Expected ANE usage gauge 1.20 next to the summary, got %v", got)
+	}
+}
+
+func TestOnlineCores(t *testing.T) {
+	// cpu2 is parked and cpu3 powered down for the whole sample
+	sample := &PowermetricsSample{CPUActiveResidency: map[string]float64{"cpu0": 27.65, "cpu1": 0.24, "cpu2": 0, "cpu3": 0}}
+	if online, ok := onlineCores(sample); !ok || online != 2 {
+		t.Errorf("Expected 2 online cores, got %v (ok=%v)", online, ok)
+	}
+	if _, ok := onlineCores(&PowermetricsSample{}); ok {
+		t.Error("Expected no online core count without per-core residency")
+	}
+}
+
+func TestParsePowermetricsWakeups(t *testing.T) {
+	f, err := os.Open("testdata/powermetrics_tasks.txt")
+	if err != nil {
+		t.Fatalf("Failed to open fixture: %v", err)
+	}
+	defer f.Close()
+
+	sample := parsePowermetrics(f, 0)
+	if sample.InterruptWakeups == nil || *sample.InterruptWakeups != 902.01 {
+		t.Errorf("Expected 902.01 interrupt wakeups, got %v", sample.InterruptWakeups)
+	}
+	if sample.IdleWakeups == nil || *sample.IdleWakeups != 96.61 {
+		t.Errorf("Expected 96.61 idle wakeups, got %v", sample.IdleWakeups)
+	}
+
+	// Output without the tasks sampler reports no wakeups
+	sample = parsePowermetrics(strings.NewReader("CPU Power: 1339 mW\n"), 0)
+	if sample.InterruptWakeups != nil || sample.IdleWakeups != nil {
+		t.Errorf("Expected no wakeups without a tasks table, got %v and %v", sample.InterruptWakeups, sample.IdleWakeups)
+	}
+}
+
+func TestIsPermissionError(t *testing.T) {
+	tests := []struct {
+		stderr string
+		want   bool
+	}{
+		{stderr: "powermetrics must be invoked as the superuser\n", want: true},
+		{stderr: "powermetrics: Operation not permitted", want: true},
+		{stderr: "powermetrics: unrecognized sampler: gpu", want: false},
+		{stderr: "", want: false},
+	}
+
+	for _, tt := range tests {
+		if got := isPermissionError(tt.stderr); got != tt.want {
+			t.Errorf("isPermissionError(%q): expected %v, got %v", tt.stderr, tt.want, got)
+		}
+	}
+}
+
+func TestPowermetricsPermissionErrorGauge(t *testing.T) {
+	collector := NewPowermetricsCollector(config.New())
+
+	collector.checkPermission(errors.New("exit status 1"), "powermetrics must be invoked as the superuser")
+	if !collector.permissionDenied.Load() {
+		t.Error("Expected a permission error to be recorded")
+	}
+
+	// A later successful run clears it
+	collector.checkPermission(nil, "")
+	if collector.permissionDenied.Load() {
+		t.Error("Expected a successful run to clear the permission error")
+	}
+}
+
+func TestPowermetricsScrape(t *testing.T) {
+	data, err := os.ReadFile("testdata/powermetrics_apple_silicon.txt")
+	if err != nil {
+		t.Fatalf("Failed to read fixture: %v", err)
+	}
+	command := "powermetrics --samplers cpu_power,gpu_power,thermal -i 1000 -n 1"
+
+	tests := []struct {
+		name     string
+		runner   fakeRunner
+		expected map[string]float64
+	}{
+		{
+			name:   "sample",
+			runner: fakeRunner{command: {stdout: string(data)}},
+			expected: map[string]float64{
+				"powermetrics_up":                        1,
+				"powermetrics_cpu_power_milliwatts":      453,
+				"powermetrics_exporter_permission_error": 0,
+				"powermetrics_exporter_last_error_type":  float64(commandErrorNone),
+			},
+		},
+		{
+			name:   "not root",
+			runner: fakeRunner{command: {stderr: "powermetrics must be invoked as the superuser"}},
+			expected: map[string]float64{
+				"powermetrics_up":                        0,
+				"powermetrics_exporter_permission_error": 1,
+				"powermetrics_exporter_last_error_type":  float64(commandErrorPermission),
+			},
+		},
+		{
+			name:   "not installed",
+			runner: fakeRunner{},
+			expected: map[string]float64{
+				"powermetrics_up":                       0,
+				"powermetrics_exporter_last_error_type": float64(commandErrorNotFound),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			collector := NewPowermetricsCollector(config.New())
+			collector.runner = tt.runner
+
+			values := gatherValues(t, collector)
+			for key, want := range tt.expected {
+				if got, ok := values[key]; !ok || got != want {
+					t.Errorf("%s: expected %v, got %v (present=%v)", key, want, got, ok)
+				}
+			}
+		})
+	}
+}
+
+func TestPowermetricsScrapeOverrun(t *testing.T) {
+	tests := []struct {
+		name     string
+		interval time.Duration
+		overrun  float64
+		present  bool
+	}{
+		{name: "within interval", interval: time.Hour, overrun: 0, present: true},
+		{name: "overrun", interval: time.Nanosecond, overrun: 1, present: true},
+		{name: "check disabled", interval: 0, present: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := config.New()
+			cfg.PowermetricsInputFile = "testdata/powermetrics_apple_silicon.txt"
+			cfg.ExpectedScrapeInterval = tt.interval
+
+			values := gatherValues(t, NewPowermetricsCollector(cfg))
+			if got, ok := values["powermetrics_exporter_last_scrape_seconds"]; !ok || got <= 0 {
+				t.Errorf("Expected a positive scrape duration, got %v (present=%v)", got, ok)
+			}
+			got, ok := values["powermetrics_exporter_scrape_overrun"]
+			if ok != tt.present || got != tt.overrun {
+				t.Errorf("Expected overrun %v (present=%v), got %v (present=%v)", tt.overrun, tt.present, got, ok)
+			}
+		})
+	}
+}
+
+func TestPowermetricsScrapeOverrunDefaults(t *testing.T) {
+	cfg := config.New()
+	if cfg.ScrapeTimeout >= cfg.ExpectedScrapeInterval {
+		t.Fatalf("Expected the default timeout %v below the default interval %v", cfg.ScrapeTimeout, cfg.ExpectedScrapeInterval)
+	}
+	collector := NewPowermetricsCollector(cfg)
+
+	tests := []struct {
+		name    string
+		elapsed time.Duration
+		overrun float64
+	}{
+		{name: "one sample", elapsed: time.Second, overrun: 0},
+		{name: "killed at the timeout", elapsed: cfg.ScrapeTimeout, overrun: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ch := make(chan prometheus.Metric, 2)
+			collector.emitScrapeDuration(ch, tt.elapsed)
+			close(ch)
+			var overrun *float64
+			for m := range ch {
+				if m.Desc() != collector.scrapeOverrun {
+					continue
+				}
+				var metric dto.Metric
+				if err := m.Write(&metric); err != nil {
+					t.Fatalf("Failed to write metric: %v", err)
+				}
+				value := metric.GetGauge().GetValue()
+				overrun = &value
+			}
+			if overrun == nil || *overrun != tt.overrun {
+				t.Errorf("Expected overrun %v, got %v", tt.overrun, overrun)
+			}
+		})
+	}
+}
+
+func TestPowermetricsInputFile(t *testing.T) {
+	cfg := config.New()
+	cfg.PowermetricsInputFile = "testdata/powermetrics_apple_silicon.txt"
+
+	values := gatherValues(t, NewPowermetricsCollector(cfg))
+	if values["powermetrics_up"] != 1 {
+		t.Errorf("Expected up=1 from the input file, got %v", values["powermetrics_up"])
+	}
+	if values["powermetrics_cpu_power_milliwatts"] != 453 {
+		t.Errorf("Expected CPU power 453 from the input file, got %v", values["powermetrics_cpu_power_milliwatts"])
+	}
+
+	cfg.PowermetricsInputFile = "testdata/missing.txt"
+	if up := gatherValues(t, NewPowermetricsCollector(cfg))["powermetrics_up"]; up != 0 {
+		t.Errorf("Expected up=0 for a missing input file, got %v", up)
+	}
+}
+
+func TestPowermetricsSampleTimestamps(t *testing.T) {
+	taken := time.Date(2024, 6, 3, 14, 5, 12, 0, time.UTC)
+	power := 500.0
+
+	cfg := config.New()
+	cfg.PowermetricsMode = config.PowermetricsModeBackground
+	cfg.PowermetricsAverageWindow = time.Minute
+	background := NewPowermetricsCollector(cfg)
+	background.record(&PowermetricsSample{CPUPower: &power, Timestamp: taken})
+
+	stamps := gatherTimestamps(t, background)
+	for _, name := range []string{"powermetrics_cpu_power_milliwatts", "powermetrics_cpu_power_milliwatts_avg"} {
+		if got := stamps[name]; got != taken.UnixMilli() {
+			t.Errorf("%s: expected the sample timestamp %d, got %d", name, taken.UnixMilli(), got)
+		}
+	}
+	if got, ok := stamps["powermetrics_up"]; !ok || got != 0 {
+		t.Errorf("Expected powermetrics_up at the scrape time, got timestamp %d", got)
+	}
+
+	// Scrape mode metrics keep the scrape time
+	cfg = config.New()
+	cfg.PowermetricsInputFile = "testdata/powermetrics_apple_silicon.txt"
+	if got := gatherTimestamps(t, NewPowermetricsCollector(cfg))["powermetrics_cpu_power_milliwatts"]; got != 0 {
+		t.Errorf("Expected no timestamp in scrape mode, got %d", got)
+	}
+}
+
+// gatherTimestamps collects c and returns the explicit timestamp in
+// milliseconds of the first metric of each family, 0 when there is none
+func gatherTimestamps(t *testing.T, c prometheus.Collector) map[string]int64 {
+	t.Helper()
+
+	reg := prometheus.NewPedanticRegistry()
+	reg.MustRegister(c)
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatalf("Failed to gather metrics: %v", err)
+	}
+	stamps := make(map[string]int64)
+	for _, family := range families {
+		stamps[family.GetName()] = family.GetMetric()[0].GetTimestampMs()
+	}
+	return stamps
+}
+
+func TestPowermetricsCombinedPower(t *testing.T) {
+	cfg := config.New()
+	cfg.PowermetricsInputFile = "testdata/powermetrics_apple_silicon.txt"
+
+	// Combined Power (CPU + GPU + ANE): 465 mW
+	values := gatherValues(t, NewPowermetricsCollector(cfg))
+	if got := values["powermetrics_combined_power_milliwatts"]; got != 465 {
+		t.Errorf("Expected combined power 465, got %v", got)
+	}
+}
@@ -0,0 +1,41 @@
+package collector
+
+import (
+	"sync"
+	"time"
+)
+
+// counterRate turns successive readings of a monotonic counter into a
+// per-second rate
+type counterRate struct {
+	mu       sync.Mutex
+	last     float64
+	lastTime time.Time
+	primed   bool
+}
+
+// update records value observed at now and returns the rate since the
+// previous reading. It reports false for the first reading and whenever no
+// time has elapsed. A value lower than the previous one is treated as a
+// counter reset, in which case the counter is assumed to have restarted at 0.
+func (r *counterRate) update(value float64, now time.Time) (float64, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	last, lastTime, primed := r.last, r.lastTime, r.primed
+	r.last, r.lastTime, r.primed = value, now, true
+	if !primed {
+		return 0, false
+	}
+
+	elapsed := now.Sub(lastTime).Seconds()
+	if elapsed <= 0 {
+		return 0, false
+	}
+
+	delta := value - last
+	if delta < 0 {
+		delta = value
+	}
+	return delta / elapsed, true
+}
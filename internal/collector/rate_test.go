@@ -0,0 +1,37 @@
+package collector
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCounterRatePageInBytes(t *testing.T) {
+	const pageSize = 16384
+	var rate counterRate
+	start := time.Unix(1700000000, 0)
+
+	steps := []struct {
+		pageIns  float64
+		offset   time.Duration
+		expected float64
+		ok       bool
+	}{
+		{pageIns: 1000, offset: 0, ok: false},
+		{pageIns: 1100, offset: 10 * time.Second, expected: 10 * pageSize, ok: true},
+		{pageIns: 1400, offset: 20 * time.Second, expected: 30 * pageSize, ok: true},
+		// counter reset: assume it restarted at zero
+		{pageIns: 50, offset: 30 * time.Second, expected: 5 * pageSize, ok: true},
+		// no time elapsed
+		{pageIns: 60, offset: 30 * time.Second, ok: false},
+	}
+
+	for i, step := range steps {
+		got, ok := rate.update(step.pageIns, start.Add(step.offset))
+		if ok != step.ok {
+			t.Fatalf("Step %d: expected ok=%v, got %v", i, step.ok, ok)
+		}
+		if ok && got*pageSize != step.expected {
+			t.Errorf("Step %d: expected %v bytes/sec, got %v", i, step.expected, got*pageSize)
+		}
+	}
+}
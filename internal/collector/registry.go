@@ -0,0 +1,76 @@
+package collector
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	"mac-powermetrics-exporter/internal/config"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Factory builds a collector from the configuration
+type Factory func(cfg *config.Config) prometheus.Collector
+
+// Registration describes a collector that can be enabled by name
+type Registration struct {
+	// Factory builds the collector
+	Factory Factory
+	// Binary is the command the collector shells out to, checked at startup.
+	// Empty when the collector runs no command.
+	Binary string
+}
+
+// registrations holds every collector registered by an init function
+var registrations = make(map[string]Registration)
+
+// Register makes a collector available under name. It is meant to be called
+// from the init function of the collector's file and panics on duplicate names.
+func Register(name, binary string, factory Factory) {
+	if _, ok := registrations[name]; ok {
+		panic(fmt.Sprintf("collector %q registered twice", name))
+	}
+	registrations[name] = Registration{Factory: factory, Binary: binary}
+}
+
+// Lookup returns the collector registered under name
+func Lookup(name string) (Registration, bool) {
+	r, ok := registrations[name]
+	return r, ok
+}
+
+// Names returns the sorted names of all registered collectors
+func Names() []string {
+	names := make([]string, 0, len(registrations))
+	for name := range registrations {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// metaMetrics are the metrics collectors report even when their commands
+// fail, by name without the namespace. They describe the collector itself
+// rather than the host.
+var metaMetrics = []string{
+	"ioreg_up",
+	"macmon_parse_errors_total",
+	"powermetrics_exporter_last_error_type",
+	"powermetrics_exporter_last_scrape_seconds",
+	"powermetrics_exporter_permission_error",
+	"powermetrics_exporter_scrape_overrun",
+	"powermetrics_sampler_available",
+	"powermetrics_up",
+	"vmstat_page_size_bytes",
+}
+
+// IsMetaMetric reports whether the named metric is one a collector reports
+// even when its commands fail, so it is no sign that the collector works
+func IsMetaMetric(cfg *config.Config, name string) bool {
+	if cfg.Namespace != "" {
+		name = strings.TrimPrefix(name, cfg.Namespace+"_")
+	}
+	return slices.Contains(metaMetrics, name)
+}
@@ -0,0 +1,49 @@
+package collector
+
+import (
+	"sort"
+	"strings"
+	"testing"
+
+	"mac-powermetrics-exporter/internal/config"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestRegistryHasDefaultCollectors(t *testing.T) {
+	for _, name := range config.New().EnabledCollectors {
+		if _, ok := Lookup(name); !ok {
+			t.Errorf("Default collector %q is not registered", name)
+		}
+	}
+
+	names := Names()
+	if !sort.StringsAreSorted(names) {
+		t.Errorf("Expected sorted names, got %v", names)
+	}
+}
+
+func TestRegisterDuplicatePanics(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("Expected registering a duplicate name to panic")
+		}
+	}()
+	Register("vmstat", "vm_stat", nil)
+}
+
+func TestNoNodeExporterMetricNames(t *testing.T) {
+	// The textfile output is merged into node_exporter, which rejects metric
+	// names it exports itself
+	for _, name := range Names() {
+		registration, _ := Lookup(name)
+		ch := make(chan *prometheus.Desc, 256)
+		registration.Factory(config.New()).Describe(ch)
+		close(ch)
+		for desc := range ch {
+			if strings.Contains(desc.String(), `fqName: "node_`) {
+				t.Errorf("Collector %s describes a node_exporter metric name: %s", name, desc)
+			}
+		}
+	}
+}
@@ -0,0 +1,183 @@
+package collector
+
+import "sync"
+
+// sampleRing keeps the most recent powermetrics samples up to a fixed size
+type sampleRing struct {
+	mu      sync.Mutex
+	samples []*PowermetricsSample
+	next    int
+	full    bool
+}
+
+// newSampleRing creates a ring holding at most size samples
+func newSampleRing(size int) *sampleRing {
+	return &sampleRing{samples: make([]*PowermetricsSample, size)}
+}
+
+// add stores sample, overwriting the oldest one once the ring is full
+func (r *sampleRing) add(sample *PowermetricsSample) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.samples[r.next] = sample
+	r.next = (r.next + 1) % len(r.samples)
+	if r.next == 0 {
+		r.full = true
+	}
+}
+
+// snapshot returns the stored samples, oldest first
+func (r *sampleRing) snapshot() []*PowermetricsSample {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if !r.full {
+		return append([]*PowermetricsSample(nil), r.samples[:r.next]...)
+	}
+	return append(append([]*PowermetricsSample(nil), r.samples[r.next:]...), r.samples[:r.next]...)
+}
+
+// averagePowermetricsSamples returns a sample holding the mean of every value
+// across samples. Values missing from some samples are averaged over the
+// samples that contain them. The timestamp is that of the last sample, and
+// the CPU and GPU power extremes are kept alongside their means.
+func averagePowermetricsSamples(samples []*PowermetricsSample) *PowermetricsSample {
+	avg := &PowermetricsSample{
+		CPUFrequency:       make(map[string]float64),
+		CPUActiveResidency: make(map[string]float64),
+		CPUIdleResidency:   make(map[string]float64),
+		CPUDownResidency:   make(map[string]float64),
+		CPUType:            make(map[string]string),
+
+		ClusterActiveResidency:   make(map[string]float64),
+		ClusterIdleResidency:     make(map[string]float64),
+		GPUEngineActiveResidency: make(map[string]float64),
+
+		GPUPowerByIndex:           make(map[string]float64),
+		GPUActiveResidencyByIndex: make(map[string]float64),
+		GPUIdleResidencyByIndex:   make(map[string]float64),
+		GPUKind:                   make(map[string]string),
+	}
+
+	var cpuPower, gpuPower, gpuActive, gpuIdle, aneActive, combined, measured []*float64
+	var interruptWakeups, idleWakeups, thermalPressure []*float64
+	cpuFrequency := make(map[string][]float64)
+	cpuActive := make(map[string][]float64)
+	cpuIdle := make(map[string][]float64)
+	cpuDown := make(map[string][]float64)
+	clusterActive := make(map[string][]float64)
+	clusterIdle := make(map[string][]float64)
+	gpuEngine := make(map[string][]float64)
+	gpuPowerByIndex := make(map[string][]float64)
+	gpuActiveByIndex := make(map[string][]float64)
+	gpuIdleByIndex := make(map[string][]float64)
+	for _, sample := range samples {
+		cpuPower = append(cpuPower, sample.CPUPower)
+		gpuPower = append(gpuPower, sample.GPUPower)
+		gpuActive = append(gpuActive, sample.GPUActiveResidency)
+		gpuIdle = append(gpuIdle, sample.GPUIdleResidency)
+		aneActive = append(aneActive, sample.ANEActiveResidency)
+		combined = append(combined, sample.CombinedPower)
+		measured = append(measured, sample.MeasuredPower)
+		interruptWakeups = append(interruptWakeups, sample.InterruptWakeups)
+		idleWakeups = append(idleWakeups, sample.IdleWakeups)
+		thermalPressure = append(thermalPressure, sample.ThermalPressure)
+		appendByKey(cpuFrequency, sample.CPUFrequency)
+		appendByKey(cpuActive, sample.CPUActiveResidency)
+		appendByKey(cpuIdle, sample.CPUIdleResidency)
+		appendByKey(cpuDown, sample.CPUDownResidency)
+		appendByKey(clusterActive, sample.ClusterActiveResidency)
+		appendByKey(clusterIdle, sample.ClusterIdleResidency)
+		appendByKey(gpuEngine, sample.GPUEngineActiveResidency)
+		appendByKey(gpuPowerByIndex, sample.GPUPowerByIndex)
+		appendByKey(gpuActiveByIndex, sample.GPUActiveResidencyByIndex)
+		appendByKey(gpuIdleByIndex, sample.GPUIdleResidencyByIndex)
+		for core, typ := range sample.CPUType {
+			avg.CPUType[core] = typ
+		}
+		for gpu, kind := range sample.GPUKind {
+			avg.GPUKind[gpu] = kind
+		}
+		avg.LinesTotal += sample.LinesTotal
+		avg.FieldsParsed += sample.FieldsParsed
+		avg.Truncated = avg.Truncated || sample.Truncated
+		avg.Timestamp = sample.Timestamp
+	}
+
+	avg.CPUPower = meanOf(cpuPower)
+	avg.GPUPower = meanOf(gpuPower)
+	avg.CPUPowerMin, avg.CPUPowerMax = minMaxOf(cpuPower)
+	avg.GPUPowerMin, avg.GPUPowerMax = minMaxOf(gpuPower)
+	avg.GPUActiveResidency = meanOf(gpuActive)
+	avg.GPUIdleResidency = meanOf(gpuIdle)
+	avg.ANEActiveResidency = meanOf(aneActive)
+	avg.CombinedPower = meanOf(combined)
+	avg.MeasuredPower = meanOf(measured)
+	avg.InterruptWakeups = meanOf(interruptWakeups)
+	avg.IdleWakeups = meanOf(idleWakeups)
+	_, avg.ThermalPressure = minMaxOf(thermalPressure)
+	meanByKey(avg.CPUFrequency, cpuFrequency)
+	meanByKey(avg.CPUActiveResidency, cpuActive)
+	meanByKey(avg.CPUIdleResidency, cpuIdle)
+	meanByKey(avg.CPUDownResidency, cpuDown)
+	meanByKey(avg.ClusterActiveResidency, clusterActive)
+	meanByKey(avg.ClusterIdleResidency, clusterIdle)
+	meanByKey(avg.GPUEngineActiveResidency, gpuEngine)
+	meanByKey(avg.GPUPowerByIndex, gpuPowerByIndex)
+	meanByKey(avg.GPUActiveResidencyByIndex, gpuActiveByIndex)
+	meanByKey(avg.GPUIdleResidencyByIndex, gpuIdleByIndex)
+	return avg
+}
+
+// meanOf averages the non-nil values, returning nil if there are none
+func meanOf(values []*float64) *float64 {
+	var sum float64
+	var n int
+	for _, v := range values {
+		if v != nil {
+			sum += *v
+			n++
+		}
+	}
+	if n == 0 {
+		return nil
+	}
+	mean := sum / float64(n)
+	return &mean
+}
+
+// minMaxOf returns the smallest and largest non-nil values, or nils if there
+// are none
+func minMaxOf(values []*float64) (lowest, highest *float64) {
+	for _, v := range values {
+		if v == nil {
+			continue
+		}
+		if lowest == nil || *v < *lowest {
+			lowest = v
+		}
+		if highest == nil || *v > *highest {
+			highest = v
+		}
+	}
+	return lowest, highest
+}
+
+// appendByKey appends each value in m to the list under the same key in dst
+func appendByKey(dst map[string][]float64, m map[string]float64) {
+	for k, v := range m {
+		dst[k] = append(dst[k], v)
+	}
+}
+
+// meanByKey stores the mean of each list in src under the same key in dst
+func meanByKey(dst map[string]float64, src map[string][]float64) {
+	for k, values := range src {
+		var sum float64
+		for _, v := range values {
+			sum += v
+		}
+		dst[k] = sum / float64(len(values))
+	}
+}
@@ -0,0 +1,110 @@
+package collector
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"strings"
+	"sync"
+
+	"mac-powermetrics-exporter/internal/config"
+	"mac-powermetrics-exporter/internal/logging"
+)
+
+// powermetricsSamplers returns the samplers powermetrics is asked for. The
+// thermal sampler only adds the pressure level line. The tasks sampler lists
+// every process in each sample, so it is only added for the wakeup metrics.
+func powermetricsSamplers(cfg *config.Config) []string {
+	samplers := []string{"cpu_power", "gpu_power", "thermal"}
+	if cfg.PowermetricsWakeups {
+		samplers = append(samplers, "tasks")
+	}
+	return samplers
+}
+
+// samplerProbe remembers which powermetrics samplers the running macOS
+// supports, so that one unsupported sampler does not fail every run
+type samplerProbe struct {
+	// requested are the samplers to ask for if supported
+	requested []string
+
+	mu sync.Mutex
+	// supported is nil until `powermetrics -h` has been parsed
+	supported map[string]bool
+}
+
+// samplers returns the powermetrics samplers to request. The first call
+// probes `powermetrics -h`; until a probe succeeds all samplers are requested.
+func (probe *samplerProbe) samplers(ctx context.Context, runner commandRunner) []string {
+	probe.mu.Lock()
+	defer probe.mu.Unlock()
+	if probe.supported == nil {
+		// powermetrics may exit non-zero after printing its usage, so the
+		// output is parsed regardless of the error
+		out, err := runner.Run(ctx, "powermetrics", "-h")
+		supported := parseSupportedSamplers(out)
+		if len(supported) == 0 {
+			logCommandFailure("Failed to list powermetrics samplers", "powermetrics", commandLine("powermetrics", "-h"), err, commandStderr(err))
+			return probe.requested
+		}
+		probe.supported = supported
+		for _, sampler := range probe.requested {
+			if !supported[sampler] {
+				logging.Failuref("powermetrics sampler %s is not supported on this macOS, skipping it", sampler)
+			}
+		}
+	}
+
+	var samplers []string
+	for _, sampler := range probe.requested {
+		if probe.supported[sampler] {
+			samplers = append(samplers, sampler)
+		}
+	}
+	// Nothing usable: request everything and let powermetrics report why
+	if len(samplers) == 0 {
+		return probe.requested
+	}
+	return samplers
+}
+
+// availability reports for each requested sampler whether it is supported,
+// or false when no probe has succeeded yet
+func (probe *samplerProbe) availability() (map[string]bool, bool) {
+	probe.mu.Lock()
+	defer probe.mu.Unlock()
+	if probe.supported == nil {
+		return nil, false
+	}
+	available := make(map[string]bool, len(probe.requested))
+	for _, sampler := range probe.requested {
+		available[sampler] = probe.supported[sampler]
+	}
+	return available, true
+}
+
+// parseSupportedSamplers parses the sampler list of `powermetrics -h`:
+//
+//	The following samplers are supported by --samplers:
+//
+//	    tasks            per task cpu usage and wakeup stats
+//	    cpu_power        cpu power and frequency info
+//
+// The sampler groups listed after it are not samplers and are skipped.
+func parseSupportedSamplers(out []byte) map[string]bool {
+	supported := make(map[string]bool)
+	inSamplers := false
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case strings.HasPrefix(line, "The following samplers are supported"):
+			inSamplers = true
+		case strings.HasPrefix(line, "The following"):
+			inSamplers = false
+		case inSamplers && line != "":
+			supported[strings.Fields(line)[0]] = true
+		}
+	}
+	return supported
+}
@@ -0,0 +1,145 @@
+package collector
+
+import (
+	"context"
+	"os"
+	"slices"
+	"testing"
+	"time"
+
+	"mac-powermetrics-exporter/internal/config"
+)
+
+func TestParseSupportedSamplers(t *testing.T) {
+	data, err := os.ReadFile("testdata/powermetrics_help.txt")
+	if err != nil {
+		t.Fatalf("Failed to read fixture: %v", err)
+	}
+
+	supported := parseSupportedSamplers(data)
+	for _, sampler := range []string{"tasks", "cpu_power", "thermal"} {
+		if !supported[sampler] {
+			t.Errorf("Expected sampler %s to be supported", sampler)
+		}
+	}
+	// gpu_power is missing from the fixture, and groups are not samplers
+	for _, sampler := range []string{"gpu_power", "all", "default"} {
+		if supported[sampler] {
+			t.Errorf("Expected %s not to be a supported sampler", sampler)
+		}
+	}
+}
+
+func TestPowermetricsUnsupportedSampler(t *testing.T) {
+	help, err := os.ReadFile("testdata/powermetrics_help.txt")
+	if err != nil {
+		t.Fatalf("Failed to read fixture: %v", err)
+	}
+	data, err := os.ReadFile("testdata/powermetrics_apple_silicon.txt")
+	if err != nil {
+		t.Fatalf("Failed to read fixture: %v", err)
+	}
+
+	// Only the supported samplers are requested
+	cfg := config.New()
+	cfg.PowermetricsWakeups = true
+	collector := NewPowermetricsCollector(cfg)
+	collector.runner = fakeRunner{
+		"powermetrics -h": {stdout: string(help)},
+		"powermetrics --samplers cpu_power,thermal,tasks -i 1000 -n 1": {stdout: string(data)},
+	}
+
+	values := gatherValues(t, collector)
+	expected := map[string]float64{
+		"powermetrics_up": 1,
+		`powermetrics_sampler_available{sampler="cpu_power"}`: 1,
+		`powermetrics_sampler_available{sampler="gpu_power"}`: 0,
+		`powermetrics_sampler_available{sampler="thermal"}`:   1,
+		`powermetrics_sampler_available{sampler="tasks"}`:     1,
+	}
+	for key, want := range expected {
+		if got, ok := values[key]; !ok || got != want {
+			t.Errorf("%s: expected %v, got %v (present=%v)", key, want, got, ok)
+		}
+	}
+}
+
+func TestPowermetricsSamplerProbeFailure(t *testing.T) {
+	// Without a usable `powermetrics -h` every sampler is requested and no
+	// availability is reported
+	probe := samplerProbe{requested: []string{"cpu_power", "gpu_power"}}
+	samplers := probe.samplers(context.Background(), fakeRunner{})
+	if len(samplers) != 2 {
+		t.Errorf("Expected all samplers %v, got %v", probe.requested, samplers)
+	}
+	if available, ok := probe.availability(); ok {
+		t.Errorf("Expected no availability before a successful probe, got %v", available)
+	}
+}
+
+func TestPowermetricsSamplers(t *testing.T) {
+	cfg := config.New()
+	if samplers := powermetricsSamplers(cfg); slices.Contains(samplers, "tasks") {
+		t.Errorf("Expected no tasks sampler by default, got %v", samplers)
+	}
+	cfg.PowermetricsWakeups = true
+	if samplers := powermetricsSamplers(cfg); !slices.Contains(samplers, "tasks") {
+		t.Errorf("Expected the tasks sampler for the wakeup metrics, got %v", samplers)
+	}
+}
+
+func TestPowermetricsCapture(t *testing.T) {
+	help, err := os.ReadFile("testdata/powermetrics_help.txt")
+	if err != nil {
+		t.Fatalf("Failed to read fixture: %v", err)
+	}
+
+	// The capture uses the probed samplers, as a scrape does
+	cfg := config.New()
+	cfg.PowermetricsConcurrency = config.PowermetricsConcurrencySerialize
+	collector := NewPowermetricsCollector(cfg)
+	collector.runner = fakeRunner{
+		"powermetrics -h": {stdout: string(help)},
+		"powermetrics --samplers cpu_power,thermal -i 1000 -n 1": {stdout: "CPU Power: 453 mW\n"},
+	}
+
+	// and waits for a scrape's powermetrics run to finish first
+	started, release := make(chan struct{}), make(chan struct{})
+	go collector.guard.do(func() powermetricsRun {
+		close(started)
+		<-release
+		return powermetricsRun{}
+	})
+	<-started
+	done := make(chan struct{})
+	var stdout []byte
+	go func() {
+		stdout, _, err = collector.Capture(context.Background())
+		close(done)
+	}()
+	select {
+	case <-done:
+		t.Fatal("Expected the capture to wait for the scrape in flight")
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(release)
+	<-done
+	if err != nil || string(stdout) != "CPU Power: 453 mW\n" {
+		t.Errorf("Expected the powermetrics output, got %q (err=%v)", stdout, err)
+	}
+
+	// Background mode returns the latest streamed sample instead of running
+	// a second powermetrics
+	cfg = config.New()
+	cfg.PowermetricsMode = config.PowermetricsModeBackground
+	collector = NewPowermetricsCollector(cfg)
+	collector.runner = fakeRunner{}
+	if _, _, err := collector.Capture(context.Background()); err == nil {
+		t.Error("Expected an error before the first streamed sample")
+	}
+	text := "CPU Power: 120 mW\n"
+	collector.latestText.Store(&text)
+	if stdout, _, err := collector.Capture(context.Background()); err != nil || string(stdout) != text {
+		t.Errorf("Expected the streamed sample, got %q (err=%v)", stdout, err)
+	}
+}
@@ -0,0 +1,54 @@
+package collector
+
+import "sync"
+
+// powermetricsRun is the result of one powermetrics invocation
+type powermetricsRun struct {
+	out    []byte
+	stderr string
+	err    error
+}
+
+// scrapeGuard allows only one powermetrics invocation at a time, so that
+// concurrent scrapes don't spawn several processes that skew each other's
+// readings. With share set, a scrape arriving while a run is in flight waits
+// for it and reuses its result; otherwise it waits and then runs its own.
+type scrapeGuard struct {
+	share bool
+
+	mu       sync.Mutex
+	inflight *scrapeCall
+}
+
+// scrapeCall is a shared powermetrics run; result is set before done is closed
+type scrapeCall struct {
+	done   chan struct{}
+	result powermetricsRun
+}
+
+// do calls run, or waits for the run in flight as described on scrapeGuard
+func (g *scrapeGuard) do(run func() powermetricsRun) powermetricsRun {
+	if !g.share {
+		g.mu.Lock()
+		defer g.mu.Unlock()
+		return run()
+	}
+
+	g.mu.Lock()
+	if call := g.inflight; call != nil {
+		g.mu.Unlock()
+		<-call.done
+		return call.result
+	}
+	call := &scrapeCall{done: make(chan struct{})}
+	g.inflight = call
+	g.mu.Unlock()
+
+	call.result = run()
+
+	g.mu.Lock()
+	g.inflight = nil
+	g.mu.Unlock()
+	close(call.done)
+	return call.result
+}
@@ -0,0 +1,64 @@
+package collector
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestScrapeGuard(t *testing.T) {
+	tests := []struct {
+		name  string
+		share bool
+		runs  int32
+	}{
+		{name: "serialize", share: false, runs: 4},
+		{name: "share", share: true, runs: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			guard := &scrapeGuard{share: tt.share}
+			var runs, running, overlapped atomic.Int32
+			run := func() powermetricsRun {
+				if running.Add(1) > 1 {
+					overlapped.Store(1)
+				}
+				defer running.Add(-1)
+				n := runs.Add(1)
+				time.Sleep(100 * time.Millisecond)
+				return powermetricsRun{out: []byte{byte(n)}}
+			}
+
+			// Start one run, then three scrapes while it is in flight
+			var wg sync.WaitGroup
+			results := make([]powermetricsRun, 4)
+			for i := range results {
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+					results[i] = guard.do(run)
+				}(i)
+				if i == 0 {
+					time.Sleep(20 * time.Millisecond)
+				}
+			}
+			wg.Wait()
+
+			if overlapped.Load() != 0 {
+				t.Error("Expected powermetrics runs not to overlap")
+			}
+			if got := runs.Load(); got != tt.runs {
+				t.Errorf("Expected %d runs, got %d", tt.runs, got)
+			}
+			if tt.share {
+				for i, result := range results {
+					if string(result.out) != string(results[0].out) {
+						t.Errorf("Scrape %d: expected the shared result %v, got %v", i, results[0].out, result.out)
+					}
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,138 @@
+package collector
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// smcLinePattern matches a line of `smc -l` output, e.g.
+//
+//	TC0P  [sp78]  44.125 (bytes 2c 20)
+var smcLinePattern = regexp.MustCompile(`^\s*(.{4})\s+\[(.{1,4})\]\s+(.*?)\s*\(bytes`)
+
+// parseSMCKeys parses `smc -l` output into numeric values keyed by SMC key.
+// Keys whose value is not numeric (flags, strings) are skipped.
+func parseSMCKeys(r io.Reader) map[string]float64 {
+	values := make(map[string]float64)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		match := smcLinePattern.FindStringSubmatch(scanner.Text())
+		if match == nil {
+			continue
+		}
+		value, err := strconv.ParseFloat(strings.TrimSpace(match[3]), 64)
+		if err != nil {
+			continue
+		}
+		values[match[1]] = value
+	}
+	return values
+}
+
+// smcCommand lists every SMC key with the smcFanControl `smc` tool
+const smcCommand = "smc -l"
+
+// readSMCKeys runs smcCommand and returns all numeric keys
+func readSMCKeys(ctx context.Context, runner commandRunner) (map[string]float64, error) {
+	out, err := runner.Run(ctx, "smc", "-l")
+	if err != nil {
+		if msg := commandStderr(err); msg != "" {
+			return nil, fmt.Errorf("%w: %s", err, msg)
+		}
+		return nil, err
+	}
+	return parseSMCKeys(bytes.NewReader(out)), nil
+}
+
+// smcMaxAge is how long an SMC reading is reused. It covers the collectors
+// of one scrape, including powermetrics reading the SMC after its one-second
+// sample, and is shorter than any sensible scrape interval.
+const smcMaxAge = 2 * time.Second
+
+// SMCConsumer is implemented by the collectors that read the SMC keys, so the
+// server can share one SMCReader between them
+type SMCConsumer interface {
+	prometheus.Collector
+	// SetSMCReader makes the collector read the SMC keys through reader
+	SetSMCReader(reader *SMCReader)
+}
+
+// SMCReader runs smcCommand for the collectors of a scrape, so the SMC is
+// listed once per scrape rather than once per collector. Reads arriving
+// while one is in flight wait for it, and a successful result is reused for
+// smcMaxAge. The returned keys are shared and must not be modified.
+type SMCReader struct {
+	maxAge time.Duration
+
+	mu       sync.Mutex
+	inflight *smcRead
+	last     *smcRead
+}
+
+// smcRead is one run of smcCommand; its fields are set before done is closed
+type smcRead struct {
+	done chan struct{}
+	keys map[string]float64
+	err  error
+	at   time.Time
+}
+
+// NewSMCReader creates an SMCReader
+func NewSMCReader() *SMCReader {
+	return &SMCReader{maxAge: smcMaxAge}
+}
+
+// read returns the SMC keys, running smcCommand through runner unless a
+// recent or in-flight read can be shared
+func (reader *SMCReader) read(ctx context.Context, runner commandRunner) (map[string]float64, error) {
+	reader.mu.Lock()
+	if last := reader.last; last != nil && time.Since(last.at) < reader.maxAge {
+		reader.mu.Unlock()
+		return last.keys, nil
+	}
+	if call := reader.inflight; call != nil {
+		reader.mu.Unlock()
+		select {
+		case <-call.done:
+			return call.keys, call.err
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	call := &smcRead{done: make(chan struct{})}
+	reader.inflight = call
+	reader.mu.Unlock()
+
+	call.keys, call.err = readSMCKeys(ctx, runner)
+	call.at = time.Now()
+
+	reader.mu.Lock()
+	reader.inflight = nil
+	if call.err == nil {
+		reader.last = call
+	}
+	reader.mu.Unlock()
+	close(call.done)
+	return call.keys, call.err
+}
+
+// smcSystemPower returns the total system power in mW from the PSTR key
+// (reported in W), or nil when the Mac doesn't expose it
+func smcSystemPower(keys map[string]float64) *float64 {
+	watts, ok := keys["PSTR"]
+	if !ok {
+		return nil
+	}
+	milliwatts := watts * 1000
+	return &milliwatts
+}
@@ -0,0 +1,136 @@
+package collector
+
+import (
+	"slices"
+	"sort"
+	"strings"
+
+	"mac-powermetrics-exporter/internal/config"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// SMC sensor key prefixes by quantity
+const (
+	smcVoltagePrefix = "V"
+	smcCurrentPrefix = "I"
+)
+
+// SMCSensorCollector collects the SMC voltage and current sensors found at startup
+type SMCSensorCollector struct {
+	config *config.Config
+	runner commandRunner
+	smc    *SMCReader
+
+	voltageKeys []string
+	currentKeys []string
+
+	volts *prometheus.Desc
+	amps  *prometheus.Desc
+}
+
+func init() {
+	Register("smc", "smc", func(cfg *config.Config) prometheus.Collector { return NewSMCSensorCollector(cfg) })
+}
+
+// NewSMCSensorCollector creates a new SMCSensorCollector. The sensor keys vary
+// by model, so they are discovered once here and filtered by the configured
+// allow and deny lists.
+func NewSMCSensorCollector(cfg *config.Config) *SMCSensorCollector {
+	return newSMCSensorCollector(cfg, execRunner{})
+}
+
+// newSMCSensorCollector creates an SMCSensorCollector reading the SMC keys
+// through runner
+func newSMCSensorCollector(cfg *config.Config, runner commandRunner) *SMCSensorCollector {
+	collector := &SMCSensorCollector{config: cfg, runner: runner, smc: NewSMCReader()}
+
+	ctx, cancel := scrapeContext(cfg)
+	defer cancel()
+	keys, err := readSMCKeys(ctx, collector.runner)
+	if err != nil {
+		logCommandFailure("Failed to run command", "smc", smcCommand, err, "")
+		return collector
+	}
+	collector.voltageKeys = selectSMCSensors(keys, smcVoltagePrefix, cfg.SMCSensorAllow, cfg.SMCSensorDeny)
+	collector.currentKeys = selectSMCSensors(keys, smcCurrentPrefix, cfg.SMCSensorAllow, cfg.SMCSensorDeny)
+
+	if len(collector.voltageKeys) > 0 {
+		collector.volts = prometheus.NewDesc(
+			prometheus.BuildFQName(cfg.Namespace, "smc", "sensor_volts"),
+			"Voltage reported by an SMC sensor key in volts.",
+			[]string{"key"},
+			cfg.ConstLabels,
+		)
+	}
+	if len(collector.currentKeys) > 0 {
+		collector.amps = prometheus.NewDesc(
+			prometheus.BuildFQName(cfg.Namespace, "smc", "sensor_amps"),
+			"Current reported by an SMC sensor key in amperes.",
+			[]string{"key"},
+			cfg.ConstLabels,
+		)
+	}
+	return collector
+}
+
+// SetSMCReader implements SMCConsumer
+func (collector *SMCSensorCollector) SetSMCReader(reader *SMCReader) {
+	collector.smc = reader
+}
+
+// Describe describes metrics to Prometheus
+func (collector *SMCSensorCollector) Describe(ch chan<- *prometheus.Desc) {
+	if collector.volts != nil {
+		ch <- collector.volts
+	}
+	if collector.amps != nil {
+		ch <- collector.amps
+	}
+}
+
+// Collect is called by Prometheus when collecting metrics
+func (collector *SMCSensorCollector) Collect(ch chan<- prometheus.Metric) {
+	if collector.volts == nil && collector.amps == nil {
+		return
+	}
+
+	ctx, cancel := scrapeContext(collector.config)
+	defer cancel()
+	keys, err := collector.smc.read(ctx, collector.runner)
+	if err != nil {
+		logCommandFailure("Failed to run command", "smc", smcCommand, err, "")
+		return
+	}
+
+	for _, key := range collector.voltageKeys {
+		if value, ok := keys[key]; ok {
+			ch <- prometheus.MustNewConstMetric(collector.volts, prometheus.GaugeValue, value, key)
+		}
+	}
+	for _, key := range collector.currentKeys {
+		if value, ok := keys[key]; ok {
+			ch <- prometheus.MustNewConstMetric(collector.amps, prometheus.GaugeValue, value, key)
+		}
+	}
+}
+
+// selectSMCSensors returns the sorted keys starting with prefix that pass the
+// allow list (when non-empty) and are not in the deny list
+func selectSMCSensors(keys map[string]float64, prefix string, allow, deny []string) []string {
+	var selected []string
+	for key := range keys {
+		if !strings.HasPrefix(key, prefix) {
+			continue
+		}
+		if len(allow) > 0 && !slices.Contains(allow, key) {
+			continue
+		}
+		if slices.Contains(deny, key) {
+			continue
+		}
+		selected = append(selected, key)
+	}
+	sort.Strings(selected)
+	return selected
+}
@@ -0,0 +1,175 @@
+package collector
+
+import (
+	"context"
+	"os"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"mac-powermetrics-exporter/internal/config"
+)
+
+func TestParseThermalZones(t *testing.T) {
+	f, err := os.Open("testdata/smc_zones.txt")
+	if err != nil {
+		t.Fatalf("Failed to open fixture: %v", err)
+	}
+	defer f.Close()
+
+	got := make(map[string]float64)
+	for _, zone := range parseThermalZones(parseSMCKeys(f)) {
+		got[zone.name] = zone.celsius
+	}
+
+	expected := map[string]float64{
+		"ambient":          31.25,
+		"battery":          30.5,
+		"cpu_die":          52.375,
+		"cpu_die_virtual":  51,
+		"cpu_die_filtered": 51.5,
+		"cpu_proximity":    44.125,
+		"gpu_proximity":    41.75,
+		"heatsink":         39,
+		"memory_proximity": 40.25,
+		"palm_rest":        29.875,
+	}
+	if len(got) != len(expected) {
+		t.Errorf("Expected %d zones, got %d: %v", len(expected), len(got), got)
+	}
+	for zone, celsius := range expected {
+		if got[zone] != celsius {
+			t.Errorf("Zone %s: expected %v, got %v", zone, celsius, got[zone])
+		}
+	}
+}
+
+func TestParseSMCKeysSkipsNonNumeric(t *testing.T) {
+	f, err := os.Open("testdata/smc_zones.txt")
+	if err != nil {
+		t.Fatalf("Failed to open fixture: %v", err)
+	}
+	defer f.Close()
+
+	keys := parseSMCKeys(f)
+	for _, key := range []string{"MSAc", "RPlt"} {
+		if _, ok := keys[key]; ok {
+			t.Errorf("Expected non-numeric key %s to be skipped", key)
+		}
+	}
+	if keys["FNum"] != 1 {
+		t.Errorf("Expected FNum 1, got %v", keys["FNum"])
+	}
+}
+
+func TestParseFans(t *testing.T) {
+	f, err := os.Open("testdata/smc_zones.txt")
+	if err != nil {
+		t.Fatalf("Failed to open fixture: %v", err)
+	}
+	defer f.Close()
+
+	fans := parseFans(parseSMCKeys(f))
+	if len(fans) != 1 {
+		t.Fatalf("Expected 1 fan, got %d", len(fans))
+	}
+	if fans[0].index != "0" || fans[0].speed == nil || *fans[0].speed != 1998.75 || fans[0].target == nil || *fans[0].target != 2000 {
+		t.Errorf("Unexpected fan reading: %+v", fans[0])
+	}
+
+	// Fanless Macs expose no FNum key at all
+	if fans := parseFans(map[string]float64{"TC0P": 44.125}); len(fans) != 0 {
+		t.Errorf("Expected no fans without FNum, got %d", len(fans))
+	}
+}
+
+func TestSelectSMCSensors(t *testing.T) {
+	f, err := os.Open("testdata/smc_zones.txt")
+	if err != nil {
+		t.Fatalf("Failed to open fixture: %v", err)
+	}
+	defer f.Close()
+	keys := parseSMCKeys(f)
+
+	tests := []struct {
+		name   string
+		prefix string
+		allow  []string
+		deny   []string
+		want   []string
+	}{
+		{name: "all volts", prefix: smcVoltagePrefix, want: []string{"VC0C", "VD0R"}},
+		{name: "all amps", prefix: smcCurrentPrefix, want: []string{"IC0R", "ID0R"}},
+		{name: "allow list", prefix: smcVoltagePrefix, allow: []string{"VD0R"}, want: []string{"VD0R"}},
+		{name: "deny list", prefix: smcCurrentPrefix, deny: []string{"IC0R"}, want: []string{"ID0R"}},
+		{name: "absent allowed key", prefix: smcCurrentPrefix, allow: []string{"IB0R"}, want: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := selectSMCSensors(keys, tt.prefix, tt.allow, tt.deny)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("Expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+// countingRunner counts the smc runs and returns one key, after delay
+type countingRunner struct {
+	runs  atomic.Int32
+	delay time.Duration
+}
+
+// Run implements commandRunner
+func (runner *countingRunner) Run(_ context.Context, _ string, _ ...string) ([]byte, error) {
+	runner.runs.Add(1)
+	time.Sleep(runner.delay)
+	return []byte("  FNum  [ui8 ]  1 (bytes 01)\n"), nil
+}
+
+func TestSMCReaderShared(t *testing.T) {
+	runner := &countingRunner{}
+	reader := NewSMCReader()
+	fans := NewFanCollector(config.New())
+	fans.runner = runner
+	fans.SetSMCReader(reader)
+	zones := NewThermalZoneCollector(config.New())
+	zones.runner = runner
+	zones.SetSMCReader(reader)
+
+	gatherValues(t, fans)
+	gatherValues(t, zones)
+	if got := runner.runs.Load(); got != 1 {
+		t.Errorf("Expected one smc run for both collectors, got %d", got)
+	}
+
+	reader.maxAge = 0
+	gatherValues(t, fans)
+	if got := runner.runs.Load(); got != 2 {
+		t.Errorf("Expected an expired reading to run smc again, got %d runs", got)
+	}
+}
+
+func TestSMCReaderConcurrent(t *testing.T) {
+	runner := &countingRunner{delay: 100 * time.Millisecond}
+	reader := NewSMCReader()
+
+	var wg sync.WaitGroup
+	for range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			keys, err := reader.read(context.Background(), runner)
+			if err != nil || keys["FNum"] != 1 {
+				t.Errorf("Expected FNum 1, got %v (%v)", keys, err)
+			}
+		}()
+	}
+	wg.Wait()
+	if got := runner.runs.Load(); got != 1 {
+		t.Errorf("Expected concurrent reads to share one smc run, got %d", got)
+	}
+}
@@ -0,0 +1,92 @@
+package collector
+
+import (
+	"regexp"
+	"strconv"
+	"time"
+
+	"mac-powermetrics-exporter/internal/config"
+	"mac-powermetrics-exporter/internal/logging"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// SystemCollector collects boot time and uptime
+type SystemCollector struct {
+	config *config.Config
+	runner commandRunner
+
+	bootTime *prometheus.Desc
+	uptime   *prometheus.Desc
+}
+
+func init() {
+	Register("system", "sysctl", func(cfg *config.Config) prometheus.Collector { return NewSystemCollector(cfg) })
+}
+
+// NewSystemCollector creates a new SystemCollector
+func NewSystemCollector(cfg *config.Config) *SystemCollector {
+	return &SystemCollector{
+		config: cfg,
+		runner: execRunner{},
+		bootTime: prometheus.NewDesc(
+			prometheus.BuildFQName(cfg.Namespace, "system", "boot_time_seconds"),
+			"System boot time in seconds since the Unix epoch.",
+			nil,
+			cfg.ConstLabels,
+		),
+		uptime: prometheus.NewDesc(
+			prometheus.BuildFQName(cfg.Namespace, "system", "uptime_seconds"),
+			"Seconds since the system booted.",
+			nil,
+			cfg.ConstLabels,
+		),
+	}
+}
+
+// Describe describes metrics to Prometheus
+func (collector *SystemCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- collector.bootTime
+	ch <- collector.uptime
+}
+
+// Collect is called by Prometheus when collecting metrics
+func (collector *SystemCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := scrapeContext(collector.config)
+	defer cancel()
+	out, err := collector.runner.Run(ctx, "sysctl", "-n", "kern.boottime")
+	if err != nil {
+		logCommandFailure("Failed to run command", "system", commandLine("sysctl", "-n", "kern.boottime"), err, commandStderr(err))
+		return
+	}
+
+	bootTime, ok := parseBootTime(string(out))
+	if !ok {
+		logging.Failuref("Failed to parse kern.boottime: %q", string(out))
+		return
+	}
+	ch <- prometheus.MustNewConstMetric(collector.bootTime, prometheus.GaugeValue, bootTime)
+	ch <- prometheus.MustNewConstMetric(collector.uptime, prometheus.GaugeValue, float64(time.Now().UnixNano())/1e9-bootTime)
+}
+
+// bootTimePattern matches `sysctl -n kern.boottime` output, e.g.
+//
+//	{ sec = 1700000000, usec = 250000 } Tue Nov 14 22:13:20 2023
+var bootTimePattern = regexp.MustCompile(`sec = (\d+), usec = (\d+)`)
+
+// parseBootTime returns the boot time in seconds since the Unix epoch
+func parseBootTime(s string) (float64, bool) {
+	match := bootTimePattern.FindStringSubmatch(s)
+	if match == nil {
+		return 0, false
+	}
+	sec, err := strconv.ParseInt(match[1], 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	usec, err := strconv.ParseInt(match[2], 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return float64(sec) + float64(usec)/1e6, true
+}
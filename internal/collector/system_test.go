@@ -0,0 +1,25 @@
+package collector
+
+import "testing"
+
+func TestParseBootTime(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  float64
+		ok    bool
+	}{
+		{name: "whole seconds", input: "{ sec = 1700000000, usec = 0 } Tue Nov 14 22:13:20 2023\n", want: 1700000000, ok: true},
+		{name: "microseconds", input: "{ sec = 1700000000, usec = 250000 } Tue Nov 14 22:13:20 2023", want: 1700000000.25, ok: true},
+		{name: "unparsable", input: "sysctl: unknown oid 'kern.boottime'", ok: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := parseBootTime(tt.input)
+			if ok != tt.ok || got != tt.want {
+				t.Errorf("Expected %v (ok=%v), got %v (ok=%v)", tt.want, tt.ok, got, ok)
+			}
+		})
+	}
+}
@@ -0,0 +1,324 @@
+package collector
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"mac-powermetrics-exporter/internal/config"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// TasksCollector collects per-process energy impact from the powermetrics
+// tasks sampler, limited to the top processes to bound cardinality
+type TasksCollector struct {
+	config *config.Config
+	runner commandRunner
+
+	energyImpact *prometheus.Desc
+	cpuTime      *prometheus.Desc
+	gpuTime      *prometheus.Desc
+	bytesRead    *prometheus.Desc
+	bytesWritten *prometheus.Desc
+}
+
+func init() {
+	Register("tasks", "powermetrics", func(cfg *config.Config) prometheus.Collector { return NewTasksCollector(cfg) })
+}
+
+// NewTasksCollector creates a new TasksCollector
+func NewTasksCollector(cfg *config.Config) *TasksCollector {
+	return &TasksCollector{
+		config: cfg,
+		runner: execRunner{},
+		energyImpact: prometheus.NewDesc(
+			prometheus.BuildFQName(cfg.Namespace, "powermetrics", "process_energy_impact"),
+			"Energy impact of a process as reported by powermetrics.",
+			[]string{"pid", "name"},
+			cfg.ConstLabels,
+		),
+		cpuTime: prometheus.NewDesc(
+			prometheus.BuildFQName(cfg.Namespace, "powermetrics", "process_cpu_ms_per_s"),
+			"CPU time used by a process in milliseconds per second.",
+			[]string{"pid", "name"},
+			cfg.ConstLabels,
+		),
+		gpuTime: prometheus.NewDesc(
+			prometheus.BuildFQName(cfg.Namespace, "powermetrics", "process_gpu_ms_per_s"),
+			"GPU time used by a process in milliseconds per second.",
+			[]string{"pid", "name"},
+			cfg.ConstLabels,
+		),
+		bytesRead: prometheus.NewDesc(
+			prometheus.BuildFQName(cfg.Namespace, "powermetrics", "process_disk_read_bytes"),
+			"Bytes read from disk by a process during the sample.",
+			[]string{"pid", "name"},
+			cfg.ConstLabels,
+		),
+		bytesWritten: prometheus.NewDesc(
+			prometheus.BuildFQName(cfg.Namespace, "powermetrics", "process_disk_written_bytes"),
+			"Bytes written to disk by a process during the sample.",
+			[]string{"pid", "name"},
+			cfg.ConstLabels,
+		),
+	}
+}
+
+// Describe describes metrics to Prometheus
+func (collector *TasksCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- collector.energyImpact
+	ch <- collector.cpuTime
+	if collector.config.TasksExtendedFields {
+		ch <- collector.gpuTime
+		ch <- collector.bytesRead
+		ch <- collector.bytesWritten
+	}
+}
+
+// Collect is called by Prometheus when collecting metrics
+func (collector *TasksCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := scrapeContext(collector.config)
+	defer cancel()
+	args := append(powermetricsArgs([]string{"tasks"}, collector.config.PowermetricsInterval, 1), "--show-process-energy")
+	if collector.config.TasksExtendedFields {
+		args = append(args, "--show-process-gpu", "--show-process-io")
+	}
+	out, err := collector.runner.Run(ctx, "powermetrics", args...)
+	if err != nil {
+		logCommandFailure("Failed to run command", "tasks", commandLine("powermetrics", args...), err, commandStderr(err))
+		return
+	}
+
+	tasks := topTasks(parseTasks(bytes.NewReader(out)), collector.config.TasksTopN)
+	for _, task := range capTasks(tasks, collector.config.MaxProcessSeries) {
+		ch <- prometheus.MustNewConstMetric(collector.cpuTime, prometheus.GaugeValue, task.cpuMsPerS, task.pid, task.name)
+		if task.energyImpact != nil {
+			ch <- prometheus.MustNewConstMetric(collector.energyImpact, prometheus.GaugeValue, *task.energyImpact, task.pid, task.name)
+		}
+		if !collector.config.TasksExtendedFields {
+			continue
+		}
+		if task.gpuMsPerS != nil {
+			ch <- prometheus.MustNewConstMetric(collector.gpuTime, prometheus.GaugeValue, *task.gpuMsPerS, task.pid, task.name)
+		}
+		if task.bytesRead != nil {
+			ch <- prometheus.MustNewConstMetric(collector.bytesRead, prometheus.GaugeValue, *task.bytesRead, task.pid, task.name)
+		}
+		if task.bytesWritten != nil {
+			ch <- prometheus.MustNewConstMetric(collector.bytesWritten, prometheus.GaugeValue, *task.bytesWritten, task.pid, task.name)
+		}
+	}
+}
+
+// taskSample is one process row of the tasks sampler
+type taskSample struct {
+	pid          string
+	name         string
+	cpuMsPerS    float64
+	energyImpact *float64
+
+	// Only reported when TasksExtendedFields adds the matching flags
+	gpuMsPerS    *float64
+	bytesRead    *float64
+	bytesWritten *float64
+}
+
+// taskColumn is a heading of the tasks table with the number of values it
+// spans and, for columns that are exported, how its values are stored
+type taskColumn struct {
+	heading string
+	values  int
+	parse   func(task *taskSample, values []string)
+}
+
+// taskColumns are the headings powermetrics may print in the tasks table.
+// Optional columns are only present on some machines or with extra flags
+// such as --show-process-gpu and --show-process-io. Supporting a new column
+// only takes an entry here and a field in taskSample.
+var taskColumns = []taskColumn{
+	{"ID", 1, func(task *taskSample, values []string) { task.pid = sanitizeLabelValue(values[0]) }},
+	{"CPU ms/s", 1, func(task *taskSample, values []string) { task.cpuMsPerS, _ = strconv.ParseFloat(values[0], 64) }},
+	{"User%", 1, nil},
+	{"Deadlines", 2, nil},
+	{"Wakeups", 2, nil},
+	{"Bytes Read", 1, func(task *taskSample, values []string) { task.bytesRead = parseTaskValue(values[0]) }},
+	{"Bytes Written", 1, func(task *taskSample, values []string) { task.bytesWritten = parseTaskValue(values[0]) }},
+	{"GPU ms/s", 1, func(task *taskSample, values []string) { task.gpuMsPerS = parseTaskValue(values[0]) }},
+	{"Energy Impact", 1, func(task *taskSample, values []string) { task.energyImpact = parseTaskValue(values[0]) }},
+}
+
+// parseTasks parses the "Running tasks" table of powermetrics output. Process
+// names may contain spaces, so each row is read from the right using the
+// value count implied by the header. The ALL_TASKS summary row is skipped.
+func parseTasks(r io.Reader) []taskSample {
+	var tasks []taskSample
+	var columns []string
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		// The header line starts the table and determines the columns
+		if header := parseTaskHeader(line); header != nil {
+			columns = header
+			continue
+		}
+		if columns == nil {
+			continue
+		}
+
+		// A blank line or the next section ends the table
+		name, values, ok := splitTaskRow(line, columns)
+		if !ok {
+			columns = nil
+			continue
+		}
+
+		task := taskSample{name: sanitizeLabelValue(name)}
+		for _, column := range taskColumns {
+			if column.parse == nil {
+				continue
+			}
+			if columnValues := taskColumnValues(values, columns, column.heading); columnValues != nil {
+				column.parse(&task, columnValues)
+			}
+		}
+		if task.name == "ALL_TASKS" || strings.HasPrefix(task.pid, "-") {
+			continue
+		}
+		tasks = append(tasks, task)
+	}
+	return tasks
+}
+
+// parseTaskHeader returns the column of each value in a tasks table row, or
+// nil when line is not the table header. Columns are ordered by their
+// position in the header, so variants that move a column still parse.
+func parseTaskHeader(line string) []string {
+	if !strings.HasPrefix(line, "Name ") || !strings.Contains(line, "CPU ms/s") {
+		return nil
+	}
+	present := make([]taskColumn, 0, len(taskColumns))
+	positions := make(map[string]int)
+	for _, column := range taskColumns {
+		if i := strings.Index(line, column.heading); i >= 0 {
+			present = append(present, column)
+			positions[column.heading] = i
+		}
+	}
+	sort.SliceStable(present, func(i, j int) bool {
+		return positions[present[i].heading] < positions[present[j].heading]
+	})
+
+	var columns []string
+	for _, column := range present {
+		for i := 0; i < column.values; i++ {
+			columns = append(columns, column.heading)
+		}
+	}
+	return columns
+}
+
+// splitTaskRow splits a tasks table row into the process name and one value
+// per column. It reports false for lines that are not a row of the table.
+func splitTaskRow(line string, columns []string) (string, []string, bool) {
+	fields := strings.Fields(line)
+	if len(fields) <= len(columns) {
+		return "", nil, false
+	}
+	return strings.Join(fields[:len(fields)-len(columns)], " "), fields[len(fields)-len(columns):], true
+}
+
+// taskColumnValues returns the values of a row under heading, or nil when
+// the table has no such column
+func taskColumnValues(values, columns []string, heading string) []string {
+	var matched []string
+	for i, column := range columns {
+		if column == heading {
+			matched = append(matched, values[i])
+		}
+	}
+	return matched
+}
+
+// parseTaskValue parses a numeric cell, returning nil when it isn't a number
+func parseTaskValue(value string) *float64 {
+	parsed, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return nil
+	}
+	return &parsed
+}
+
+// parseWakeups returns the interrupt and package idle wakeups per second of a
+// tasks table row, the two values under the Wakeups heading
+func parseWakeups(values, columns []string) (interrupt, idle float64, ok bool) {
+	wakeups := taskColumnValues(values, columns, "Wakeups")
+	if len(wakeups) != 2 {
+		return 0, 0, false
+	}
+	interruptValue, idleValue := parseTaskValue(wakeups[0]), parseTaskValue(wakeups[1])
+	if interruptValue == nil || idleValue == nil {
+		return 0, 0, false
+	}
+	return *interruptValue, *idleValue, true
+}
+
+// topTasks returns the n tasks with the highest energy impact, falling back to
+// CPU time when energy impact isn't reported. n <= 0 keeps every task.
+func topTasks(tasks []taskSample, n int) []taskSample {
+	sort.SliceStable(tasks, func(i, j int) bool {
+		return taskWeight(tasks[i]) > taskWeight(tasks[j])
+	})
+	if n > 0 && len(tasks) > n {
+		tasks = tasks[:n]
+	}
+	return tasks
+}
+
+// otherTask is the name of the process the tasks beyond MaxProcessSeries are
+// summed into
+const otherTask = "other"
+
+// capTasks keeps the first n tasks and sums the rest into one task named
+// otherTask with an empty pid, bounding the number of process series.
+// n <= 0 keeps every task.
+func capTasks(tasks []taskSample, n int) []taskSample {
+	if n <= 0 || len(tasks) <= n {
+		return tasks
+	}
+	other := taskSample{name: otherTask}
+	for _, task := range tasks[n:] {
+		other.cpuMsPerS += task.cpuMsPerS
+		other.energyImpact = addTaskValue(other.energyImpact, task.energyImpact)
+		other.gpuMsPerS = addTaskValue(other.gpuMsPerS, task.gpuMsPerS)
+		other.bytesRead = addTaskValue(other.bytesRead, task.bytesRead)
+		other.bytesWritten = addTaskValue(other.bytesWritten, task.bytesWritten)
+	}
+	return append(tasks[:n:n], other)
+}
+
+// addTaskValue returns sum + value, treating nil as missing
+func addTaskValue(sum, value *float64) *float64 {
+	if value == nil {
+		return sum
+	}
+	if sum == nil {
+		total := *value
+		return &total
+	}
+	total := *sum + *value
+	return &total
+}
+
+// taskWeight ranks a task for topTasks
+func taskWeight(task taskSample) float64 {
+	if task.energyImpact != nil {
+		return *task.energyImpact
+	}
+	return task.cpuMsPerS
+}
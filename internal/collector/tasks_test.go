@@ -0,0 +1,163 @@
+package collector
+
+import (
+	"math"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+
+	"mac-powermetrics-exporter/internal/config"
+)
+
+func TestParseTasks(t *testing.T) {
+	f, err := os.Open("testdata/powermetrics_tasks.txt")
+	if err != nil {
+		t.Fatalf("Failed to open fixture: %v", err)
+	}
+	defer f.Close()
+
+	tasks := parseTasks(f)
+	if len(tasks) != 6 {
+		t.Fatalf("Expected 6 tasks without ALL_TASKS, got %d", len(tasks))
+	}
+
+	byName := make(map[string]taskSample)
+	for _, task := range tasks {
+		byName[task.name] = task
+	}
+	chrome, ok := byName["Google Chrome Helper (Renderer)"]
+	if !ok {
+		t.Fatalf("Expected the name with spaces to be kept whole, got %v", tasks)
+	}
+	if chrome.pid != "4521" || chrome.cpuMsPerS != 22.90 || chrome.energyImpact == nil || *chrome.energyImpact != 28.77 {
+		t.Errorf("Unexpected Chrome row: %+v", chrome)
+	}
+}
+
+func TestParseTasksWithoutEnergyImpact(t *testing.T) {
+	input := `*** Running tasks ***
+
+Name                               ID     CPU ms/s  User%  Deadlines (<2 ms, 2-5 ms)  Wakeups (Intr, Pkg idle)
+WindowServer                       154    45.23     54.12  12.95   0.00               150.37  10.96
+`
+	tasks := parseTasks(strings.NewReader(input))
+	if len(tasks) != 1 || tasks[0].pid != "154" || tasks[0].cpuMsPerS != 45.23 || tasks[0].energyImpact != nil {
+		t.Errorf("Unexpected tasks: %+v", tasks)
+	}
+}
+
+func TestTopTasks(t *testing.T) {
+	f, err := os.Open("testdata/powermetrics_tasks.txt")
+	if err != nil {
+		t.Fatalf("Failed to open fixture: %v", err)
+	}
+	defer f.Close()
+
+	top := topTasks(parseTasks(f), 3)
+	want := []string{"com.apple.WebKit.WebContent", "WindowServer", "kernel_task"}
+	if len(top) != len(want) {
+		t.Fatalf("Expected %d tasks, got %d", len(want), len(top))
+	}
+	for i, name := range want {
+		if top[i].name != name {
+			t.Errorf("Position %d: expected %s, got %s", i, name, top[i].name)
+		}
+	}
+}
+
+func TestParseTasksExtendedFields(t *testing.T) {
+	// --show-process-io and --show-process-gpu add columns before Energy Impact
+	input := `*** Running tasks ***
+
+Name                               ID     CPU ms/s  User%  Deadlines (<2 ms, 2-5 ms)  Wakeups (Intr, Pkg idle)  Bytes Read  Bytes Written  GPU ms/s  Energy Impact
+WindowServer                       154    45.23     54.12  12.95   0.00               150.37  10.96            0           4096           12.41     52.31
+Google Chrome Helper (Renderer)    4521   22.90     90.01  0.00    0.00               45.32   1.99             65536       8192           3.20      28.77
+ALL_TASKS                          -2     68.13     66.31  12.95   0.00               195.69  12.95            65536       12288          15.61     81.08
+`
+	tasks := parseTasks(strings.NewReader(input))
+	if len(tasks) != 2 {
+		t.Fatalf("Expected 2 tasks without ALL_TASKS, got %+v", tasks)
+	}
+	chrome := tasks[1]
+	if chrome.name != "Google Chrome Helper (Renderer)" || chrome.pid != "4521" || chrome.cpuMsPerS != 22.90 {
+		t.Errorf("Unexpected Chrome row: %+v", chrome)
+	}
+	for name, got := range map[string]struct {
+		value *float64
+		want  float64
+	}{
+		"energy impact": {chrome.energyImpact, 28.77},
+		"GPU ms/s":      {chrome.gpuMsPerS, 3.20},
+		"bytes read":    {chrome.bytesRead, 65536},
+		"bytes written": {chrome.bytesWritten, 8192},
+	} {
+		if got.value == nil || *got.value != got.want {
+			t.Errorf("%s: expected %v, got %v", name, got.want, got.value)
+		}
+	}
+}
+
+func TestParseTaskHeaderOrder(t *testing.T) {
+	// The columns follow the header, not the order of taskColumns
+	header := "Name        ID     CPU ms/s  GPU ms/s  Energy Impact  Wakeups (Intr, Pkg idle)"
+	want := []string{"ID", "CPU ms/s", "GPU ms/s", "Energy Impact", "Wakeups", "Wakeups"}
+	if got := parseTaskHeader(header); !slices.Equal(got, want) {
+		t.Errorf("Expected columns %v, got %v", want, got)
+	}
+}
+
+func TestCapTasks(t *testing.T) {
+	f, err := os.Open("testdata/powermetrics_tasks.txt")
+	if err != nil {
+		t.Fatalf("Failed to open fixture: %v", err)
+	}
+	defer f.Close()
+
+	capped := capTasks(topTasks(parseTasks(f), 0), 3)
+	if len(capped) != 4 {
+		t.Fatalf("Expected 3 tasks and other, got %d", len(capped))
+	}
+	other := capped[3]
+	if other.name != "other" || other.pid != "" {
+		t.Errorf("Expected the overflow as name=other without a pid, got %+v", other)
+	}
+	// Google Chrome Helper, mds_stores and powermetrics
+	if math.Abs(other.cpuMsPerS-35.06) > 1e-9 || other.energyImpact == nil || math.Abs(*other.energyImpact-42.00) > 1e-9 {
+		t.Errorf("Expected the overflow to be summed, got %+v", other)
+	}
+
+	if got := capTasks(capped[:2], 3); len(got) != 2 {
+		t.Errorf("Expected tasks below the cap to be kept, got %d", len(got))
+	}
+}
+
+func TestTasksScrape(t *testing.T) {
+	data, err := os.ReadFile("testdata/powermetrics_tasks.txt")
+	if err != nil {
+		t.Fatalf("Failed to read fixture: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		extended bool
+		command  string
+	}{
+		{name: "default", command: "powermetrics --samplers tasks -i 1000 -n 1 --show-process-energy"},
+		{name: "extended", extended: true, command: "powermetrics --samplers tasks -i 1000 -n 1 --show-process-energy --show-process-gpu --show-process-io"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := config.New()
+			cfg.TasksExtendedFields = tt.extended
+			collector := NewTasksCollector(cfg)
+			collector.runner = fakeRunner{tt.command: {stdout: string(data)}}
+
+			values := gatherValues(t, collector)
+			if got := values[`powermetrics_process_cpu_ms_per_s{name="WindowServer",pid="154"}`]; got != 45.23 {
+				t.Errorf("Expected WindowServer CPU time from %q, got %v", tt.command, values)
+			}
+		})
+	}
+}
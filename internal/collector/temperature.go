@@ -0,0 +1,40 @@
+package collector
+
+import (
+	"mac-powermetrics-exporter/internal/config"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// fahrenheitDesc returns the desc of the Fahrenheit companion of a Celsius
+// temperature metric, named with the given unitless name, e.g.
+// "cpu_temperature". It is nil unless TemperatureFahrenheit is set.
+func fahrenheitDesc(cfg *config.Config, subsystem, name, help string, labels []string) *prometheus.Desc {
+	if !cfg.TemperatureFahrenheit {
+		return nil
+	}
+	return prometheus.NewDesc(
+		prometheus.BuildFQName(cfg.Namespace, subsystem, name+"_fahrenheit"),
+		help,
+		labels,
+		cfg.ConstLabels,
+	)
+}
+
+// emitTemperature emits a temperature in Celsius, and in Fahrenheit when
+// fahrenheit is set
+func emitTemperature(ch chan<- prometheus.Metric, celsius, fahrenheit *prometheus.Desc, value float64, labels ...string) {
+	ch <- prometheus.MustNewConstMetric(celsius, prometheus.GaugeValue, value, labels...)
+	if fahrenheit != nil {
+		ch <- prometheus.MustNewConstMetric(fahrenheit, prometheus.GaugeValue, value*9/5+32, labels...)
+	}
+}
+
+// describeTemperature describes a temperature metric and its Fahrenheit
+// companion, if any
+func describeTemperature(ch chan<- *prometheus.Desc, celsius, fahrenheit *prometheus.Desc) {
+	ch <- celsius
+	if fahrenheit != nil {
+		ch <- fahrenheit
+	}
+}
@@ -0,0 +1,97 @@
+package collector
+
+import (
+	"mac-powermetrics-exporter/internal/config"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// thermalZones maps the SMC temperature keys used by the fan-control loop
+// to stable zone names. Not every Mac exposes every key.
+var thermalZones = map[string]string{
+	"TA0P": "ambient",
+	"TB0T": "battery",
+	"TC0D": "cpu_die",
+	"TC0E": "cpu_die_virtual",
+	"TC0F": "cpu_die_filtered",
+	"TC0P": "cpu_proximity",
+	"TG0D": "gpu_die",
+	"TG0P": "gpu_proximity",
+	"Th0H": "heatsink",
+	"TM0P": "memory_proximity",
+	"TN0P": "platform_controller",
+	"Tp0C": "power_supply",
+	"Ts0P": "palm_rest",
+}
+
+// ThermalZoneCollector collects SMC thermal zone temperatures
+type ThermalZoneCollector struct {
+	config *config.Config
+	runner commandRunner
+	smc    *SMCReader
+
+	zoneTemperature           *prometheus.Desc
+	zoneTemperatureFahrenheit *prometheus.Desc
+}
+
+func init() {
+	Register("thermal", "smc", func(cfg *config.Config) prometheus.Collector { return NewThermalZoneCollector(cfg) })
+}
+
+// NewThermalZoneCollector creates a new ThermalZoneCollector
+func NewThermalZoneCollector(cfg *config.Config) *ThermalZoneCollector {
+	return &ThermalZoneCollector{
+		config: cfg,
+		runner: execRunner{},
+		smc:    NewSMCReader(),
+		zoneTemperature: prometheus.NewDesc(
+			prometheus.BuildFQName(cfg.Namespace, "mac", "thermal_zone_temperature_celsius"),
+			"Temperature of an SMC fan-control thermal zone in Celsius.",
+			[]string{"zone"},
+			cfg.ConstLabels,
+		),
+		zoneTemperatureFahrenheit: fahrenheitDesc(cfg, "mac", "thermal_zone_temperature", "Temperature of an SMC fan-control thermal zone in Fahrenheit.", []string{"zone"}),
+	}
+}
+
+// SetSMCReader implements SMCConsumer
+func (collector *ThermalZoneCollector) SetSMCReader(reader *SMCReader) {
+	collector.smc = reader
+}
+
+// Describe describes metrics to Prometheus
+func (collector *ThermalZoneCollector) Describe(ch chan<- *prometheus.Desc) {
+	describeTemperature(ch, collector.zoneTemperature, collector.zoneTemperatureFahrenheit)
+}
+
+// Collect is called by Prometheus when collecting metrics
+func (collector *ThermalZoneCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := scrapeContext(collector.config)
+	defer cancel()
+	keys, err := collector.smc.read(ctx, collector.runner)
+	if err != nil {
+		logCommandFailure("Failed to run command", "thermal", smcCommand, err, "")
+		return
+	}
+
+	for _, zone := range parseThermalZones(keys) {
+		emitTemperature(ch, collector.zoneTemperature, collector.zoneTemperatureFahrenheit, zone.celsius, zone.name)
+	}
+}
+
+// thermalZoneReading is one known zone's temperature
+type thermalZoneReading struct {
+	name    string
+	celsius float64
+}
+
+// parseThermalZones picks the known thermal zones out of the SMC key values
+func parseThermalZones(keys map[string]float64) []thermalZoneReading {
+	var zones []thermalZoneReading
+	for key, name := range thermalZones {
+		if value, ok := keys[key]; ok {
+			zones = append(zones, thermalZoneReading{name: name, celsius: value})
+		}
+	}
+	return zones
+}
@@ -0,0 +1,97 @@
+package collector
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"regexp"
+	"strconv"
+
+	"mac-powermetrics-exporter/internal/config"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// ThrottleCollector collects the CPU speed limit macOS applies under thermal
+// or power pressure. Apple Silicon Macs rarely report a speed limit; the
+// powermetrics collector reports their thermal pressure level instead.
+type ThrottleCollector struct {
+	config *config.Config
+	runner commandRunner
+
+	speedLimit          *prometheus.Desc
+	speedLimitAvailable *prometheus.Desc
+}
+
+func init() {
+	Register("throttle", "pmset", func(cfg *config.Config) prometheus.Collector { return NewThrottleCollector(cfg) })
+}
+
+// NewThrottleCollector creates a new ThrottleCollector
+func NewThrottleCollector(cfg *config.Config) *ThrottleCollector {
+	return &ThrottleCollector{
+		config: cfg,
+		runner: execRunner{},
+		speedLimit: prometheus.NewDesc(
+			prometheus.BuildFQName(cfg.Namespace, "system", "cpu_speed_limit_percent"),
+			"CPU speed limit imposed by thermal or power throttling in percent; 100 means unthrottled.",
+			nil,
+			cfg.ConstLabels,
+		),
+		speedLimitAvailable: prometheus.NewDesc(
+			prometheus.BuildFQName(cfg.Namespace, "system", "cpu_speed_limit_available"),
+			"Whether pmset reported a CPU speed limit (1) or not (0).",
+			nil,
+			cfg.ConstLabels,
+		),
+	}
+}
+
+// Describe describes metrics to Prometheus
+func (collector *ThrottleCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- collector.speedLimit
+	ch <- collector.speedLimitAvailable
+}
+
+// Collect is called by Prometheus when collecting metrics
+func (collector *ThrottleCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := scrapeContext(collector.config)
+	defer cancel()
+	out, err := collector.runner.Run(ctx, "pmset", "-g", "therm")
+	if err != nil {
+		logCommandFailure("Failed to run command", "throttle", commandLine("pmset", "-g", "therm"), err, commandStderr(err))
+		return
+	}
+
+	// Only reported once the system has recorded a CPU power notification,
+	// which Apple Silicon Macs may never do
+	if limit, ok := parseCPUSpeedLimit(bytes.NewReader(out)); ok {
+		ch <- prometheus.MustNewConstMetric(collector.speedLimit, prometheus.GaugeValue, limit)
+		ch <- prometheus.MustNewConstMetric(collector.speedLimitAvailable, prometheus.GaugeValue, 1)
+		return
+	}
+	ch <- prometheus.MustNewConstMetric(collector.speedLimitAvailable, prometheus.GaugeValue, 0)
+}
+
+// speedLimitPattern matches the speed limit line of `pmset -g therm`, e.g.
+//
+//	CPU_Speed_Limit 	= 100
+var speedLimitPattern = regexp.MustCompile(`^\s*CPU_Speed_Limit\s*=\s*(\d+)`)
+
+// parseCPUSpeedLimit returns the CPU speed limit in percent from
+// `pmset -g therm` output
+func parseCPUSpeedLimit(r io.Reader) (float64, bool) {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		match := speedLimitPattern.FindStringSubmatch(scanner.Text())
+		if match == nil {
+			continue
+		}
+		limit, err := strconv.ParseFloat(match[1], 64)
+		if err != nil {
+			return 0, false
+		}
+		return limit, true
+	}
+	return 0, false
+}
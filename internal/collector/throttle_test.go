@@ -0,0 +1,62 @@
+package collector
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"mac-powermetrics-exporter/internal/config"
+)
+
+func TestParseCPUSpeedLimit(t *testing.T) {
+	f, err := os.Open("testdata/pmset_therm.txt")
+	if err != nil {
+		t.Fatalf("Failed to open fixture: %v", err)
+	}
+	defer f.Close()
+
+	if limit, ok := parseCPUSpeedLimit(f); !ok || limit != 72 {
+		t.Errorf("Expected a speed limit of 72, got %v (ok=%v)", limit, ok)
+	}
+
+	// Macs that never recorded a CPU power notification print only the notes
+	notes := "Note: No thermal warning level has been recorded\nNote: No performance warning level has been recorded\n"
+	if limit, ok := parseCPUSpeedLimit(strings.NewReader(notes)); ok {
+		t.Errorf("Expected no speed limit, got %v", limit)
+	}
+}
+
+func TestThrottleCollector(t *testing.T) {
+	data, err := os.ReadFile("testdata/pmset_therm.txt")
+	if err != nil {
+		t.Fatalf("Failed to read fixture: %v", err)
+	}
+	collector := NewThrottleCollector(config.New())
+	collector.runner = fakeRunner{"pmset -g therm": {stdout: string(data)}}
+
+	values := gatherValues(t, collector)
+	if got := values["system_cpu_speed_limit_percent"]; got != 72 {
+		t.Errorf("Expected a speed limit of 72, got %v", got)
+	}
+	if got := values["system_cpu_speed_limit_available"]; got != 1 {
+		t.Errorf("Expected the speed limit to be available, got %v", got)
+	}
+
+	// A failing pmset reports nothing
+	collector.runner = fakeRunner{}
+	if values := gatherValues(t, collector); len(values) != 0 {
+		t.Errorf("Expected no metrics, got %v", values)
+	}
+}
+
+func TestThrottleCollectorWithoutSpeedLimit(t *testing.T) {
+	notes := "Note: No thermal warning level has been recorded\nNote: No performance warning level has been recorded\n"
+	collector := NewThrottleCollector(config.New())
+	// Only pmset is run; the thermal pressure comes from the powermetrics collector
+	collector.runner = fakeRunner{"pmset -g therm": {stdout: notes}}
+
+	values := gatherValues(t, collector)
+	if len(values) != 1 || values["system_cpu_speed_limit_available"] != 0 {
+		t.Errorf("Expected only the unavailable speed limit, got %v", values)
+	}
+}
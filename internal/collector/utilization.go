@@ -0,0 +1,69 @@
+package collector
+
+import (
+	"math"
+	"sort"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// summaryQuantiles are the quantiles reported by utilization summaries
+var summaryQuantiles = []float64{0.5, 0.9, 0.99}
+
+// utilizationWindow buffers GPU and ANE usage observations between scrapes
+type utilizationWindow struct {
+	mu  sync.Mutex
+	gpu []float64
+	ane []float64
+}
+
+// observe records the GPU and ANE usage of a sample, if present
+func (w *utilizationWindow) observe(sample *PowermetricsSample) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if sample.GPUActiveResidency != nil {
+		w.gpu = append(w.gpu, *sample.GPUActiveResidency)
+	}
+	if sample.ANEActiveResidency != nil {
+		w.ane = append(w.ane, *sample.ANEActiveResidency)
+	}
+}
+
+// drain returns the buffered observations and starts a new window
+func (w *utilizationWindow) drain() (gpu, ane []float64) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	gpu, ane = w.gpu, w.ane
+	w.gpu, w.ane = nil, nil
+	return gpu, ane
+}
+
+// newQuantileSummary builds a const summary over values. Quantiles of an
+// empty window are NaN, matching client_golang's own summaries.
+func newQuantileSummary(desc *prometheus.Desc, values []float64) prometheus.Metric {
+	var sum float64
+	for _, v := range values {
+		sum += v
+	}
+	return prometheus.MustNewConstSummary(desc, uint64(len(values)), sum, quantiles(values, summaryQuantiles))
+}
+
+// quantiles computes the nearest-rank quantiles of values
+func quantiles(values []float64, qs []float64) map[float64]float64 {
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+
+	result := make(map[float64]float64, len(qs))
+	for _, q := range qs {
+		if len(sorted) == 0 {
+			result[q] = math.NaN()
+			continue
+		}
+		rank := int(math.Ceil(q*float64(len(sorted)))) - 1
+		result[q] = sorted[max(rank, 0)]
+	}
+	return result
+}
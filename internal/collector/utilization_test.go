@@ -0,0 +1,116 @@
+package collector
+
+import (
+	"math"
+	"testing"
+
+	"mac-powermetrics-exporter/internal/config"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestUtilizationSummaries(t *testing.T) {
+	cfg := config.New()
+	cfg.PowermetricsMode = config.PowermetricsModeBackground
+	cfg.UtilizationSummaries = true
+	collector := NewPowermetricsCollector(cfg)
+
+	// GPU usage 1..100 and a burst of ANE usage in 10 of the samples
+	for i := 1; i <= 100; i++ {
+		gpu := float64(i)
+		sample := &PowermetricsSample{GPUActiveResidency: &gpu}
+		if i > 90 {
+			ane := 80.0
+			sample.ANEActiveResidency = &ane
+		}
+		collector.record(sample)
+	}
+
+	summaries := gatherSummaries(t, collector)
+	gpu := summaries["powermetrics_gpu_usage_percent"]
+	if gpu.count != 100 || gpu.sum != 5050 {
+		t.Errorf("GPU summary: expected count 100 and sum 5050, got %d and %v", gpu.count, gpu.sum)
+	}
+	for q, want := range map[float64]float64{0.5: 50, 0.9: 90, 0.99: 99} {
+		if got := gpu.quantiles[q]; got != want {
+			t.Errorf("GPU p%v: expected %v, got %v", q*100, want, got)
+		}
+	}
+	ane := summaries["powermetrics_ane_usage_distribution_percent"]
+	if ane.count != 10 || ane.quantiles[0.5] != 80 {
+		t.Errorf("ANE summary: expected 10 observations at 80, got %d with p50 %v", ane.count, ane.quantiles[0.5])
+	}
+
+	// The window resets on every scrape
+	summaries = gatherSummaries(t, collector)
+	if gpu := summaries["powermetrics_gpu_usage_percent"]; gpu.count != 0 || !math.IsNaN(gpu.quantiles[0.5]) {
+		t.Errorf("Expected an empty GPU summary after reset, got count %d p50 %v", gpu.count, gpu.quantiles[0.5])
+	}
+}
+
+func TestPowerSummaries(t *testing.T) {
+	cfg := config.New()
+	cfg.PowermetricsMode = config.PowermetricsModeBackground
+	cfg.PowerSummaries = true
+	collector := NewPowermetricsCollector(cfg)
+
+	for i := 1; i <= 100; i++ {
+		cpu, gpu := float64(i*10), 5.0
+		collector.record(&PowermetricsSample{CPUPower: &cpu, GPUPower: &gpu})
+	}
+
+	summaries := gatherSummaries(t, collector)
+	cpu := summaries["powermetrics_cpu_power_distribution_milliwatts"]
+	if cpu.count != 100 || cpu.sum != 50500 {
+		t.Errorf("CPU summary: expected count 100 and sum 50500, got %d and %v", cpu.count, cpu.sum)
+	}
+	if p50 := cpu.quantiles[0.5]; p50 < 450 || p50 > 550 {
+		t.Errorf("CPU p50: expected about 500, got %v", p50)
+	}
+	if gpu := summaries["powermetrics_gpu_power_distribution_milliwatts"]; gpu.count != 100 || gpu.quantiles[0.99] != 5 {
+		t.Errorf("GPU summary: expected 100 observations at 5, got %d with p99 %v", gpu.count, gpu.quantiles[0.99])
+	}
+
+	// Unlike the utilization summaries, observations outlive a scrape
+	if cpu := gatherSummaries(t, collector)["powermetrics_cpu_power_distribution_milliwatts"]; cpu.count != 100 {
+		t.Errorf("Expected the CPU summary to keep its observations, got count %d", cpu.count)
+	}
+}
+
+// gatheredSummary holds the values of a gathered summary metric
+type gatheredSummary struct {
+	count     uint64
+	sum       float64
+	quantiles map[float64]float64
+}
+
+// gatherSummaries collects c and returns its summaries keyed by metric name
+func gatherSummaries(t *testing.T, c prometheus.Collector) map[string]gatheredSummary {
+	t.Helper()
+
+	reg := prometheus.NewPedanticRegistry()
+	reg.MustRegister(c)
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatalf("Failed to gather metrics: %v", err)
+	}
+
+	summaries := make(map[string]gatheredSummary)
+	for _, family := range families {
+		for _, m := range family.GetMetric() {
+			if m.GetSummary() == nil {
+				continue
+			}
+			s := gatheredSummary{
+				count:     m.GetSummary().GetSampleCount(),
+				sum:       m.GetSummary().GetSampleSum(),
+				quantiles: make(map[float64]float64),
+			}
+			for _, q := range m.GetSummary().GetQuantile() {
+				s.quantiles[q.GetQuantile()] = q.GetValue()
+			}
+			summaries[family.GetName()] = s
+		}
+	}
+	return summaries
+}
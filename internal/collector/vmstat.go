@@ -3,17 +3,29 @@ package collector
 import (
 	"bufio"
 	"bytes"
-	"log"
-	"os/exec"
+	"context"
+	"io"
 	"strconv"
 	"strings"
+	"sync"
 	"syscall"
+	"time"
+	"unicode"
+
+	"mac-powermetrics-exporter/internal/config"
+	"mac-powermetrics-exporter/internal/logging"
 
 	"github.com/prometheus/client_golang/prometheus"
 )
 
 // VmStatCollector collects vm_stat information
 type VmStatCollector struct {
+	config *config.Config
+	runner commandRunner
+
+	pageInRate  counterRate
+	pageOutRate counterRate
+
 	freePages        *prometheus.Desc
 	activePages      *prometheus.Desc
 	inactivePages    *prometheus.Desc
@@ -27,8 +39,8 @@ type VmStatCollector struct {
 	purged           *prometheus.Desc
 	fileBacked       *prometheus.Desc
 	anonymous        *prometheus.Desc
-	uncompressed     *prometheus.Desc
 	compressor       *prometheus.Desc
+	usedByCompressor *prometheus.Desc
 	decompressed     *prometheus.Desc
 	compressed       *prometheus.Desc
 	pageIns          *prometheus.Desc
@@ -37,125 +49,216 @@ type VmStatCollector struct {
 	swapIns          *prometheus.Desc
 	swapOuts         *prometheus.Desc
 	pageSize         *prometheus.Desc
+	pageInBytesRate  *prometheus.Desc
+	pageOutBytesRate *prometheus.Desc
+
+	freeBytes       *prometheus.Desc
+	activeBytes     *prometheus.Desc
+	inactiveBytes   *prometheus.Desc
+	wiredBytes      *prometheus.Desc
+	compressorBytes *prometheus.Desc
+
+	swapTotalBytes *prometheus.Desc
+	swapUsedBytes  *prometheus.Desc
+	swapFreeBytes  *prometheus.Desc
+
+	memoryPressure *prometheus.Desc
+
+	memoryTotal *prometheus.Desc
+	memoryUsed  *prometheus.Desc
+
+	// missingKeys records the vm_stat keys already logged as missing
+	missingKeys sync.Map
+}
+
+func init() {
+	Register("vmstat", "vm_stat", func(cfg *config.Config) prometheus.Collector { return NewVmStatCollector(cfg) })
 }
 
 // NewVmStatCollector creates a new VmStatCollector
-func NewVmStatCollector() *VmStatCollector {
+func NewVmStatCollector(cfg *config.Config) *VmStatCollector {
 	return &VmStatCollector{
+		config: cfg,
+		runner: execRunner{},
 		freePages: prometheus.NewDesc(
-			"vmstat_pages_free_count",
+			prometheus.BuildFQName(cfg.Namespace, "vmstat", "pages_free_count"),
 			"Number of free pages.",
-			nil, nil,
+			nil, cfg.ConstLabels,
 		),
 		activePages: prometheus.NewDesc(
-			"vmstat_pages_active_count",
+			prometheus.BuildFQName(cfg.Namespace, "vmstat", "pages_active_count"),
 			"Number of active pages.",
-			nil, nil,
+			nil, cfg.ConstLabels,
 		),
 		inactivePages: prometheus.NewDesc(
-			"vmstat_pages_inactive_count",
+			prometheus.BuildFQName(cfg.Namespace, "vmstat", "pages_inactive_count"),
 			"Number of inactive pages.",
-			nil, nil,
+			nil, cfg.ConstLabels,
 		),
 		speculativePages: prometheus.NewDesc(
-			"vmstat_pages_speculative_count",
+			prometheus.BuildFQName(cfg.Namespace, "vmstat", "pages_speculative_count"),
 			"Number of speculative pages.",
-			nil, nil,
+			nil, cfg.ConstLabels,
 		),
 		throttledPages: prometheus.NewDesc(
-			"vmstat_pages_throttled_count",
+			prometheus.BuildFQName(cfg.Namespace, "vmstat", "pages_throttled_count"),
 			"Number of throttled pages.",
-			nil, nil,
+			nil, cfg.ConstLabels,
 		),
 		wiredPages: prometheus.NewDesc(
-			"vmstat_pages_wired_count",
+			prometheus.BuildFQName(cfg.Namespace, "vmstat", "pages_wired_count"),
 			"Number of wired down pages.",
-			nil, nil,
+			nil, cfg.ConstLabels,
 		),
 		purgeablePages: prometheus.NewDesc(
-			"vmstat_pages_purgeable_count",
+			prometheus.BuildFQName(cfg.Namespace, "vmstat", "pages_purgeable_count"),
 			"Number of purgeable pages.",
-			nil, nil,
+			nil, cfg.ConstLabels,
 		),
 		copyOnWrite: prometheus.NewDesc(
-			"vmstat_pages_cow_faults_total",
+			prometheus.BuildFQName(cfg.Namespace, "vmstat", "pages_cow_faults_total"),
 			"Number of copy-on-write faults.",
-			nil, nil,
+			nil, cfg.ConstLabels,
 		),
 		zeroFilled: prometheus.NewDesc(
-			"vmstat_pages_zero_filled_total",
+			prometheus.BuildFQName(cfg.Namespace, "vmstat", "pages_zero_filled_total"),
 			"Number of pages zero filled.",
-			nil, nil,
+			nil, cfg.ConstLabels,
 		),
 		reactivated: prometheus.NewDesc(
-			"vmstat_pages_reactivated_total",
+			prometheus.BuildFQName(cfg.Namespace, "vmstat", "pages_reactivated_total"),
 			"Number of pages reactivated.",
-			nil, nil,
+			nil, cfg.ConstLabels,
 		),
 		purged: prometheus.NewDesc(
-			"vmstat_pages_purged_total",
+			prometheus.BuildFQName(cfg.Namespace, "vmstat", "pages_purged_total"),
 			"Number of pages purged.",
-			nil, nil,
+			nil, cfg.ConstLabels,
 		),
 		fileBacked: prometheus.NewDesc(
-			"vmstat_pages_file_backed_count",
+			prometheus.BuildFQName(cfg.Namespace, "vmstat", "pages_file_backed_count"),
 			"Number of pages file-backed.",
-			nil, nil,
+			nil, cfg.ConstLabels,
 		),
 		anonymous: prometheus.NewDesc(
-			"vmstat_pages_anonymous_count",
+			prometheus.BuildFQName(cfg.Namespace, "vmstat", "pages_anonymous_count"),
 			"Number of pages anonymous.",
-			nil, nil,
-		),
-		uncompressed: prometheus.NewDesc(
-			"vmstat_pages_uncompressed_total",
-			"Number of pages uncompressed.",
-			nil, nil,
+			nil, cfg.ConstLabels,
 		),
 		compressor: prometheus.NewDesc(
-			"vmstat_pages_compressor_count",
-			"Number of pages used by compressor.",
-			nil, nil,
+			prometheus.BuildFQName(cfg.Namespace, "vmstat", "pages_compressor_count"),
+			"Number of pages stored in compressor.",
+			nil, cfg.ConstLabels,
+		),
+		usedByCompressor: prometheus.NewDesc(
+			prometheus.BuildFQName(cfg.Namespace, "vmstat", "pages_used_by_compressor_count"),
+			"Number of physical pages used by compressor to hold the compressed pages.",
+			nil, cfg.ConstLabels,
 		),
 		decompressed: prometheus.NewDesc(
-			"vmstat_pages_decompressed_total",
+			prometheus.BuildFQName(cfg.Namespace, "vmstat", "pages_decompressed_total"),
 			"Number of pages decompressed.",
-			nil, nil,
+			nil, cfg.ConstLabels,
 		),
 		compressed: prometheus.NewDesc(
-			"vmstat_pages_compressed_total",
+			prometheus.BuildFQName(cfg.Namespace, "vmstat", "pages_compressed_total"),
 			"Number of pages compressed.",
-			nil, nil,
+			nil, cfg.ConstLabels,
 		),
 		pageIns: prometheus.NewDesc(
-			"vmstat_page_ins_total",
+			prometheus.BuildFQName(cfg.Namespace, "vmstat", "page_ins_total"),
 			"Number of pageins.",
-			nil, nil,
+			nil, cfg.ConstLabels,
 		),
 		pageOuts: prometheus.NewDesc(
-			"vmstat_page_outs_total",
+			prometheus.BuildFQName(cfg.Namespace, "vmstat", "page_outs_total"),
 			"Number of pageouts.",
-			nil, nil,
+			nil, cfg.ConstLabels,
 		),
 		faults: prometheus.NewDesc(
-			"vmstat_faults_total",
+			prometheus.BuildFQName(cfg.Namespace, "vmstat", "faults_total"),
 			"Number of page faults.",
-			nil, nil,
+			nil, cfg.ConstLabels,
 		),
 		swapIns: prometheus.NewDesc(
-			"vmstat_swap_ins_total",
+			prometheus.BuildFQName(cfg.Namespace, "vmstat", "swap_ins_total"),
 			"Number of swapins.",
-			nil, nil,
+			nil, cfg.ConstLabels,
 		),
 		swapOuts: prometheus.NewDesc(
-			"vmstat_swap_outs_total",
+			prometheus.BuildFQName(cfg.Namespace, "vmstat", "swap_outs_total"),
 			"Number of swapouts.",
-			nil, nil,
+			nil, cfg.ConstLabels,
 		),
 		pageSize: prometheus.NewDesc(
-			"vmstat_page_size_bytes",
+			prometheus.BuildFQName(cfg.Namespace, "vmstat", "page_size_bytes"),
 			"Size of pages in bytes.",
-			nil, nil,
+			nil, cfg.ConstLabels,
+		),
+		pageInBytesRate: prometheus.NewDesc(
+			prometheus.BuildFQName(cfg.Namespace, "vmstat", "page_ins_bytes_per_sec"),
+			"Rate of pageins in bytes per second since the previous scrape.",
+			nil, cfg.ConstLabels,
+		),
+		pageOutBytesRate: prometheus.NewDesc(
+			prometheus.BuildFQName(cfg.Namespace, "vmstat", "page_outs_bytes_per_sec"),
+			"Rate of pageouts in bytes per second since the previous scrape.",
+			nil, cfg.ConstLabels,
+		),
+		freeBytes: prometheus.NewDesc(
+			prometheus.BuildFQName(cfg.Namespace, "vmstat", "memory_free_bytes"),
+			"Free memory in bytes.",
+			nil, cfg.ConstLabels,
+		),
+		activeBytes: prometheus.NewDesc(
+			prometheus.BuildFQName(cfg.Namespace, "vmstat", "memory_active_bytes"),
+			"Active memory in bytes.",
+			nil, cfg.ConstLabels,
+		),
+		inactiveBytes: prometheus.NewDesc(
+			prometheus.BuildFQName(cfg.Namespace, "vmstat", "memory_inactive_bytes"),
+			"Inactive memory in bytes.",
+			nil, cfg.ConstLabels,
+		),
+		wiredBytes: prometheus.NewDesc(
+			prometheus.BuildFQName(cfg.Namespace, "vmstat", "memory_wired_bytes"),
+			"Wired down memory in bytes.",
+			nil, cfg.ConstLabels,
+		),
+		compressorBytes: prometheus.NewDesc(
+			prometheus.BuildFQName(cfg.Namespace, "vmstat", "memory_compressor_bytes"),
+			"Physical memory used by compressor in bytes.",
+			nil, cfg.ConstLabels,
+		),
+		swapTotalBytes: prometheus.NewDesc(
+			prometheus.BuildFQName(cfg.Namespace, "vmstat", "swap_total_bytes"),
+			"Total swap space in bytes.",
+			nil, cfg.ConstLabels,
+		),
+		swapUsedBytes: prometheus.NewDesc(
+			prometheus.BuildFQName(cfg.Namespace, "vmstat", "swap_used_bytes"),
+			"Used swap space in bytes.",
+			nil, cfg.ConstLabels,
+		),
+		swapFreeBytes: prometheus.NewDesc(
+			prometheus.BuildFQName(cfg.Namespace, "vmstat", "swap_free_bytes"),
+			"Free swap space in bytes.",
+			nil, cfg.ConstLabels,
+		),
+		memoryPressure: prometheus.NewDesc(
+			prometheus.BuildFQName(cfg.Namespace, "system", "memory_pressure_level"),
+			"Kernel memory pressure level: 1 (normal), 2 (warn) or 4 (critical).",
+			[]string{"level"}, cfg.ConstLabels,
+		),
+		memoryTotal: prometheus.NewDesc(
+			prometheus.BuildFQName(cfg.Namespace, "system", "memory_total_bytes"),
+			"Physical memory in bytes.",
+			nil, cfg.ConstLabels,
+		),
+		memoryUsed: prometheus.NewDesc(
+			prometheus.BuildFQName(cfg.Namespace, "system", "memory_used_bytes"),
+			"Used memory in bytes: active, wired and compressor-occupied pages.",
+			nil, cfg.ConstLabels,
 		),
 	}
 }
@@ -175,8 +278,8 @@ func (collector *VmStatCollector) Describe(ch chan<- *prometheus.Desc) {
 	ch <- collector.purged
 	ch <- collector.fileBacked
 	ch <- collector.anonymous
-	ch <- collector.uncompressed
 	ch <- collector.compressor
+	ch <- collector.usedByCompressor
 	ch <- collector.decompressed
 	ch <- collector.compressed
 	ch <- collector.pageIns
@@ -185,6 +288,21 @@ func (collector *VmStatCollector) Describe(ch chan<- *prometheus.Desc) {
 	ch <- collector.swapIns
 	ch <- collector.swapOuts
 	ch <- collector.pageSize
+	if collector.config.VmStatThroughput {
+		ch <- collector.pageInBytesRate
+		ch <- collector.pageOutBytesRate
+	}
+	ch <- collector.freeBytes
+	ch <- collector.activeBytes
+	ch <- collector.inactiveBytes
+	ch <- collector.wiredBytes
+	ch <- collector.compressorBytes
+	ch <- collector.swapTotalBytes
+	ch <- collector.swapUsedBytes
+	ch <- collector.swapFreeBytes
+	ch <- collector.memoryPressure
+	ch <- collector.memoryTotal
+	ch <- collector.memoryUsed
 }
 
 // Collect is called by Prometheus when collecting metrics
@@ -193,100 +311,322 @@ func (collector *VmStatCollector) Collect(ch chan<- prometheus.Metric) {
 	pageSize := syscall.Getpagesize()
 	ch <- prometheus.MustNewConstMetric(collector.pageSize, prometheus.GaugeValue, float64(pageSize))
 
-	cmd := exec.Command("vm_stat")
-	var out bytes.Buffer
-	cmd.Stdout = &out
-	err := cmd.Run()
+	ctx, cancel := scrapeContext(collector.config)
+	defer cancel()
+	collector.collectSwap(ctx, ch)
+	collector.collectMemoryPressure(ctx, ch)
+	if total, ok := readSysctlInt(ctx, collector.runner, "vmstat", "hw.memsize"); ok {
+		ch <- prometheus.MustNewConstMetric(collector.memoryTotal, prometheus.GaugeValue, total)
+	} else {
+		logging.Failuref("Failed to read hw.memsize")
+	}
+
+	out, err := collector.runner.Run(ctx, "vm_stat")
 	if err != nil {
-		log.Printf("Failed to run vm_stat: %v", err)
+		logCommandFailure("Failed to run command", "vmstat", commandLine("vm_stat"), err, commandStderr(err))
 		return
 	}
+	now := time.Now()
 
-	scanner := bufio.NewScanner(strings.NewReader(out.String()))
-	valueMap := make(map[string]float64)
-
-	for scanner.Scan() {
-		line := scanner.Text()
-		parts := strings.SplitN(line, ":", 2)
-		if len(parts) != 2 {
-			continue
-		}
-		key := strings.TrimSpace(parts[0])
-		valueStr := strings.TrimRight(strings.TrimSpace(parts[1]), ".") // Remove trailing period
-
-		value, err := strconv.ParseFloat(valueStr, 64)
-		if err != nil {
-			// Ignore header lines like "Mach Virtual Memory Statistics"
-			continue
-		}
-		valueMap[key] = value
-	}
+	values := newVmStatValues(parseVmStat(bytes.NewReader(out)))
 
-	if val, ok := valueMap["Pages free"]; ok {
+	if val, ok := collector.lookup(values, "Pages free"); ok {
 		ch <- prometheus.MustNewConstMetric(collector.freePages, prometheus.GaugeValue, val)
+		ch <- prometheus.MustNewConstMetric(collector.freeBytes, prometheus.GaugeValue, val*float64(pageSize))
 	}
-	if val, ok := valueMap["Pages active"]; ok {
+	if val, ok := collector.lookup(values, "Pages active"); ok {
 		ch <- prometheus.MustNewConstMetric(collector.activePages, prometheus.GaugeValue, val)
+		ch <- prometheus.MustNewConstMetric(collector.activeBytes, prometheus.GaugeValue, val*float64(pageSize))
 	}
-	if val, ok := valueMap["Pages inactive"]; ok {
+	if val, ok := collector.lookup(values, "Pages inactive"); ok {
 		ch <- prometheus.MustNewConstMetric(collector.inactivePages, prometheus.GaugeValue, val)
+		ch <- prometheus.MustNewConstMetric(collector.inactiveBytes, prometheus.GaugeValue, val*float64(pageSize))
 	}
-	if val, ok := valueMap["Pages speculative"]; ok {
+	if val, ok := collector.lookup(values, "Pages speculative"); ok {
 		ch <- prometheus.MustNewConstMetric(collector.speculativePages, prometheus.GaugeValue, val)
 	}
-	if val, ok := valueMap["Pages throttled"]; ok {
+	if val, ok := collector.lookup(values, "Pages throttled"); ok {
 		ch <- prometheus.MustNewConstMetric(collector.throttledPages, prometheus.GaugeValue, val)
 	}
-	if val, ok := valueMap["Pages wired down"]; ok { // "wired down" is the key
+	if val, ok := collector.lookup(values, "Pages wired down"); ok {
 		ch <- prometheus.MustNewConstMetric(collector.wiredPages, prometheus.GaugeValue, val)
+		ch <- prometheus.MustNewConstMetric(collector.wiredBytes, prometheus.GaugeValue, val*float64(pageSize))
 	}
-	if val, ok := valueMap["Pages purgeable"]; ok {
+	if val, ok := collector.lookup(values, "Pages purgeable"); ok {
 		ch <- prometheus.MustNewConstMetric(collector.purgeablePages, prometheus.GaugeValue, val)
 	}
-	if val, ok := valueMap["Copy-on-writes"]; ok { // "Copy-on-writes" is the key
+	if val, ok := collector.lookup(values, "Copy-on-writes", "Pages copy-on-write"); ok {
 		ch <- prometheus.MustNewConstMetric(collector.copyOnWrite, prometheus.CounterValue, val)
 	}
-	if val, ok := valueMap["Pages zero filled"]; ok {
+	if val, ok := collector.lookup(values, "Pages zero filled"); ok {
 		ch <- prometheus.MustNewConstMetric(collector.zeroFilled, prometheus.CounterValue, val)
 	}
-	if val, ok := valueMap["Pages reactivated"]; ok {
+	if val, ok := collector.lookup(values, "Pages reactivated"); ok {
 		ch <- prometheus.MustNewConstMetric(collector.reactivated, prometheus.CounterValue, val)
 	}
-	if val, ok := valueMap["Pages purged"]; ok {
+	if val, ok := collector.lookup(values, "Pages purged"); ok {
 		ch <- prometheus.MustNewConstMetric(collector.purged, prometheus.CounterValue, val)
 	}
-	if val, ok := valueMap["File-backed pages"]; ok { // "File-backed pages" is the key
+	if val, ok := collector.lookup(values, "File-backed pages"); ok {
 		ch <- prometheus.MustNewConstMetric(collector.fileBacked, prometheus.GaugeValue, val)
 	}
-	if val, ok := valueMap["Anonymous pages"]; ok { // "Anonymous pages" is the key
+	if val, ok := collector.lookup(values, "Anonymous pages"); ok {
 		ch <- prometheus.MustNewConstMetric(collector.anonymous, prometheus.GaugeValue, val)
 	}
-	if val, ok := valueMap["Pages stored in compressor"]; ok { // "Pages stored in compressor" is the key
+	if val, ok := collector.lookup(values, "Pages stored in compressor"); ok {
 		ch <- prometheus.MustNewConstMetric(collector.compressor, prometheus.GaugeValue, val)
 	}
-	// if val, ok := valueMap["Pages used by compressor"]; ok { // Need to verify if this key exists in vm_stat output (possible duplication)
-	// 	// Consider using collector.compressor or defining a new metric
-	// }
-	if val, ok := valueMap["Pages decompressed"]; ok {
+	// Recent macOS prints "Pages occupied by compressor"; older releases used "Pages used by compressor"
+	if usedByCompressor, ok := collector.lookup(values, "Pages occupied by compressor", "Pages used by compressor"); ok {
+		ch <- prometheus.MustNewConstMetric(collector.usedByCompressor, prometheus.GaugeValue, usedByCompressor)
+		ch <- prometheus.MustNewConstMetric(collector.compressorBytes, prometheus.GaugeValue, usedByCompressor*float64(pageSize))
+	}
+	// vm_stat has no separate uncompressed-pages counter; decompressions are the closest source
+	if val, ok := collector.lookup(values, "Pages decompressed", "Decompressions"); ok {
 		ch <- prometheus.MustNewConstMetric(collector.decompressed, prometheus.CounterValue, val)
 	}
-	if val, ok := valueMap["Pages compressed"]; ok {
+	if val, ok := collector.lookup(values, "Pages compressed", "Compressions"); ok {
 		ch <- prometheus.MustNewConstMetric(collector.compressed, prometheus.CounterValue, val)
 	}
-	if val, ok := valueMap["Pageins"]; ok {
+	if val, ok := collector.lookup(values, "Pageins"); ok {
 		ch <- prometheus.MustNewConstMetric(collector.pageIns, prometheus.CounterValue, val)
+		if collector.config.VmStatThroughput {
+			if rate, ok := collector.pageInRate.update(val, now); ok {
+				ch <- prometheus.MustNewConstMetric(collector.pageInBytesRate, prometheus.GaugeValue, rate*float64(pageSize))
+			}
+		}
 	}
-	if val, ok := valueMap["Pageouts"]; ok {
+	if val, ok := collector.lookup(values, "Pageouts"); ok {
 		ch <- prometheus.MustNewConstMetric(collector.pageOuts, prometheus.CounterValue, val)
+		if collector.config.VmStatThroughput {
+			if rate, ok := collector.pageOutRate.update(val, now); ok {
+				ch <- prometheus.MustNewConstMetric(collector.pageOutBytesRate, prometheus.GaugeValue, rate*float64(pageSize))
+			}
+		}
 	}
-	if val, ok := valueMap["Swapins"]; ok {
+	if val, ok := collector.lookup(values, "Swapins"); ok {
 		ch <- prometheus.MustNewConstMetric(collector.swapIns, prometheus.CounterValue, val)
 	}
-	if val, ok := valueMap["Swapouts"]; ok {
+	if val, ok := collector.lookup(values, "Swapouts"); ok {
 		ch <- prometheus.MustNewConstMetric(collector.swapOuts, prometheus.CounterValue, val)
 	}
-	// "Faults" is often displayed as "Page faults" in vm_stat output, so consider both
-	if val, ok := valueMap["Page faults"]; ok {
+	// vm_stat prints page faults as "Translation faults", quoted
+	if val, ok := collector.lookup(values, "Page faults", "Translation faults"); ok {
 		ch <- prometheus.MustNewConstMetric(collector.faults, prometheus.CounterValue, val)
 	}
+
+	if used, ok := collector.usedPages(values); ok {
+		ch <- prometheus.MustNewConstMetric(collector.memoryUsed, prometheus.GaugeValue, used*float64(pageSize))
+	}
+}
+
+// usedPages returns the pages in use the way Activity Monitor's "Memory Used"
+// counts them: active (app memory), wired and occupied by the compressor
+func (collector *VmStatCollector) usedPages(values vmStatValues) (float64, bool) {
+	active, ok := collector.lookup(values, "Pages active")
+	if !ok {
+		return 0, false
+	}
+	wired, ok := collector.lookup(values, "Pages wired down")
+	if !ok {
+		return 0, false
+	}
+	compressor, ok := collector.lookup(values, "Pages occupied by compressor", "Pages used by compressor")
+	if !ok {
+		return 0, false
+	}
+	return active + wired + compressor, true
+}
+
+// collectSwap emits the swap totals reported by sysctl vm.swapusage, which
+// vm_stat doesn't print
+func (collector *VmStatCollector) collectSwap(ctx context.Context, ch chan<- prometheus.Metric) {
+	out, err := collector.runner.Run(ctx, "sysctl", "-n", "vm.swapusage")
+	if err != nil {
+		logCommandFailure("Failed to run command", "vmstat", commandLine("sysctl", "-n", "vm.swapusage"), err, commandStderr(err))
+		return
+	}
+
+	swap, ok := parseSwapUsage(string(out))
+	if !ok {
+		logging.Failuref("Failed to parse vm.swapusage: %q", string(out))
+		return
+	}
+	ch <- prometheus.MustNewConstMetric(collector.swapTotalBytes, prometheus.GaugeValue, swap.total)
+	ch <- prometheus.MustNewConstMetric(collector.swapUsedBytes, prometheus.GaugeValue, swap.used)
+	ch <- prometheus.MustNewConstMetric(collector.swapFreeBytes, prometheus.GaugeValue, swap.free)
+}
+
+// memoryPressureLevels names the kern.memorystatus_vm_pressure_level values
+var memoryPressureLevels = map[int]string{
+	1: "normal",
+	2: "warn",
+	4: "critical",
+}
+
+// collectMemoryPressure emits the kernel memory pressure level, the signal
+// macOS itself uses to ask apps to free memory
+func (collector *VmStatCollector) collectMemoryPressure(ctx context.Context, ch chan<- prometheus.Metric) {
+	out, err := collector.runner.Run(ctx, "sysctl", "-n", "kern.memorystatus_vm_pressure_level")
+	if err != nil {
+		logCommandFailure("Failed to run command", "vmstat", commandLine("sysctl", "-n", "kern.memorystatus_vm_pressure_level"), err, commandStderr(err))
+		return
+	}
+
+	level, name, ok := parseMemoryPressure(string(out))
+	if !ok {
+		logging.Failuref("Failed to parse kern.memorystatus_vm_pressure_level: %q", string(out))
+		return
+	}
+	ch <- prometheus.MustNewConstMetric(collector.memoryPressure, prometheus.GaugeValue, float64(level), name)
+}
+
+// parseMemoryPressure parses the memory pressure level and returns it with
+// its name, or "unknown" for levels without one
+func parseMemoryPressure(s string) (int, string, bool) {
+	level, err := strconv.Atoi(strings.TrimSpace(s))
+	if err != nil {
+		return 0, "", false
+	}
+	name, ok := memoryPressureLevels[level]
+	if !ok {
+		name = "unknown"
+	}
+	return level, name, true
+}
+
+// swapUsage holds the vm.swapusage sizes in bytes
+type swapUsage struct {
+	total float64
+	used  float64
+	free  float64
+}
+
+// swapUnits maps the vm.swapusage size suffixes to bytes
+var swapUnits = map[byte]float64{
+	'K': 1 << 10,
+	'M': 1 << 20,
+	'G': 1 << 30,
+	'T': 1 << 40,
+}
+
+// parseSwapUsage parses `sysctl -n vm.swapusage` output, e.g.
+// "total = 2048.00M  used = 512.00M  free = 1536.00M  (encrypted)"
+func parseSwapUsage(s string) (swapUsage, bool) {
+	var swap swapUsage
+	found := 0
+	fields := strings.Fields(s)
+	for i := 0; i+2 < len(fields); i++ {
+		if fields[i+1] != "=" {
+			continue
+		}
+		var target *float64
+		switch fields[i] {
+		case "total":
+			target = &swap.total
+		case "used":
+			target = &swap.used
+		case "free":
+			target = &swap.free
+		default:
+			continue
+		}
+		size, ok := parseSwapSize(fields[i+2])
+		if !ok {
+			return swapUsage{}, false
+		}
+		*target = size
+		found++
+	}
+	return swap, found == 3
+}
+
+// parseSwapSize converts a size such as "512.00M" to bytes
+func parseSwapSize(size string) (float64, bool) {
+	if size == "" {
+		return 0, false
+	}
+	multiplier := 1.0
+	if unit, ok := swapUnits[size[len(size)-1]]; ok {
+		multiplier = unit
+		size = size[:len(size)-1]
+	}
+	value, err := strconv.ParseFloat(size, 64)
+	if err != nil {
+		return 0, false
+	}
+	return value * multiplier, true
+}
+
+// vmStatValues holds vm_stat values keyed by the canonical form of their key
+type vmStatValues map[string]float64
+
+// newVmStatValues re-keys the values returned by parseVmStat by canonical key
+func newVmStatValues(raw map[string]float64) vmStatValues {
+	values := make(vmStatValues, len(raw))
+	for key, value := range raw {
+		values[canonicalVmStatKey(key)] = value
+	}
+	return values
+}
+
+// canonicalVmStatKey lowercases key and strips everything but letters, digits
+// and single spaces between words, e.g. "Pages copy-on-write" becomes
+// "pages copyonwrite". Apple rewords keys between releases; this absorbs
+// changes in case, punctuation, quoting and spacing.
+func canonicalVmStatKey(key string) string {
+	var words []string
+	for _, word := range strings.Fields(strings.ToLower(key)) {
+		word = strings.Map(func(r rune) rune {
+			if unicode.IsLetter(r) || unicode.IsDigit(r) {
+				return r
+			}
+			return -1
+		}, word)
+		if word != "" {
+			words = append(words, word)
+		}
+	}
+	return strings.Join(words, " ")
+}
+
+// lookup returns the value of the first of keys present in values. The keys
+// are known wordings of the same vm_stat line. When none is present, which
+// usually means the wording changed again, it is logged once per line.
+func (collector *VmStatCollector) lookup(values vmStatValues, keys ...string) (float64, bool) {
+	for _, key := range keys {
+		if value, ok := values[canonicalVmStatKey(key)]; ok {
+			return value, true
+		}
+	}
+	if _, logged := collector.missingKeys.LoadOrStore(keys[0], true); !logged {
+		logging.Failuref("vm_stat key %q not found, its metrics are skipped", keys[0])
+	}
+	return 0, false
+}
+
+// parseVmStat parses vm_stat output into values keyed by the text before the
+// colon, e.g. "Pages wired down"
+func parseVmStat(r io.Reader) map[string]float64 {
+	scanner := bufio.NewScanner(r)
+	valueMap := make(map[string]float64)
+
+	for scanner.Scan() {
+		line := scanner.Text()
+		parts := strings.SplitN(line, ":", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		key := strings.TrimSpace(parts[0])
+		valueStr := strings.TrimRight(strings.TrimSpace(parts[1]), ".") // Remove trailing period
+
+		value, err := strconv.ParseFloat(valueStr, 64)
+		if err != nil {
+			// Ignore header lines like "Mach Virtual Memory Statistics"
+			continue
+		}
+		valueMap[key] = value
+	}
+
+	return valueMap
 }
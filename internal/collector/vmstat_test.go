@@ -0,0 +1,204 @@
+package collector
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"mac-powermetrics-exporter/internal/config"
+)
+
+func TestParseVmStat(t *testing.T) {
+	f, err := os.Open("testdata/vm_stat.txt")
+	if err != nil {
+		t.Fatalf("Failed to open fixture: %v", err)
+	}
+	defer f.Close()
+
+	values := parseVmStat(f)
+
+	expected := map[string]float64{
+		"Pages free":                 12345,
+		"Pages wired down":           198765,
+		"Pages stored in compressor": 765432,
+		// Distinct from the stored count: the physical pages backing it
+		"Pages occupied by compressor": 234567,
+		"Pageins":                      23456789,
+		"Swapouts":                     65432,
+		// The quoted key is kept verbatim
+		`"Translation faults"`: 987654321,
+	}
+	for key, want := range expected {
+		got, ok := values[key]
+		if !ok {
+			t.Errorf("Expected key %q not found", key)
+			continue
+		}
+		if got != want {
+			t.Errorf("%q: expected %v, got %v", key, want, got)
+		}
+	}
+
+	// The header's colon is followed by non-numeric text
+	if _, ok := values["Mach Virtual Memory Statistics"]; ok {
+		t.Error("Expected the header line to be skipped")
+	}
+}
+
+func TestParseVmStatSpecialKeys(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		key   string
+		want  float64
+	}{
+		{name: "wired down", input: "Pages wired down:   198765.", key: "Pages wired down", want: 198765},
+		{name: "copy-on-writes", input: "Copy-on-writes:   12345678.", key: "Copy-on-writes", want: 12345678},
+		{name: "used by compressor", input: "Pages used by compressor:   234567.", key: "Pages used by compressor", want: 234567},
+		{name: "page faults", input: "Page faults:   987654321.", key: "Page faults", want: 987654321},
+		{name: "trailing period trimmed", input: "Pages free:   42.", key: "Pages free", want: 42},
+		{name: "no trailing period", input: "Pages free:   42", key: "Pages free", want: 42},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			values := parseVmStat(strings.NewReader(tt.input))
+			got, ok := values[tt.key]
+			if !ok {
+				t.Fatalf("Expected key %q not found in %v", tt.key, values)
+			}
+			if got != tt.want {
+				t.Errorf("Expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestCanonicalVmStatKey(t *testing.T) {
+	for key, want := range map[string]string{
+		"Pages wired down":        "pages wired down",
+		"Pages  Wired  Down":      "pages wired down",
+		"Pages copy-on-write":     "pages copyonwrite",
+		`"Translation faults"`:    "translation faults",
+		"File-backed pages":       "filebacked pages",
+		"Pages occupied by - (x)": "pages occupied by x",
+	} {
+		if got := canonicalVmStatKey(key); got != want {
+			t.Errorf("%q: expected %q, got %q", key, want, got)
+		}
+	}
+}
+
+func TestVmStatLookup(t *testing.T) {
+	f, err := os.Open("testdata/vm_stat.txt")
+	if err != nil {
+		t.Fatalf("Failed to open fixture: %v", err)
+	}
+	defer f.Close()
+
+	collector := NewVmStatCollector(config.New())
+	values := newVmStatValues(parseVmStat(f))
+
+	tests := []struct {
+		keys []string
+		want float64
+	}{
+		{keys: []string{"Pages wired down"}, want: 198765},
+		{keys: []string{"Copy-on-writes", "Pages copy-on-write"}, want: 12345678},
+		{keys: []string{"Pages decompressed", "Decompressions"}, want: 8765432},
+		{keys: []string{"Page faults", "Translation faults"}, want: 987654321},
+		// A change in case and punctuation still matches
+		{keys: []string{"pages Stored in Compressor"}, want: 765432},
+		{keys: []string{"Filebacked pages"}, want: 321098},
+	}
+	for _, tt := range tests {
+		got, ok := collector.lookup(values, tt.keys...)
+		if !ok || got != tt.want {
+			t.Errorf("%q: expected %v, got %v (found %v)", tt.keys, tt.want, got, ok)
+		}
+	}
+
+	if _, ok := collector.lookup(values, "Pages renamed"); ok {
+		t.Error("Expected a missing key not to be found")
+	}
+	if _, logged := collector.missingKeys.Load("Pages renamed"); !logged {
+		t.Error("Expected the missing key to be recorded as logged")
+	}
+}
+
+func TestVmStatUsedPages(t *testing.T) {
+	f, err := os.Open("testdata/vm_stat.txt")
+	if err != nil {
+		t.Fatalf("Failed to open fixture: %v", err)
+	}
+	defer f.Close()
+
+	collector := NewVmStatCollector(config.New())
+	used, ok := collector.usedPages(newVmStatValues(parseVmStat(f)))
+	// active + wired down + occupied by compressor
+	if want := 456789.0 + 198765 + 234567; !ok || used != want {
+		t.Errorf("Expected %v used pages, got %v (found %v)", want, used, ok)
+	}
+
+	if _, ok := collector.usedPages(newVmStatValues(parseVmStat(strings.NewReader("Pages active: 42.\n")))); ok {
+		t.Error("Expected no used pages when wired and compressor pages are missing")
+	}
+}
+
+func TestParseSwapUsage(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  swapUsage
+		ok    bool
+	}{
+		{
+			name:  "megabytes",
+			input: "total = 2048.00M  used = 512.00M  free = 1536.00M  (encrypted)\n",
+			want:  swapUsage{total: 2048 << 20, used: 512 << 20, free: 1536 << 20},
+			ok:    true,
+		},
+		{
+			name:  "mixed units",
+			input: "total = 3.00G  used = 1024.00M  free = 2.00G  (encrypted)",
+			want:  swapUsage{total: 3 << 30, used: 1 << 30, free: 2 << 30},
+			ok:    true,
+		},
+		{name: "no swap", input: "total = 0.00M  used = 0.00M  free = 0.00M  (encrypted)", want: swapUsage{}, ok: true},
+		{name: "unparsable", input: "sysctl: unknown oid 'vm.swapusage'", ok: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := parseSwapUsage(tt.input)
+			if ok != tt.ok {
+				t.Fatalf("Expected ok=%v, got %v", tt.ok, ok)
+			}
+			if ok && got != tt.want {
+				t.Errorf("Expected %+v, got %+v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestParseMemoryPressure(t *testing.T) {
+	tests := []struct {
+		input string
+		level int
+		name  string
+		ok    bool
+	}{
+		{input: "1\n", level: 1, name: "normal", ok: true},
+		{input: "2\n", level: 2, name: "warn", ok: true},
+		{input: "4\n", level: 4, name: "critical", ok: true},
+		{input: "8\n", level: 8, name: "unknown", ok: true},
+		{input: "sysctl: unknown oid", ok: false},
+	}
+
+	for _, tt := range tests {
+		level, name, ok := parseMemoryPressure(tt.input)
+		if ok != tt.ok || level != tt.level || name != tt.name {
+			t.Errorf("%q: expected (%d, %q, %v), got (%d, %q, %v)", tt.input, tt.level, tt.name, tt.ok, level, name, ok)
+		}
+	}
+}
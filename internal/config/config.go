@@ -1,13 +1,469 @@
 package config
 
-// Config holds the application configuration
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/common/model"
+	"gopkg.in/yaml.v3"
+)
+
+// Powermetrics sampling modes
+const (
+	// PowermetricsModeScrape runs powermetrics once per scrape
+	PowermetricsModeScrape = "scrape"
+	// PowermetricsModeBackground samples continuously and serves the latest result
+	PowermetricsModeBackground = "background"
+)
+
+// macmon sampling modes
+const (
+	// MacmonModeScrape runs macmon for one sample per scrape
+	MacmonModeScrape = "scrape"
+	// MacmonModeBackground keeps macmon streaming and serves the latest sample
+	MacmonModeBackground = "background"
+)
+
+// Canonical power sources, see Config.PowerSource
+const (
+	// PowerSourceAll exports the power metrics of every power backend
+	PowerSourceAll = ""
+	// PowerSourcePowermetrics suppresses the overlapping macmon power metrics
+	PowerSourcePowermetrics = "powermetrics"
+	// PowerSourceMacmon suppresses the overlapping powermetrics power metrics
+	PowerSourceMacmon = "macmon"
+)
+
+// Handling of concurrent scrapes in PowermetricsModeScrape
+const (
+	// PowermetricsConcurrencyShare makes scrapes that arrive while powermetrics
+	// runs reuse the result of that run
+	PowermetricsConcurrencyShare = "share"
+	// PowermetricsConcurrencySerialize makes such scrapes wait for the run to
+	// finish and then start their own
+	PowermetricsConcurrencySerialize = "serialize"
+)
+
+// Units of the frequency metrics
+const (
+	// FrequencyUnitNative keeps each collector's own unit: Hertz for
+	// powermetrics and Megahertz for macmon
+	FrequencyUnitNative = ""
+	// FrequencyUnitHertz exports every frequency in Hertz
+	FrequencyUnitHertz = "hertz"
+	// FrequencyUnitMegahertz exports every frequency in Megahertz
+	FrequencyUnitMegahertz = "megahertz"
+)
+
+// Log output formats
+const (
+	// LogFormatText writes human-readable log lines
+	LogFormatText = "text"
+	// LogFormatJSON writes one JSON object per log record
+	LogFormatJSON = "json"
+)
+
+// Log levels, from least to most verbose
+const (
+	LogLevelError = "error"
+	LogLevelWarn  = "warn"
+	LogLevelInfo  = "info"
+	// LogLevelDebug also logs the raw lines the parsers read
+	LogLevelDebug = "debug"
+)
+
+// Config holds the application configuration. It can be loaded from a YAML
+// file whose keys are the yaml tags below, see LoadFile.
 type Config struct {
-	Port string
+	// ConfigFile is the YAML file the other fields were loaded from, if any
+	ConfigFile string `yaml:"-"`
+	// Port is the listen address, e.g. ":9127" for all interfaces or
+	// "127.0.0.1:9127" for localhost only
+	Port string `yaml:"port"`
+	// MetricsPath is the URL path the metrics are served on
+	MetricsPath string `yaml:"metrics_path"`
+	// TLSCertFile and TLSKeyFile serve HTTPS when both are set
+	TLSCertFile string `yaml:"tls_cert_file"`
+	TLSKeyFile  string `yaml:"tls_key_file"`
+	// BasicAuthUser and BasicAuthPasswordHash (bcrypt) protect /metrics when set
+	BasicAuthUser         string `yaml:"basic_auth_user"`
+	BasicAuthPasswordHash string `yaml:"basic_auth_password_hash"`
+	// Namespace is prepended to every metric name when set
+	Namespace string `yaml:"namespace"`
+	// ConstLabels are attached to every exporter metric, e.g. {"host": "studio-1"}.
+	// Each label adds to every series, so none are set by default.
+	ConstLabels map[string]string `yaml:"const_labels"`
+	// ModelLabel adds the hardware model (e.g. model="Mac14,2") to ConstLabels
+	ModelLabel bool `yaml:"model_label"`
+	// DebugPowermetrics serves /debug/powermetrics, which runs powermetrics
+	// as root on every request and returns its raw output
+	DebugPowermetrics bool `yaml:"debug_powermetrics"`
+	// EnablePprof serves the net/http/pprof profiling handlers under
+	// /debug/pprof/
+	EnablePprof bool `yaml:"enable_pprof"`
+	// FrequencyUnit standardizes the unit, and the metric name suffix, of
+	// every frequency metric: FrequencyUnitHertz or FrequencyUnitMegahertz.
+	// FrequencyUnitNative keeps each collector's own unit.
+	FrequencyUnit string `yaml:"frequency_unit"`
+
+	// TemperatureFahrenheit adds a *_fahrenheit companion to every
+	// temperature metric. The Celsius metrics are always exported.
+	TemperatureFahrenheit bool `yaml:"temperature_fahrenheit"`
+	// LogFormat selects between LogFormatText and LogFormatJSON
+	LogFormat string `yaml:"log_format"`
+	// LogLevel is the least severe level logged, e.g. LogLevelWarn
+	LogLevel string `yaml:"log_level"`
+	// LogRateLimitWindow is how often an identical collector failure is
+	// logged; repeats in between are counted and reported with the next one.
+	// Zero logs every failure.
+	LogRateLimitWindow time.Duration `yaml:"log_rate_limit_window"`
+	// EnabledCollectors lists the collectors to register by name
+	EnabledCollectors []string `yaml:"enabled_collectors"`
+	// RequireCollectorBinaries fails startup when an enabled collector's command
+	// is missing instead of skipping the collector with a warning
+	RequireCollectorBinaries bool `yaml:"require_collector_binaries"`
+	// ScrapeTimeout bounds the commands run by one scrape; they are killed
+	// once it elapses. Zero means no limit.
+	ScrapeTimeout time.Duration `yaml:"scrape_timeout"`
+	// ExpectedScrapeInterval is the Prometheus scrape interval; a powermetrics
+	// scrape taking longer overlaps the next one and is reported as an
+	// overrun, as is one killed by ScrapeTimeout. Zero disables the check.
+	ExpectedScrapeInterval time.Duration `yaml:"expected_scrape_interval"`
+	// ShutdownTimeout bounds how long Stop waits for in-flight scrapes
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout"`
+	// ReadTimeout, WriteTimeout and IdleTimeout bound reading a request,
+	// writing its response and keeping an idle connection open, so stuck
+	// clients can't hold connections forever. WriteTimeout must outlast a
+	// scrape, see ScrapeTimeout. Zero means no limit.
+	ReadTimeout  time.Duration `yaml:"read_timeout"`
+	WriteTimeout time.Duration `yaml:"write_timeout"`
+	IdleTimeout  time.Duration `yaml:"idle_timeout"`
+	// PowerSource picks the collector whose CPU, GPU and total power metrics
+	// are exported when both powermetrics and macmon run, so dashboards
+	// don't double-count. PowerSourceAll keeps both; any other source must
+	// be an enabled collector.
+	PowerSource string `yaml:"power_source"`
+	// MacmonMode selects between MacmonModeScrape and MacmonModeBackground
+	MacmonMode string `yaml:"macmon_mode"`
+	// MacmonInterval is how long macmon samples for, passed as its -i flag.
+	// In background mode it is how often the cached sample refreshes.
+	MacmonInterval time.Duration `yaml:"macmon_interval"`
+	// PowermetricsMode selects between PowermetricsModeScrape and PowermetricsModeBackground
+	PowermetricsMode string `yaml:"powermetrics_mode"`
+	// PowermetricsConcurrency selects between PowermetricsConcurrencyShare and
+	// PowermetricsConcurrencySerialize. Either way only one powermetrics
+	// process runs at a time.
+	PowermetricsConcurrency string `yaml:"powermetrics_concurrency"`
+	// PowermetricsInputFile makes the powermetrics collector parse this file
+	// of captured powermetrics output instead of running powermetrics
+	PowermetricsInputFile string `yaml:"powermetrics_input_file"`
+	// SamplesPerScrape is how many powermetrics samples, PowermetricsInterval
+	// apart, each scrape takes in scrape mode. The values are averaged over them.
+	SamplesPerScrape int `yaml:"samples_per_scrape"`
+	// DiscardFirstSamples is how many warm-up samples each powermetrics run
+	// takes and ignores before the ones that are reported, since the first
+	// sample after powermetrics starts is often zero or spiked
+	DiscardFirstSamples int `yaml:"discard_first_samples"`
+	// PowermetricsInterval is the powermetrics sampling interval, in whole
+	// milliseconds as powermetrics takes it, for both scrape and background mode
+	PowermetricsInterval time.Duration `yaml:"powermetrics_interval"`
+	// PowermetricsAverageWindow enables *_avg metrics averaged over this window
+	// in background mode. Zero disables them.
+	PowermetricsAverageWindow time.Duration `yaml:"powermetrics_average_window"`
+	// UtilizationSummaries exports GPU and ANE usage as summaries over the
+	// samples between scrapes in background mode
+	UtilizationSummaries bool `yaml:"utilization_summaries"`
+	// PowerSummaries exports CPU and GPU power observed by the background
+	// sampler as summaries with p50/p90/p99 over the last 10 minutes
+	PowerSummaries bool `yaml:"power_summaries"`
+	// PowermetricsWakeups adds the tasks sampler to powermetrics runs for the
+	// system-wide idle and interrupt wakeup metrics. It makes powermetrics
+	// list every process in each sample.
+	PowermetricsWakeups bool `yaml:"powermetrics_wakeups"`
+	// MaxScanLines bounds how many lines of one powermetrics sample are scanned.
+	// Zero means unlimited.
+	MaxScanLines int `yaml:"max_scan_lines"`
+	// VmStatThroughput adds page-in/page-out rates in bytes per second
+	VmStatThroughput bool `yaml:"vmstat_throughput"`
+	// TasksTopN limits the tasks collector to the processes with the highest
+	// energy impact. Zero reports every process.
+	TasksTopN int `yaml:"tasks_top_n"`
+	// MaxProcessSeries caps the processes the tasks collector reports per
+	// scrape; the remaining ones are summed into a single name="other"
+	// process. Zero means no limit.
+	MaxProcessSeries int `yaml:"max_process_series"`
+	// TasksExtendedFields adds per-process GPU time and disk I/O to the tasks
+	// collector, from the --show-process-gpu and --show-process-io flags
+	TasksExtendedFields bool `yaml:"tasks_extended_fields"`
+	// SMCSensorAllow limits the smc collector to these SMC keys when non-empty
+	SMCSensorAllow []string `yaml:"smc_sensor_allow"`
+	// SMCSensorDeny excludes these SMC keys from the smc collector
+	SMCSensorDeny []string `yaml:"smc_sensor_deny"`
+	// DiskDevices lists the disks the disk collector reads, e.g. disk0 for
+	// the internal SSD
+	DiskDevices []string `yaml:"disk_devices"`
+	// NetDevIncludeLoopback and NetDevIncludeDown make the netdev collector
+	// also report loopback and down interfaces
+	NetDevIncludeLoopback bool `yaml:"netdev_include_loopback"`
+	NetDevIncludeDown     bool `yaml:"netdev_include_down"`
+	// TextfileOutputPath, when set, makes the exporter also write its metrics
+	// to this file every TextfileInterval for the node_exporter textfile
+	// collector. The file is replaced atomically; the name should end in .prom.
+	TextfileOutputPath string        `yaml:"textfile_output_path"`
+	TextfileInterval   time.Duration `yaml:"textfile_interval"`
+	// FilesystemMountPointsExclude is a regular expression matching the mount
+	// points the filesystem collector skips
+	FilesystemMountPointsExclude string `yaml:"filesystem_mount_points_exclude"`
 }
 
 // New creates a new configuration with default values
 func New() *Config {
 	return &Config{
-		Port: ":9127",
+		Port:                   ":9127",
+		MetricsPath:            "/metrics",
+		LogFormat:              LogFormatText,
+		LogLevel:               LogLevelInfo,
+		LogRateLimitWindow:     5 * time.Minute,
+		EnabledCollectors:      []string{"powermetrics", "vmstat", "macmon", "ioreg", "thermal", "fan", "system", "cores"},
+		ScrapeTimeout:          10 * time.Second,
+		ExpectedScrapeInterval: 15 * time.Second,
+		ShutdownTimeout:        10 * time.Second,
+		ReadTimeout:            10 * time.Second,
+		WriteTimeout:           30 * time.Second,
+		IdleTimeout:            120 * time.Second,
+		PowermetricsMode:       PowermetricsModeScrape,
+		MacmonMode:             MacmonModeScrape,
+		MacmonInterval:         time.Second,
+		SamplesPerScrape:       1,
+		PowermetricsInterval:   time.Second,
+		MaxScanLines:           100000,
+		TasksTopN:              10,
+		MaxProcessSeries:       50,
+		TextfileInterval:       15 * time.Second,
+		DiskDevices:            []string{"disk0"},
+		// Scrapes arriving during a powermetrics run reuse its result
+		PowermetricsConcurrency: PowermetricsConcurrencyShare,
+		// System volumes that mirror the data volume or are never written to
+		FilesystemMountPointsExclude: `^/(dev|System/Volumes/(VM|Preboot|Update|xarts|iSCPreboot|Hardware))($|/)`,
+	}
+}
+
+// RegisterFlags binds command line flags to the configuration fields
+func (c *Config) RegisterFlags(fs *flag.FlagSet) {
+	fs.StringVar(&c.ConfigFile, "config.file", c.ConfigFile, "YAML configuration file; flags given on the command line override its values")
+	fs.StringVar(&c.Port, "web.listen-address", c.Port, "Address to listen on; use 127.0.0.1:9127 to accept local connections only")
+	fs.StringVar(&c.MetricsPath, "web.telemetry-path", c.MetricsPath, "Path under which to expose metrics")
+	fs.StringVar(&c.TextfileOutputPath, "textfile.output", c.TextfileOutputPath, "Also write the metrics to this .prom file for the node_exporter textfile collector")
+	fs.DurationVar(&c.TextfileInterval, "textfile.interval", c.TextfileInterval, "How often the -textfile.output file is rewritten")
+	fs.BoolVar(&c.DebugPowermetrics, "web.enable-debug-powermetrics", c.DebugPowermetrics, "Serve /debug/powermetrics, returning the raw output of a powermetrics run for each request")
+	fs.BoolVar(&c.EnablePprof, "web.enable-pprof", c.EnablePprof, "Serve Go profiling data under /debug/pprof/")
+	fs.StringVar(&c.PowermetricsInputFile, "powermetrics.input-file", c.PowermetricsInputFile, "Parse captured powermetrics output from this file instead of running powermetrics")
+	fs.StringVar(&c.PowerSource, "power.source", c.PowerSource, "Export CPU, GPU and total power only from this collector, powermetrics or macmon; empty exports both")
+	fs.StringVar(&c.MacmonMode, "macmon.mode", c.MacmonMode, "How the macmon collector samples: scrape runs macmon once per scrape, background keeps it streaming")
+	fs.IntVar(&c.DiscardFirstSamples, "powermetrics.discard-first-samples", c.DiscardFirstSamples, "Number of warm-up powermetrics samples taken and ignored at the start of each run")
+	fs.DurationVar(&c.MacmonInterval, "macmon.interval", c.MacmonInterval, "macmon sampling interval, in whole milliseconds")
+	fs.BoolVar(&c.PowermetricsWakeups, "powermetrics.wakeups", c.PowermetricsWakeups, "Add the tasks sampler to powermetrics runs to report system-wide idle and interrupt wakeups")
+	fs.IntVar(&c.SamplesPerScrape, "powermetrics.samples-per-scrape", c.SamplesPerScrape, "Number of powermetrics samples, PowermetricsInterval apart, averaged per scrape")
+	fs.StringVar(&c.Namespace, "namespace", c.Namespace, "Prefix prepended to every metric name, e.g. myorg")
+	fs.DurationVar(&c.ScrapeTimeout, "scrape.timeout", c.ScrapeTimeout, "Kill commands run by a scrape after this long; 0 disables the limit")
+	fs.DurationVar(&c.ExpectedScrapeInterval, "scrape.expected-interval", c.ExpectedScrapeInterval, "Prometheus scrape interval; longer powermetrics scrapes are reported as overruns, 0 disables the check")
+	fs.DurationVar(&c.ReadTimeout, "web.read-timeout", c.ReadTimeout, "Maximum time to read a request; 0 disables the limit")
+	fs.DurationVar(&c.WriteTimeout, "web.write-timeout", c.WriteTimeout, "Maximum time to write a response, must exceed -scrape.timeout; 0 disables the limit")
+	fs.DurationVar(&c.IdleTimeout, "web.idle-timeout", c.IdleTimeout, "Maximum time to keep an idle keep-alive connection open; 0 disables the limit")
+	fs.BoolVar(&c.RequireCollectorBinaries, "collectors.require-binaries", c.RequireCollectorBinaries, "Fail at startup instead of skipping collectors whose command is not installed")
+	fs.StringVar(&c.LogFormat, "log.format", c.LogFormat, "Log output format: text or json")
+	fs.StringVar(&c.LogLevel, "log.level", c.LogLevel, "Least severe log level to write: error, warn, info or debug")
+	fs.DurationVar(&c.LogRateLimitWindow, "log.rate-limit-window", c.LogRateLimitWindow, "Log an identical collector failure at most once per this window; 0 logs every failure")
+	fs.StringVar(&c.TLSCertFile, "tls.cert-file", c.TLSCertFile, "Path to the TLS certificate; serves HTTPS together with -tls.key-file")
+	fs.StringVar(&c.TLSKeyFile, "tls.key-file", c.TLSKeyFile, "Path to the TLS private key; serves HTTPS together with -tls.cert-file")
+	fs.StringVar(&c.BasicAuthUser, "auth.user", c.BasicAuthUser, "Username required by /metrics; enables basic auth together with -auth.password-hash")
+	fs.StringVar(&c.BasicAuthPasswordHash, "auth.password-hash", c.BasicAuthPasswordHash, "bcrypt hash of the password required by /metrics")
+	fs.StringVar(&c.FilesystemMountPointsExclude, "collector.filesystem.mount-points-exclude", c.FilesystemMountPointsExclude, "Regular expression of mount points the filesystem collector skips")
+	fs.StringVar(&c.FrequencyUnit, "frequency.unit", c.FrequencyUnit, "Export every frequency metric in hertz or megahertz; empty keeps each collector's own unit")
+	fs.BoolVar(&c.TemperatureFahrenheit, "temperature.fahrenheit", c.TemperatureFahrenheit, "Also export every temperature metric in Fahrenheit")
+	fs.BoolVar(&c.ModelLabel, "label.model", c.ModelLabel, "Attach the hardware model, e.g. model=\"Mac14,2\", to every exporter metric")
+	fs.Func("label", "Label name=value attached to every exporter metric; repeat for several labels", func(value string) error {
+		name, labelValue, ok := strings.Cut(value, "=")
+		if !ok || name == "" {
+			return fmt.Errorf("expected name=value, got %q", value)
+		}
+		if c.ConstLabels == nil {
+			c.ConstLabels = make(map[string]string)
+		}
+		c.ConstLabels[name] = labelValue
+		return nil
+	})
+	fs.Func("collectors",
+		"Comma-separated list of collectors to enable (default \""+strings.Join(c.EnabledCollectors, ",")+"\")",
+		func(value string) error {
+			c.EnabledCollectors = nil
+			for _, name := range strings.Split(value, ",") {
+				if name = strings.TrimSpace(name); name != "" {
+					c.EnabledCollectors = append(c.EnabledCollectors, name)
+				}
+			}
+			return nil
+		})
+}
+
+// LoadFile reads the YAML file at path into c. Keys missing from the file
+// keep their current values and unknown keys are an error.
+func (c *Config) LoadFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	decoder := yaml.NewDecoder(f)
+	decoder.KnownFields(true)
+	if err := decoder.Decode(c); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("config file %s: %w", path, err)
+	}
+	return nil
+}
+
+// Validate checks the configuration for values that would otherwise only
+// fail later, at startup of the HTTP server or inside a scrape
+func (c *Config) Validate() error {
+	if c.Port == "" {
+		if c.TextfileOutputPath == "" {
+			return errors.New("listen address is empty and no textfile output is configured")
+		}
+	} else if _, port, err := net.SplitHostPort(c.Port); err != nil {
+		return fmt.Errorf("listen address %q: %w", c.Port, err)
+	} else if n, err := strconv.Atoi(port); err != nil || n < 0 || n > 65535 {
+		return fmt.Errorf("listen address %q: invalid port %q", c.Port, port)
+	}
+	if !strings.HasPrefix(c.MetricsPath, "/") || c.MetricsPath == "/" {
+		return fmt.Errorf("metrics path %q must start with / and not be the root path", c.MetricsPath)
+	}
+
+	if (c.TLSCertFile == "") != (c.TLSKeyFile == "") {
+		return errors.New("TLS requires both a certificate file and a key file")
+	}
+	for _, path := range []string{c.TLSCertFile, c.TLSKeyFile} {
+		if path == "" {
+			continue
+		}
+		if _, err := os.Stat(path); err != nil {
+			return fmt.Errorf("TLS file: %w", err)
+		}
+	}
+	if (c.BasicAuthUser == "") != (c.BasicAuthPasswordHash == "") {
+		return errors.New("basic auth requires both a user and a password hash")
+	}
+
+	switch c.PowermetricsMode {
+	case PowermetricsModeScrape, PowermetricsModeBackground:
+	default:
+		return fmt.Errorf("unknown powermetrics mode %q (available: %s, %s)", c.PowermetricsMode, PowermetricsModeScrape, PowermetricsModeBackground)
+	}
+	switch c.PowerSource {
+	case PowerSourceAll, PowerSourcePowermetrics, PowerSourceMacmon:
+	default:
+		return fmt.Errorf("unknown power source %q (available: %s, %s)", c.PowerSource, PowerSourcePowermetrics, PowerSourceMacmon)
+	}
+	if c.PowerSource != PowerSourceAll && !slices.Contains(c.EnabledCollectors, c.PowerSource) {
+		return fmt.Errorf("power source %q is not an enabled collector", c.PowerSource)
+	}
+	switch c.MacmonMode {
+	case MacmonModeScrape, MacmonModeBackground:
+	default:
+		return fmt.Errorf("unknown macmon mode %q (available: %s, %s)", c.MacmonMode, MacmonModeScrape, MacmonModeBackground)
+	}
+	switch c.PowermetricsConcurrency {
+	case PowermetricsConcurrencyShare, PowermetricsConcurrencySerialize:
+	default:
+		return fmt.Errorf("unknown powermetrics concurrency %q (available: %s, %s)", c.PowermetricsConcurrency, PowermetricsConcurrencyShare, PowermetricsConcurrencySerialize)
+	}
+	switch c.FrequencyUnit {
+	case FrequencyUnitNative, FrequencyUnitHertz, FrequencyUnitMegahertz:
+	default:
+		return fmt.Errorf("unknown frequency unit %q (available: %s, %s)", c.FrequencyUnit, FrequencyUnitHertz, FrequencyUnitMegahertz)
+	}
+	if c.MacmonInterval < time.Millisecond || c.MacmonInterval%time.Millisecond != 0 {
+		return fmt.Errorf("macmon interval must be a positive number of milliseconds, got %v", c.MacmonInterval)
+	}
+	if c.PowermetricsInterval < time.Millisecond || c.PowermetricsInterval%time.Millisecond != 0 {
+		return fmt.Errorf("powermetrics interval must be a positive number of milliseconds, got %v", c.PowermetricsInterval)
+	}
+	if c.SamplesPerScrape < 1 {
+		return fmt.Errorf("samples per scrape must be at least 1, got %d", c.SamplesPerScrape)
+	}
+	if c.DiscardFirstSamples < 0 {
+		return fmt.Errorf("discarded samples must not be negative, got %d", c.DiscardFirstSamples)
+	}
+	if c.PowermetricsAverageWindow < 0 {
+		return fmt.Errorf("powermetrics average window must not be negative, got %v", c.PowermetricsAverageWindow)
+	}
+	if c.MaxScanLines < 0 || c.TasksTopN < 0 || c.MaxProcessSeries < 0 {
+		return errors.New("max scan lines, tasks top N and max process series must not be negative")
+	}
+
+	if c.ScrapeTimeout < 0 {
+		return fmt.Errorf("scrape timeout must not be negative, got %v", c.ScrapeTimeout)
+	}
+	// A scrape mode run takes one interval per sample, discarded ones
+	// included, which must fit in the timeout
+	samples := c.SamplesPerScrape + c.DiscardFirstSamples
+	if c.ScrapeTimeout > 0 && c.PowermetricsMode == PowermetricsModeScrape && c.ScrapeTimeout <= time.Duration(samples)*c.PowermetricsInterval {
+		return fmt.Errorf("scrape timeout %v is too short for %d powermetrics samples of %v", c.ScrapeTimeout, samples, c.PowermetricsInterval)
+	}
+	if c.LogRateLimitWindow < 0 {
+		return fmt.Errorf("log rate limit window must not be negative, got %v", c.LogRateLimitWindow)
+	}
+	if c.ExpectedScrapeInterval < 0 {
+		return fmt.Errorf("expected scrape interval must not be negative, got %v", c.ExpectedScrapeInterval)
+	}
+	if c.ReadTimeout < 0 || c.WriteTimeout < 0 || c.IdleTimeout < 0 {
+		return errors.New("HTTP read, write and idle timeouts must not be negative")
+	}
+	// A response is written after the scrape, which may take the whole
+	// scrape timeout
+	if c.WriteTimeout > 0 && c.ScrapeTimeout > 0 && c.WriteTimeout <= c.ScrapeTimeout {
+		return fmt.Errorf("write timeout %v must be longer than the scrape timeout %v", c.WriteTimeout, c.ScrapeTimeout)
+	}
+	if c.ShutdownTimeout <= 0 {
+		return fmt.Errorf("shutdown timeout must be positive, got %v", c.ShutdownTimeout)
+	}
+	if c.TextfileOutputPath != "" && c.TextfileInterval <= 0 {
+		return fmt.Errorf("textfile interval must be positive, got %v", c.TextfileInterval)
+	}
+	if _, err := regexp.Compile(c.FilesystemMountPointsExclude); err != nil {
+		return fmt.Errorf("filesystem mount points exclude: %w", err)
+	}
+
+	// Names are held to the classic character set, which every Prometheus
+	// version and the text format accept unquoted
+	if c.Namespace != "" && !model.IsValidLegacyMetricName(c.Namespace) {
+		return fmt.Errorf("namespace %q is not a valid metric name prefix", c.Namespace)
+	}
+	for name, value := range c.ConstLabels {
+		if !model.LabelName(name).IsValidLegacy() || strings.HasPrefix(name, "__") {
+			return fmt.Errorf("const label name %q is not a valid label name", name)
+		}
+		if !model.LabelValue(value).IsValid() {
+			return fmt.Errorf("const label %s value %q is not valid UTF-8", name, value)
+		}
+	}
+	return nil
+}
+
+// PowermetricsAverageSamples returns how many background samples fit in the
+// averaging window, or 0 when averaging is disabled
+func (c *Config) PowermetricsAverageSamples() int {
+	if c.PowermetricsMode != PowermetricsModeBackground || c.PowermetricsAverageWindow <= 0 || c.PowermetricsInterval <= 0 {
+		return 0
 	}
+	return max(int(c.PowermetricsAverageWindow/c.PowermetricsInterval), 1)
 }
@@ -0,0 +1,180 @@
+package config
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+// writeConfigFile writes content to a config file in a temporary directory
+func writeConfigFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yml")
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+	return path
+}
+
+func TestLoadFile(t *testing.T) {
+	path := writeConfigFile(t, `
+port: 127.0.0.1:9200
+enabled_collectors: [powermetrics, netdev]
+scrape_timeout: 5s
+const_labels:
+  host: studio-1
+`)
+
+	cfg := New()
+	if err := cfg.LoadFile(path); err != nil {
+		t.Fatalf("Failed to load config file: %v", err)
+	}
+	if cfg.Port != "127.0.0.1:9200" {
+		t.Errorf("Expected port from the file, got %q", cfg.Port)
+	}
+	if !slices.Equal(cfg.EnabledCollectors, []string{"powermetrics", "netdev"}) {
+		t.Errorf("Expected collectors from the file, got %v", cfg.EnabledCollectors)
+	}
+	if cfg.ScrapeTimeout != 5*time.Second {
+		t.Errorf("Expected a 5s scrape timeout, got %v", cfg.ScrapeTimeout)
+	}
+	if cfg.ConstLabels["host"] != "studio-1" {
+		t.Errorf("Expected the host label from the file, got %v", cfg.ConstLabels)
+	}
+	// Keys missing from the file keep their defaults
+	if cfg.MetricsPath != "/metrics" || cfg.TasksTopN != 10 {
+		t.Errorf("Expected defaults for missing keys, got %q and %d", cfg.MetricsPath, cfg.TasksTopN)
+	}
+}
+
+func TestLoadFileFlagsOverride(t *testing.T) {
+	path := writeConfigFile(t, "port: :9200\nnamespace: file\n")
+
+	cfg := New()
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	cfg.RegisterFlags(fs)
+	args := []string{"-config.file", path, "-namespace", "flag"}
+	if err := fs.Parse(args); err != nil {
+		t.Fatalf("Failed to parse flags: %v", err)
+	}
+	if err := cfg.LoadFile(cfg.ConfigFile); err != nil {
+		t.Fatalf("Failed to load config file: %v", err)
+	}
+	if err := fs.Parse(args); err != nil {
+		t.Fatalf("Failed to parse flags: %v", err)
+	}
+
+	if cfg.Port != ":9200" {
+		t.Errorf("Expected port from the file, got %q", cfg.Port)
+	}
+	if cfg.Namespace != "flag" {
+		t.Errorf("Expected the flag to override the file, got namespace %q", cfg.Namespace)
+	}
+}
+
+func TestLoadFileErrors(t *testing.T) {
+	for name, path := range map[string]string{
+		"unknown key": writeConfigFile(t, "prot: :9200\n"),
+		"bad value":   writeConfigFile(t, "scrape_timeout: soon\n"),
+		"missing":     filepath.Join(t.TempDir(), "missing.yml"),
+	} {
+		t.Run(name, func(t *testing.T) {
+			if err := New().LoadFile(path); err == nil {
+				t.Error("Expected an error")
+			}
+		})
+	}
+}
+
+func TestLoadFileEmpty(t *testing.T) {
+	cfg := New()
+	if err := cfg.LoadFile(writeConfigFile(t, "")); err != nil {
+		t.Fatalf("Expected an empty file to be accepted, got %v", err)
+	}
+	if cfg.Port != ":9127" {
+		t.Errorf("Expected the default port, got %q", cfg.Port)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	if err := New().Validate(); err != nil {
+		t.Fatalf("Expected the defaults to be valid, got %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		modify func(c *Config)
+	}{
+		{name: "port without colon", modify: func(c *Config) { c.Port = "9127" }},
+		{name: "port out of range", modify: func(c *Config) { c.Port = ":99999" }},
+		{name: "empty port without textfile", modify: func(c *Config) { c.Port = "" }},
+		{name: "root metrics path", modify: func(c *Config) { c.MetricsPath = "/" }},
+		{name: "TLS cert without key", modify: func(c *Config) { c.TLSCertFile = "cert.pem" }},
+		{name: "missing TLS files", modify: func(c *Config) { c.TLSCertFile, c.TLSKeyFile = "/nonexistent/cert.pem", "/nonexistent/key.pem" }},
+		{name: "basic auth without hash", modify: func(c *Config) { c.BasicAuthUser = "prometheus" }},
+		{name: "unknown mode", modify: func(c *Config) { c.PowermetricsMode = "stream" }},
+		{name: "unknown power source", modify: func(c *Config) { c.PowerSource = "smc" }},
+		{name: "disabled power source", modify: func(c *Config) { c.PowerSource, c.EnabledCollectors = PowerSourceMacmon, []string{"powermetrics"} }},
+		{name: "unknown macmon mode", modify: func(c *Config) { c.MacmonMode = "stream" }},
+		{name: "zero macmon interval", modify: func(c *Config) { c.MacmonInterval = 0 }},
+		{name: "sub-millisecond macmon interval", modify: func(c *Config) { c.MacmonInterval = 1500 * time.Microsecond }},
+		{name: "unknown concurrency", modify: func(c *Config) { c.PowermetricsConcurrency = "parallel" }},
+		{name: "unknown frequency unit", modify: func(c *Config) { c.FrequencyUnit = "ghz" }},
+		{name: "zero interval", modify: func(c *Config) { c.PowermetricsInterval = 0 }},
+		{name: "sub-millisecond interval", modify: func(c *Config) { c.PowermetricsInterval = 1500 * time.Microsecond }},
+		{name: "timeout shorter than sample intervals", modify: func(c *Config) { c.SamplesPerScrape, c.PowermetricsInterval = 4, 3*time.Second }},
+		{name: "zero samples", modify: func(c *Config) { c.SamplesPerScrape = 0 }},
+		{name: "negative discarded samples", modify: func(c *Config) { c.DiscardFirstSamples = -1 }},
+		{name: "timeout shorter than discarded samples", modify: func(c *Config) { c.SamplesPerScrape, c.DiscardFirstSamples = 5, 5 }},
+		{name: "negative timeout", modify: func(c *Config) { c.ScrapeTimeout = -time.Second }},
+		{name: "negative expected scrape interval", modify: func(c *Config) { c.ExpectedScrapeInterval = -time.Second }},
+		{name: "negative log rate limit window", modify: func(c *Config) { c.LogRateLimitWindow = -time.Second }},
+		{name: "timeout shorter than samples", modify: func(c *Config) { c.SamplesPerScrape = 15 }},
+		{name: "negative idle timeout", modify: func(c *Config) { c.IdleTimeout = -time.Second }},
+		{name: "write timeout shorter than scrape", modify: func(c *Config) { c.WriteTimeout = 5 * time.Second }},
+		{name: "zero shutdown timeout", modify: func(c *Config) { c.ShutdownTimeout = 0 }},
+		{name: "zero textfile interval", modify: func(c *Config) { c.TextfileOutputPath, c.TextfileInterval = "mac.prom", 0 }},
+		{name: "bad mount point pattern", modify: func(c *Config) { c.FilesystemMountPointsExclude = "(" }},
+		{name: "invalid namespace", modify: func(c *Config) { c.Namespace = "my-org" }},
+		{name: "namespace starting with a digit", modify: func(c *Config) { c.Namespace = "1org" }},
+		{name: "invalid const label name", modify: func(c *Config) { c.ConstLabels = map[string]string{"host-name": "studio-1"} }},
+		{name: "reserved const label name", modify: func(c *Config) { c.ConstLabels = map[string]string{"__name__": "studio-1"} }},
+		{name: "invalid const label value", modify: func(c *Config) { c.ConstLabels = map[string]string{"host": "\xff"} }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := New()
+			tt.modify(cfg)
+			if err := cfg.Validate(); err == nil {
+				t.Error("Expected a validation error")
+			}
+		})
+	}
+}
+
+func TestValidateAccepts(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(c *Config)
+	}{
+		{name: "localhost", modify: func(c *Config) { c.Port = "127.0.0.1:9127" }},
+		{name: "textfile only", modify: func(c *Config) { c.Port, c.TextfileOutputPath = "", "mac.prom" }},
+		{name: "no scrape timeout", modify: func(c *Config) { c.ScrapeTimeout, c.SamplesPerScrape = 0, 15 }},
+		{name: "short sample interval", modify: func(c *Config) { c.SamplesPerScrape, c.PowermetricsInterval = 15, 500*time.Millisecond }},
+		{name: "namespace and const labels", modify: func(c *Config) { c.Namespace, c.ConstLabels = "my_org", map[string]string{"host": "studio-1"} }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := New()
+			tt.modify(cfg)
+			if err := cfg.Validate(); err != nil {
+				t.Errorf("Expected a valid configuration, got %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,47 @@
+package logging
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+
+	"mac-powermetrics-exporter/internal/config"
+)
+
+// Setup installs the default slog logger for the configured format and
+// level, and sets how often an identical failure is logged. Output of the
+// standard log package is routed through it as well. The text format keeps
+// the default logger so existing log lines look unchanged.
+func Setup(cfg *config.Config) error {
+	level, err := parseLevel(cfg.LogLevel)
+	if err != nil {
+		return err
+	}
+	setFailureWindow(cfg.LogRateLimitWindow)
+
+	switch cfg.LogFormat {
+	case config.LogFormatText:
+		slog.SetLogLoggerLevel(level)
+		return nil
+	case config.LogFormatJSON:
+		slog.SetDefault(slog.New(slog.NewJSONHandler(os.Stderr, &slog.HandlerOptions{Level: level})))
+		return nil
+	default:
+		return fmt.Errorf("unknown log format %q (available: %s, %s)", cfg.LogFormat, config.LogFormatText, config.LogFormatJSON)
+	}
+}
+
+// parseLevel returns the slog level for a configured log level
+func parseLevel(level string) (slog.Level, error) {
+	switch level {
+	case config.LogLevelError:
+		return slog.LevelError, nil
+	case config.LogLevelWarn:
+		return slog.LevelWarn, nil
+	case config.LogLevelInfo:
+		return slog.LevelInfo, nil
+	case config.LogLevelDebug:
+		return slog.LevelDebug, nil
+	}
+	return 0, fmt.Errorf("unknown log level %q (available: %s, %s, %s, %s)", level, config.LogLevelError, config.LogLevelWarn, config.LogLevelInfo, config.LogLevelDebug)
+}
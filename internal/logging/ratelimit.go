@@ -0,0 +1,86 @@
+package logging
+
+import (
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// maxLimiterKeys bounds the messages a limiter remembers; past it, messages
+// whose window has passed are forgotten
+const maxLimiterKeys = 1000
+
+// limiter lets each distinct message through at most once per window and
+// counts the repeats it suppresses in between
+type limiter struct {
+	mu     sync.Mutex
+	window time.Duration
+	seen   map[string]*limitState
+}
+
+// limitState tracks one distinct message
+type limitState struct {
+	logged     time.Time
+	suppressed int
+}
+
+// allow reports whether the message with the given key is logged at now,
+// and how many repeats were suppressed since it last was
+func (l *limiter) allow(key string, now time.Time) (bool, int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.window <= 0 {
+		return true, 0
+	}
+	state, ok := l.seen[key]
+	if ok && now.Sub(state.logged) < l.window {
+		state.suppressed++
+		return false, 0
+	}
+	suppressed := 0
+	if ok {
+		suppressed = state.suppressed
+	}
+	if len(l.seen) >= maxLimiterKeys {
+		for k, s := range l.seen {
+			if now.Sub(s.logged) >= l.window {
+				delete(l.seen, k)
+			}
+		}
+	}
+	l.seen[key] = &limitState{logged: now}
+	return true, suppressed
+}
+
+// failures rate-limits the failure logs of the collectors; Setup sets its
+// window from LogRateLimitWindow
+var failures = &limiter{window: 5 * time.Minute, seen: make(map[string]*limitState)}
+
+// setFailureWindow sets how often an identical failure is logged
+func setFailureWindow(window time.Duration) {
+	failures.mu.Lock()
+	defer failures.mu.Unlock()
+	failures.window = window
+}
+
+// Failure logs a failure at warn level with the slog attributes args. An
+// identical failure, same message and attributes, is logged at most once per
+// LogRateLimitWindow so one that repeats on every scrape doesn't flood the
+// log; the next one logged carries the number of repeats suppressed.
+func Failure(msg string, args ...any) {
+	ok, suppressed := failures.allow(msg+"\x00"+fmt.Sprint(args...), time.Now())
+	if !ok {
+		return
+	}
+	if suppressed > 0 {
+		args = append(args, "suppressed", suppressed)
+	}
+	slog.Warn(msg, args...)
+}
+
+// Failuref is Failure for a printf-style message without attributes
+func Failuref(format string, args ...any) {
+	Failure(fmt.Sprintf(format, args...))
+}
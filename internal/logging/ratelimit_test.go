@@ -0,0 +1,41 @@
+package logging
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLimiter(t *testing.T) {
+	l := &limiter{window: time.Minute, seen: make(map[string]*limitState)}
+	start := time.Now()
+
+	if ok, suppressed := l.allow("a", start); !ok || suppressed != 0 {
+		t.Errorf("Expected the first message to be logged, got ok=%v suppressed=%d", ok, suppressed)
+	}
+	for i := 1; i <= 3; i++ {
+		if ok, _ := l.allow("a", start.Add(time.Duration(i)*time.Second)); ok {
+			t.Errorf("Expected repeat %d within the window to be suppressed", i)
+		}
+	}
+	if ok, _ := l.allow("b", start); !ok {
+		t.Error("Expected a different message to be logged")
+	}
+
+	// Once the window has passed the message is logged with its repeats
+	if ok, suppressed := l.allow("a", start.Add(time.Minute)); !ok || suppressed != 3 {
+		t.Errorf("Expected the message to be logged with 3 suppressed repeats, got ok=%v suppressed=%d", ok, suppressed)
+	}
+	if ok, suppressed := l.allow("a", start.Add(2*time.Minute)); !ok || suppressed != 0 {
+		t.Errorf("Expected no suppressed repeats after the last log, got ok=%v suppressed=%d", ok, suppressed)
+	}
+}
+
+func TestLimiterDisabled(t *testing.T) {
+	l := &limiter{seen: make(map[string]*limitState)}
+	now := time.Now()
+	for range 3 {
+		if ok, _ := l.allow("a", now); !ok {
+			t.Error("Expected every message to be logged without a window")
+		}
+	}
+}
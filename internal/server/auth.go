@@ -0,0 +1,24 @@
+package server
+
+import (
+	"crypto/subtle"
+	"net/http"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// basicAuth requires the configured user and a password matching the bcrypt
+// hash before passing the request on to next
+func basicAuth(user, passwordHash string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reqUser, reqPassword, ok := r.BasicAuth()
+		if !ok ||
+			subtle.ConstantTimeCompare([]byte(reqUser), []byte(user)) != 1 ||
+			bcrypt.CompareHashAndPassword([]byte(passwordHash), []byte(reqPassword)) != nil {
+			w.Header().Set("WWW-Authenticate", `Basic realm="mac-powermetrics-exporter", charset="UTF-8"`)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,36 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+)
+
+// handleDebugPowermetrics returns the raw stdout of one powermetrics sample,
+// followed by its stderr when there is any, to diagnose parser mismatches
+// remotely. It is only served with DebugPowermetrics set.
+func (s *Server) handleDebugPowermetrics(w http.ResponseWriter, r *http.Request) {
+	if s.powermetrics == nil {
+		http.Error(w, "powermetrics collector is not enabled", http.StatusNotFound)
+		return
+	}
+	ctx := r.Context()
+	if s.config.ScrapeTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.config.ScrapeTimeout)
+		defer cancel()
+	}
+
+	stdout, stderr, err := s.powermetrics.Capture(ctx)
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	if err != nil {
+		slog.Error("Debug powermetrics run failed", "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, "# error: %v\n", err)
+	}
+	w.Write(stdout)
+	if len(stderr) > 0 {
+		fmt.Fprintf(w, "\n# stderr:\n%s", stderr)
+	}
+}
@@ -0,0 +1,74 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"mac-powermetrics-exporter/internal/config"
+)
+
+func TestDebugPowermetrics(t *testing.T) {
+	input := filepath.Join(t.TempDir(), "powermetrics.txt")
+	if err := os.WriteFile(input, []byte("*** Sampled system activity ***\nCPU Power: 453 mW\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cfg := config.New()
+	cfg.EnabledCollectors = []string{"powermetrics"}
+	cfg.PowermetricsInputFile = input
+	cfg.DebugPowermetrics = true
+	s := newTestServer(t, cfg)
+
+	rec := httptest.NewRecorder()
+	s.httpServer.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/debug/powermetrics", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", rec.Code)
+	}
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain") {
+		t.Errorf("Expected plain text, got %q", ct)
+	}
+	if body := rec.Body.String(); !strings.Contains(body, "CPU Power: 453 mW") {
+		t.Errorf("Expected the raw powermetrics output, got:\n%s", body)
+	}
+}
+
+func TestDebugPowermetricsDisabledByDefault(t *testing.T) {
+	cfg := config.New()
+	cfg.EnabledCollectors = nil
+	s := newTestServer(t, cfg)
+
+	rec := httptest.NewRecorder()
+	s.httpServer.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/debug/powermetrics", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 without the flag, got %d", rec.Code)
+	}
+}
+
+func TestPprof(t *testing.T) {
+	cfg := config.New()
+	cfg.EnabledCollectors = nil
+	s := newTestServer(t, cfg)
+
+	rec := httptest.NewRecorder()
+	s.httpServer.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/debug/pprof/", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 without the flag, got %d", rec.Code)
+	}
+
+	cfg = config.New()
+	cfg.EnabledCollectors = nil
+	cfg.EnablePprof = true
+	s = newTestServer(t, cfg)
+
+	rec = httptest.NewRecorder()
+	s.httpServer.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/debug/pprof/goroutine?debug=1", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", rec.Code)
+	}
+	if body := rec.Body.String(); !strings.Contains(body, "goroutine profile") {
+		t.Errorf("Expected a goroutine profile, got:\n%s", body)
+	}
+}
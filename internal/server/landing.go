@@ -0,0 +1,41 @@
+package server
+
+import (
+	"html/template"
+	"log"
+	"net/http"
+
+	"mac-powermetrics-exporter/internal/version"
+)
+
+// landingTemplate is the page served at the root path
+var landingTemplate = template.Must(template.New("landing").Parse(`<!DOCTYPE html>
+<html>
+<head><title>Mac Powermetrics Exporter</title></head>
+<body>
+<h1>Mac Powermetrics Exporter</h1>
+<p>Version {{.Version}} ({{.Commit}})</p>
+<ul>
+<li><a href="{{.MetricsPath}}">Metrics</a></li>
+<li><a href="/healthz">Health</a></li>
+<li><a href="/readyz">Readiness</a></li>
+</ul>
+</body>
+</html>
+`))
+
+// handleLanding serves a page naming the exporter and linking to its
+// endpoints. Other unknown paths still get a 404.
+func (s *Server) handleLanding(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	err := landingTemplate.Execute(w, struct {
+		Version, Commit, MetricsPath string
+	}{version.Version, version.Commit, s.config.MetricsPath})
+	if err != nil {
+		log.Printf("Failed to render landing page: %v", err)
+	}
+}
@@ -0,0 +1,37 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"mac-powermetrics-exporter/internal/config"
+)
+
+func TestLandingPage(t *testing.T) {
+	cfg := config.New()
+	cfg.EnabledCollectors = nil
+	s := newTestServer(t, cfg)
+
+	rec := httptest.NewRecorder()
+	s.httpServer.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200 for /, got %d", rec.Code)
+	}
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/html") {
+		t.Errorf("Expected an HTML page, got %q", ct)
+	}
+	body := rec.Body.String()
+	for _, want := range []string{"Mac Powermetrics Exporter", `href="/metrics"`, `href="/healthz"`} {
+		if !strings.Contains(body, want) {
+			t.Errorf("Expected landing page to contain %q, got:\n%s", want, body)
+		}
+	}
+
+	rec = httptest.NewRecorder()
+	s.httpServer.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/wrong-path", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 for an unknown path, got %d", rec.Code)
+	}
+}
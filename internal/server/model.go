@@ -0,0 +1,32 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// unknownModel is reported when the hardware model cannot be read
+const unknownModel = "unknown"
+
+// readMacModel returns the hardware model identifier, e.g. Mac14,2. It runs
+// once at startup since the model cannot change while the exporter runs.
+func readMacModel() string {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, "sysctl", "-n", "hw.model")
+	var out, stderr bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		slog.Error("Failed to run command", "command", strings.Join(cmd.Args, " "), "err", err, "stderr", strings.TrimSpace(stderr.String()))
+		return unknownModel
+	}
+	if model := strings.TrimSpace(out.String()); model != "" {
+		return model
+	}
+	return unknownModel
+}
@@ -1,36 +1,378 @@
 package server
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"log"
+	"log/slog"
+	"maps"
 	"net/http"
+	"net/http/pprof"
+	"os/exec"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
 
 	"mac-powermetrics-exporter/internal/collector"
 	"mac-powermetrics-exporter/internal/config"
+	"mac-powermetrics-exporter/internal/version"
 
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
 // Server represents the HTTP server
 type Server struct {
-	config *config.Config
+	config     *config.Config
+	registry   *prometheus.Registry
+	httpServer *http.Server
+	// textfileRegistry holds the exporter's own metrics for the textfile
+	// output, without the Go runtime and process metrics node_exporter
+	// already reports. Served alongside HTTP, its collectors are separate
+	// instances, see New.
+	textfileRegistry *prometheus.Registry
+	collectors       []*drainingCollector
+	// powermetrics is the enabled powermetrics collector, for
+	// /debug/powermetrics
+	powermetrics *collector.PowermetricsCollector
+	// binaries are the commands the enabled collectors shell out to, which
+	// /readyz requires on PATH
+	binaries []string
+
+	// runners are collectors that sample in the background until cancel is called
+	runners    []backgroundRunner
+	runnersWG  sync.WaitGroup
+	runCtx     context.Context
+	cancelRuns context.CancelFunc
+}
+
+// backgroundRunner is implemented by collectors with a background sampling loop
+type backgroundRunner interface {
+	Run(ctx context.Context)
+}
+
+// New creates a new server instance with the enabled collectors registered
+func New(cfg *config.Config) (*Server, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	s := &Server{
+		config:           cfg,
+		registry:         prometheus.NewRegistry(),
+		textfileRegistry: prometheus.NewRegistry(),
+	}
+	s.runCtx, s.cancelRuns = context.WithCancel(context.Background())
+
+	// The collectors get a copy of cfg carrying the model label, so the
+	// caller's configuration is left as it was
+	for name := range cfg.ConstLabels {
+		if slices.Contains(reservedLabels, name) {
+			return nil, fmt.Errorf("const label %q is reserved for powermetrics_exporter_build_info", name)
+		}
+	}
+	labeled := *cfg
+	labeled.ConstLabels = maps.Clone(cfg.ConstLabels)
+	if cfg.ModelLabel {
+		if labeled.ConstLabels == nil {
+			labeled.ConstLabels = make(map[string]string)
+		}
+		labeled.ConstLabels["model"] = readMacModel()
+	}
+
+	// Keep the Go runtime and process metrics the default registry would provide
+	s.registry.MustRegister(collectors.NewGoCollector())
+	s.registry.MustRegister(collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}))
+	buildInfo := newBuildInfo(&labeled)
+	s.registry.MustRegister(buildInfo)
+	s.textfileRegistry.MustRegister(buildInfo)
+
+	// Register the enabled collectors from the collector registry
+	var enabled []string
+	for _, name := range cfg.EnabledCollectors {
+		registration, ok := collector.Lookup(name)
+		if !ok {
+			return nil, fmt.Errorf("unknown collector %q (available: %s)", name, strings.Join(collector.Names(), ", "))
+		}
+		if binary := registration.Binary; binary != "" && !(name == "powermetrics" && cfg.PowermetricsInputFile != "") {
+			if !slices.Contains(s.binaries, binary) {
+				s.binaries = append(s.binaries, binary)
+			}
+			if _, err := exec.LookPath(binary); err != nil {
+				if cfg.RequireCollectorBinaries {
+					return nil, fmt.Errorf("collector %q requires %s: %w", name, binary, err)
+				}
+				slog.Warn("Collector disabled, command not found in PATH", "collector", name, "command", binary)
+				continue
+			}
+		}
+		enabled = append(enabled, name)
+	}
+	// A power source whose command is missing would silently suppress the
+	// power metrics of the other backend
+	if cfg.PowerSource != config.PowerSourceAll && !slices.Contains(enabled, cfg.PowerSource) {
+		registration, _ := collector.Lookup(cfg.PowerSource)
+		return nil, fmt.Errorf("power source %q requires %s, which is not in PATH", cfg.PowerSource, registration.Binary)
+	}
+
+	// The SMC collectors list the SMC keys once per scrape between them
+	smcReader := collector.NewSMCReader()
+	// Summaries and rates cover the time since the previous gather, so the
+	// textfile written alongside HTTP gets collector instances of its own
+	// rather than splitting those windows with the scrapes
+	if cfg.TextfileOutputPath != "" && cfg.Port != "" {
+		s.addCollectors(&labeled, enabled, smcReader, s.registry)
+		s.addCollectors(&labeled, enabled, smcReader, s.textfileRegistry)
+	} else {
+		s.addCollectors(&labeled, enabled, smcReader, s.registry, s.textfileRegistry)
+	}
+
+	mux := http.NewServeMux()
+	// promhttp gzips the response for clients sending Accept-Encoding: gzip,
+	// as Prometheus does
+	var metricsHandler http.Handler = promhttp.InstrumentMetricHandler(
+		s.registry, promhttp.HandlerFor(s.registry, promhttp.HandlerOpts{}),
+	)
+	mux.Handle(cfg.MetricsPath, s.protect(metricsHandler))
+	if cfg.DebugPowermetrics {
+		mux.Handle("/debug/powermetrics", s.protect(http.HandlerFunc(s.handleDebugPowermetrics)))
+	}
+	if cfg.EnablePprof {
+		mux.Handle("/debug/pprof/", s.protect(http.HandlerFunc(pprof.Index)))
+		mux.Handle("/debug/pprof/cmdline", s.protect(http.HandlerFunc(pprof.Cmdline)))
+		mux.Handle("/debug/pprof/profile", s.protect(http.HandlerFunc(pprof.Profile)))
+		mux.Handle("/debug/pprof/symbol", s.protect(http.HandlerFunc(pprof.Symbol)))
+		mux.Handle("/debug/pprof/trace", s.protect(http.HandlerFunc(pprof.Trace)))
+	}
+	mux.HandleFunc("/", s.handleLanding)
+	mux.HandleFunc("/healthz", handleHealthz)
+	mux.HandleFunc("/readyz", s.handleReadyz)
+	s.httpServer = &http.Server{
+		Addr:         cfg.Port,
+		Handler:      mux,
+		ReadTimeout:  cfg.ReadTimeout,
+		WriteTimeout: cfg.WriteTimeout,
+		IdleTimeout:  cfg.IdleTimeout,
+	}
+	return s, nil
+}
+
+// protect puts h behind basic auth when it is configured
+func (s *Server) protect(h http.Handler) http.Handler {
+	if s.config.BasicAuthUser == "" {
+		return h
+	}
+	return basicAuth(s.config.BasicAuthUser, s.config.BasicAuthPasswordHash, h)
+}
+
+// handleHealthz reports liveness without running any collectors
+func handleHealthz(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	fmt.Fprintln(w, "ok")
+}
+
+// handleReadyz reports readiness once the commands of the enabled collectors
+// are on PATH
+func (s *Server) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	for _, name := range s.binaries {
+		if _, err := exec.LookPath(name); err != nil {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			fmt.Fprintf(w, "%s not found in PATH\n", name)
+			return
+		}
+	}
+	fmt.Fprintln(w, "ok")
+}
+
+// reservedLabels are the build_info labels const labels must not override.
+// model is set by ModelLabel.
+var reservedLabels = []string{"version", "commit", "goversion", "model"}
+
+// newBuildInfo creates the constant build-info gauge identifying this binary
+// and the hardware it runs on
+func newBuildInfo(cfg *config.Config) prometheus.Gauge {
+	labels := prometheus.Labels{
+		"version":   version.Version,
+		"commit":    version.Commit,
+		"goversion": runtime.Version(),
+	}
+	for name, value := range cfg.ConstLabels {
+		labels[name] = value
+	}
+	buildInfo := prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace:   cfg.Namespace,
+		Subsystem:   "powermetrics_exporter",
+		Name:        "build_info",
+		Help:        "A metric with a constant '1' value labeled by version, commit, Go version and, with the model label, hardware model.",
+		ConstLabels: labels,
+	})
+	buildInfo.Set(1)
+	return buildInfo
 }
 
-// New creates a new server instance
-func New(cfg *config.Config) *Server {
-	return &Server{
-		config: cfg,
+// addCollectors creates an instance of each named collector and registers
+// them with registries. The power backends of one call share their scrape
+// outcomes with its power_source_info.
+func (s *Server) addCollectors(cfg *config.Config, names []string, smcReader *collector.SMCReader, registries ...*prometheus.Registry) {
+	var powerBackends []string
+	powerState := collector.NewPowerSourceState()
+	for _, name := range names {
+		registration, _ := collector.Lookup(name)
+		c := registration.Factory(cfg)
+		if pm, ok := c.(*collector.PowermetricsCollector); ok {
+			// /debug/powermetrics captures through the first instance, and
+			// later ones never run powermetrics alongside it
+			if s.powermetrics == nil {
+				s.powermetrics = pm
+			} else {
+				pm.ShareScrapeGuard(s.powermetrics)
+			}
+		}
+		if consumer, ok := c.(collector.SMCConsumer); ok {
+			consumer.SetSMCReader(smcReader)
+		}
+		if backend, ok := c.(collector.PowerBackend); ok {
+			backend.SetPowerSourceState(powerState)
+			powerBackends = append(powerBackends, name)
+		}
+		s.register(c, registries...)
+	}
+	if len(powerBackends) > 0 {
+		s.register(collector.NewPowerSourceCollector(cfg, powerBackends, powerState), registries...)
+	}
+}
+
+// register wraps c so that Stop can wait for its in-flight Collect calls, and
+// registers it with registries
+func (s *Server) register(c prometheus.Collector, registries ...*prometheus.Registry) {
+	dc := &drainingCollector{Collector: c}
+	for _, registry := range registries {
+		registry.MustRegister(dc)
+	}
+	s.collectors = append(s.collectors, dc)
+	if r, ok := c.(backgroundRunner); ok {
+		s.runners = append(s.runners, r)
 	}
 }
 
 // Start starts the HTTP server with registered collectors
 func (s *Server) Start() error {
-	// Register collectors
-	prometheus.MustRegister(collector.NewPowermetricsCollector())
-	prometheus.MustRegister(collector.NewVmStatCollector())
-	prometheus.MustRegister(collector.NewMacMonCollector())
-
-	http.Handle("/metrics", promhttp.Handler())
-	log.Printf("Beginning to serve on port %s", s.config.Port)
-	return http.ListenAndServe(s.config.Port, nil)
+	for _, r := range s.runners {
+		s.runnersWG.Add(1)
+		go func(r backgroundRunner) {
+			defer s.runnersWG.Done()
+			r.Run(s.runCtx)
+		}(r)
+	}
+
+	if s.config.TextfileOutputPath != "" {
+		s.runnersWG.Add(1)
+		go func() {
+			defer s.runnersWG.Done()
+			s.runTextfile(s.runCtx)
+		}()
+	}
+
+	// An empty listen address only writes the textfile
+	if s.config.Port == "" {
+		log.Printf("No listen address, not serving HTTP")
+		<-s.runCtx.Done()
+		return nil
+	}
+
+	var err error
+	if s.config.TLSCertFile != "" && s.config.TLSKeyFile != "" {
+		log.Printf("Beginning to serve HTTPS on port %s", s.config.Port)
+		err = s.httpServer.ListenAndServeTLS(s.config.TLSCertFile, s.config.TLSKeyFile)
+	} else {
+		log.Printf("Beginning to serve on port %s", s.config.Port)
+		err = s.httpServer.ListenAndServe()
+	}
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
+
+// Run starts the server and stops it gracefully once ctx is canceled
+func (s *Server) Run(ctx context.Context) error {
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- s.Start()
+	}()
+
+	select {
+	case err := <-errCh:
+		return err
+	case <-ctx.Done():
+		log.Printf("Shutting down server")
+		if err := s.Stop(); err != nil {
+			return err
+		}
+		return <-errCh
+	}
+}
+
+// Stop stops accepting connections and waits, up to the shutdown timeout,
+// for any in-flight scrape to finish so the last response is complete
+func (s *Server) Stop() error {
+	ctx, cancel := context.WithTimeout(context.Background(), s.config.ShutdownTimeout)
+	defer cancel()
+
+	err := s.httpServer.Shutdown(ctx)
+	s.cancelRuns()
+
+	drained := make(chan struct{})
+	go func() {
+		for _, c := range s.collectors {
+			c.drain()
+		}
+		s.runnersWG.Wait()
+		close(drained)
+	}()
+
+	select {
+	case <-drained:
+	case <-ctx.Done():
+		log.Printf("Shutdown timeout reached with collectors still running")
+		if err == nil {
+			err = ctx.Err()
+		}
+	}
+	return err
+}
+
+// drainingCollector tracks in-flight Collect calls of the wrapped collector
+type drainingCollector struct {
+	prometheus.Collector
+
+	mu       sync.Mutex
+	stopping bool
+	inflight sync.WaitGroup
+}
+
+// Collect runs the wrapped collector unless a shutdown has begun
+func (c *drainingCollector) Collect(ch chan<- prometheus.Metric) {
+	c.mu.Lock()
+	if c.stopping {
+		c.mu.Unlock()
+		return
+	}
+	c.inflight.Add(1)
+	c.mu.Unlock()
+	defer c.inflight.Done()
+
+	c.Collector.Collect(ch)
+}
+
+// drain rejects new Collect calls and blocks until in-flight ones return
+func (c *drainingCollector) drain() {
+	c.mu.Lock()
+	c.stopping = true
+	c.mu.Unlock()
+	c.inflight.Wait()
 }
@@ -0,0 +1,383 @@
+package server
+
+import (
+	"compress/gzip"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"mac-powermetrics-exporter/internal/config"
+	"mac-powermetrics-exporter/internal/version"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// newTestServer creates a server, failing the test on error
+func newTestServer(t *testing.T, cfg *config.Config) *Server {
+	t.Helper()
+	s, err := New(cfg)
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+	return s
+}
+
+// slowCollector emits one metric after a fixed delay
+type slowCollector struct {
+	desc     *prometheus.Desc
+	delay    time.Duration
+	started  chan struct{}
+	finished atomic.Bool
+}
+
+func (c *slowCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.desc
+}
+
+func (c *slowCollector) Collect(ch chan<- prometheus.Metric) {
+	close(c.started)
+	time.Sleep(c.delay)
+	ch <- prometheus.MustNewConstMetric(c.desc, prometheus.GaugeValue, 1)
+	c.finished.Store(true)
+}
+
+func TestStopWaitsForInflightCollect(t *testing.T) {
+	cfg := config.New()
+	cfg.ShutdownTimeout = 5 * time.Second
+	s := newTestServer(t, cfg)
+
+	slow := &slowCollector{
+		desc:    prometheus.NewDesc("test_slow_metric", "Slow test metric.", nil, nil),
+		delay:   500 * time.Millisecond,
+		started: make(chan struct{}),
+	}
+	s.register(slow, s.registry)
+
+	go s.registry.Gather()
+	<-slow.started
+
+	start := time.Now()
+	if err := s.Stop(); err != nil {
+		t.Fatalf("Stop returned error: %v", err)
+	}
+
+	if !slow.finished.Load() {
+		t.Error("Stop returned before the in-flight Collect finished")
+	}
+	if elapsed := time.Since(start); elapsed < 400*time.Millisecond {
+		t.Errorf("Stop returned after %v, expected it to wait for the slow collect", elapsed)
+	}
+}
+
+func TestStopGivesUpAfterShutdownTimeout(t *testing.T) {
+	cfg := config.New()
+	cfg.ShutdownTimeout = 100 * time.Millisecond
+	s := newTestServer(t, cfg)
+
+	slow := &slowCollector{
+		desc:    prometheus.NewDesc("test_slow_metric", "Slow test metric.", nil, nil),
+		delay:   time.Second,
+		started: make(chan struct{}),
+	}
+	s.register(slow, s.registry)
+
+	go s.registry.Gather()
+	<-slow.started
+
+	if err := s.Stop(); err == nil {
+		t.Error("Expected Stop to report the shutdown timeout")
+	}
+	if slow.finished.Load() {
+		t.Error("Expected Stop to return before the slow collect finished")
+	}
+}
+
+func TestRunReturnsCleanlyOnCancel(t *testing.T) {
+	cfg := config.New()
+	cfg.Port = "127.0.0.1:0"
+	s := newTestServer(t, cfg)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- s.Run(ctx)
+	}()
+
+	time.Sleep(100 * time.Millisecond)
+	cancel()
+
+	select {
+	case err := <-errCh:
+		if err != nil {
+			t.Errorf("Expected Run to return nil after cancel, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run did not return after context cancel")
+	}
+}
+
+func TestHealthz(t *testing.T) {
+	s := newTestServer(t, config.New())
+
+	rec := httptest.NewRecorder()
+	s.httpServer.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected status 200 for /healthz, got %d", rec.Code)
+	}
+	if body := strings.TrimSpace(rec.Body.String()); body != "ok" {
+		t.Errorf("Expected body %q, got %q", "ok", body)
+	}
+}
+
+func TestReadyz(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("PATH", dir)
+	cfg := config.New()
+	cfg.EnabledCollectors = []string{"vmstat", "throttle"}
+	s := newTestServer(t, cfg)
+
+	rec := httptest.NewRecorder()
+	s.httpServer.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	if rec.Code != http.StatusServiceUnavailable || !strings.Contains(rec.Body.String(), "vm_stat") {
+		t.Errorf("Expected 503 naming vm_stat, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	// Only the enabled collectors' commands are required, not powermetrics
+	for _, name := range []string{"vm_stat", "pmset"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("#!/bin/sh\n"), 0o755); err != nil {
+			t.Fatalf("Failed to write fake %s: %v", name, err)
+		}
+	}
+	rec = httptest.NewRecorder()
+	s.httpServer.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected 200 with vm_stat and pmset on PATH, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestMetricsPath(t *testing.T) {
+	cfg := config.New()
+	cfg.EnabledCollectors = nil
+	cfg.MetricsPath = "/prometheus/metrics"
+	s := newTestServer(t, cfg)
+
+	rec := httptest.NewRecorder()
+	s.httpServer.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/prometheus/metrics", nil))
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "powermetrics_exporter_build_info") {
+		t.Errorf("Expected metrics at the configured path, got %d", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	s.httpServer.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `href="/prometheus/metrics"`) {
+		t.Errorf("Expected the landing page to link to the metrics path, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	s.httpServer.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Expected status 404 for the default path, got %d", rec.Code)
+	}
+}
+
+func TestMetricsGzip(t *testing.T) {
+	cfg := config.New()
+	cfg.EnabledCollectors = nil
+	s := newTestServer(t, cfg)
+
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	rec := httptest.NewRecorder()
+	s.httpServer.Handler.ServeHTTP(rec, req)
+
+	if got := rec.Header().Get("Content-Encoding"); got != "gzip" {
+		t.Fatalf("Expected Content-Encoding gzip, got %q", got)
+	}
+	zr, err := gzip.NewReader(rec.Body)
+	if err != nil {
+		t.Fatalf("Failed to open gzip body: %v", err)
+	}
+	body, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatalf("Failed to decompress body: %v", err)
+	}
+	if !strings.Contains(string(body), "powermetrics_exporter_build_info") {
+		t.Errorf("Expected the decompressed body to hold the metrics, got:\n%s", body)
+	}
+
+	// Clients that don't ask for gzip get plain text
+	rec = httptest.NewRecorder()
+	s.httpServer.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if got := rec.Header().Get("Content-Encoding"); got != "" {
+		t.Errorf("Expected no Content-Encoding without Accept-Encoding, got %q", got)
+	}
+}
+
+func TestInvalidMetricsPath(t *testing.T) {
+	for _, path := range []string{"", "metrics", "/"} {
+		cfg := config.New()
+		cfg.MetricsPath = path
+		if _, err := New(cfg); err == nil {
+			t.Errorf("Expected an error for metrics path %q", path)
+		}
+	}
+}
+
+func TestUnknownCollectorIsRejected(t *testing.T) {
+	cfg := config.New()
+	cfg.EnabledCollectors = []string{"vmstat", "powermetric"}
+
+	if _, err := New(cfg); err == nil || !strings.Contains(err.Error(), `"powermetric"`) {
+		t.Errorf("Expected an unknown collector error naming powermetric, got %v", err)
+	}
+}
+
+func TestBuildInfo(t *testing.T) {
+	s := newTestServer(t, config.New())
+
+	families, err := s.registry.Gather()
+	if err != nil {
+		t.Fatalf("Failed to gather metrics: %v", err)
+	}
+	for _, family := range families {
+		if family.GetName() != "powermetrics_exporter_build_info" {
+			continue
+		}
+		labels := make(map[string]string)
+		for _, pair := range family.GetMetric()[0].GetLabel() {
+			labels[pair.GetName()] = pair.GetValue()
+		}
+		if labels["version"] != version.Version || labels["goversion"] != runtime.Version() {
+			t.Errorf("Unexpected build info labels: %v", labels)
+		}
+		return
+	}
+	t.Error("powermetrics_exporter_build_info not found")
+}
+
+func TestBuildInfoConstLabels(t *testing.T) {
+	cfg := config.New()
+	cfg.EnabledCollectors = nil
+	cfg.ConstLabels = map[string]string{"host": "studio-1"}
+	s := newTestServer(t, cfg)
+
+	rec := httptest.NewRecorder()
+	s.httpServer.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if !strings.Contains(rec.Body.String(), `host="studio-1"`) {
+		t.Errorf("Expected build info to carry the configured label, got:\n%s", rec.Body.String())
+	}
+}
+
+func TestTLSRequiresBothFiles(t *testing.T) {
+	cfg := config.New()
+	cfg.TLSCertFile = "testdata/missing.crt"
+
+	if _, err := New(cfg); err == nil || !strings.Contains(err.Error(), "both") {
+		t.Errorf("Expected an error about the missing key file, got %v", err)
+	}
+}
+
+func TestTLSFilesMustExist(t *testing.T) {
+	cfg := config.New()
+	cfg.TLSCertFile = filepath.Join(t.TempDir(), "server.crt")
+	cfg.TLSKeyFile = filepath.Join(t.TempDir(), "server.key")
+
+	if _, err := New(cfg); err == nil || !strings.Contains(err.Error(), "server.crt") {
+		t.Errorf("Expected an error naming the missing certificate, got %v", err)
+	}
+}
+
+func TestMissingCollectorBinary(t *testing.T) {
+	t.Setenv("PATH", t.TempDir())
+	cfg := config.New()
+	cfg.EnabledCollectors = []string{"vmstat"}
+
+	s := newTestServer(t, cfg)
+	if len(s.collectors) != 0 {
+		t.Errorf("Expected vmstat to be skipped without vm_stat, got %d collectors", len(s.collectors))
+	}
+
+	cfg.RequireCollectorBinaries = true
+	if _, err := New(cfg); err == nil || !strings.Contains(err.Error(), "vm_stat") {
+		t.Errorf("Expected a startup error naming vm_stat, got %v", err)
+	}
+}
+
+func TestMissingPowerSourceBinary(t *testing.T) {
+	t.Setenv("PATH", t.TempDir())
+	cfg := config.New()
+	cfg.EnabledCollectors = []string{"macmon"}
+	cfg.PowerSource = config.PowerSourceMacmon
+
+	if _, err := New(cfg); err == nil || !strings.Contains(err.Error(), "macmon") {
+		t.Errorf("Expected a startup error naming macmon, got %v", err)
+	}
+}
+
+func TestModelLabel(t *testing.T) {
+	// A stand-in for sysctl that prints a model identifier
+	dir := t.TempDir()
+	script := "#!/bin/sh\necho Mac14,2\n"
+	if err := os.WriteFile(filepath.Join(dir, "sysctl"), []byte(script), 0o755); err != nil {
+		t.Fatalf("Failed to write fake sysctl: %v", err)
+	}
+	t.Setenv("PATH", dir)
+
+	cfg := config.New()
+	cfg.EnabledCollectors = nil
+	cfg.ModelLabel = true
+	s := newTestServer(t, cfg)
+
+	if len(cfg.ConstLabels) != 0 {
+		t.Errorf("Expected the configuration to be left unchanged, got %v", cfg.ConstLabels)
+	}
+	rec := httptest.NewRecorder()
+	s.httpServer.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if !strings.Contains(rec.Body.String(), `model="Mac14,2"`) {
+		t.Errorf("Expected build info to carry the model, got:\n%s", rec.Body.String())
+	}
+}
+
+func TestModelLabelDisabled(t *testing.T) {
+	// A stand-in for sysctl that records being run
+	dir := t.TempDir()
+	marker := filepath.Join(dir, "ran")
+	script := "#!/bin/sh\n: > " + marker + "\necho Mac14,2\n"
+	if err := os.WriteFile(filepath.Join(dir, "sysctl"), []byte(script), 0o755); err != nil {
+		t.Fatalf("Failed to write fake sysctl: %v", err)
+	}
+	t.Setenv("PATH", dir)
+
+	cfg := config.New()
+	cfg.EnabledCollectors = nil
+	s := newTestServer(t, cfg)
+
+	if _, err := os.Stat(marker); err == nil {
+		t.Error("Expected sysctl not to run without the model label")
+	}
+	rec := httptest.NewRecorder()
+	s.httpServer.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if strings.Contains(rec.Body.String(), "model=") {
+		t.Errorf("Expected no model label, got:\n%s", rec.Body.String())
+	}
+}
+
+func TestReservedConstLabels(t *testing.T) {
+	for _, name := range []string{"version", "commit", "goversion", "model"} {
+		cfg := config.New()
+		cfg.EnabledCollectors = nil
+		cfg.ConstLabels = map[string]string{name: "custom"}
+		if _, err := New(cfg); err == nil || !strings.Contains(err.Error(), name) {
+			t.Errorf("Expected const label %q to be rejected, got %v", name, err)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/expfmt"
+)
+
+// runTextfile writes the textfile output every TextfileInterval until ctx is
+// canceled
+func (s *Server) runTextfile(ctx context.Context) {
+	ticker := time.NewTicker(s.config.TextfileInterval)
+	defer ticker.Stop()
+	for {
+		if err := writeTextfile(s.textfileRegistry, s.config.TextfileOutputPath); err != nil {
+			slog.Error("Failed to write textfile", "path", s.config.TextfileOutputPath, "err", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// writeTextfile gathers g and replaces path with the metrics in the text
+// exposition format. The metrics are written to a temporary file in the same
+// directory and renamed over path, so the textfile collector never reads a
+// partial file. The temporary name doesn't end in .prom and is ignored by it.
+// Timestamps, as background samples carry, are dropped: the textfile
+// collector rejects the whole file if any metric has one.
+func writeTextfile(g prometheus.Gatherer, path string) error {
+	families, err := g.Gather()
+	if err != nil {
+		// Gather still returns the metrics that could be collected
+		slog.Warn("Collectors reported errors", "err", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	for _, family := range families {
+		for _, metric := range family.GetMetric() {
+			metric.TimestampMs = nil
+		}
+		if _, err := expfmt.MetricFamilyToText(tmp, family); err != nil {
+			tmp.Close()
+			return fmt.Errorf("encode %s: %w", family.GetName(), err)
+		}
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	// CreateTemp uses 0600, but node_exporter often runs as another user
+	if err := os.Chmod(tmp.Name(), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,172 @@
+package server
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"mac-powermetrics-exporter/internal/config"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/expfmt"
+)
+
+func TestWriteTextfile(t *testing.T) {
+	dir := t.TempDir()
+	cfg := config.New()
+	cfg.EnabledCollectors = nil
+	cfg.TextfileOutputPath = filepath.Join(dir, "mac.prom")
+	s := newTestServer(t, cfg)
+	s.register(prometheus.NewGaugeFunc(prometheus.GaugeOpts{Name: "test_textfile_metric", Help: "Test metric."}, func() float64 { return 42 }), s.textfileRegistry)
+
+	if err := writeTextfile(s.textfileRegistry, cfg.TextfileOutputPath); err != nil {
+		t.Fatalf("Failed to write textfile: %v", err)
+	}
+
+	data, err := os.ReadFile(cfg.TextfileOutputPath)
+	if err != nil {
+		t.Fatalf("Failed to read textfile: %v", err)
+	}
+	out := string(data)
+	for _, want := range []string{"test_textfile_metric 42", "powermetrics_exporter_build_info{"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Expected textfile to contain %q, got:\n%s", want, out)
+		}
+	}
+	// node_exporter reports its own Go runtime metrics
+	if strings.Contains(out, "go_goroutines") {
+		t.Errorf("Expected no Go runtime metrics in the textfile, got:\n%s", out)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("Failed to list directory: %v", err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("Expected only the textfile in the directory, got %d entries", len(entries))
+	}
+	info, err := os.Stat(cfg.TextfileOutputPath)
+	if err != nil {
+		t.Fatalf("Failed to stat textfile: %v", err)
+	}
+	if info.Mode().Perm() != 0o644 {
+		t.Errorf("Expected a world-readable textfile, got %v", info.Mode())
+	}
+}
+
+func TestTextfileIntervalMustBePositive(t *testing.T) {
+	cfg := config.New()
+	cfg.TextfileOutputPath = filepath.Join(t.TempDir(), "mac.prom")
+	cfg.TextfileInterval = 0
+	if _, err := New(cfg); err == nil {
+		t.Error("Expected an error for a zero textfile interval")
+	}
+}
+
+func TestWriteTextfileBackgroundMode(t *testing.T) {
+	fixture, err := filepath.Abs("../collector/testdata/powermetrics_apple_silicon.txt")
+	if err != nil {
+		t.Fatalf("Failed to resolve fixture: %v", err)
+	}
+	// A stand-in for powermetrics streaming two samples, so the first one is
+	// complete when the second header arrives, and then staying up like a
+	// real stream. The sampler probe (-h) gets no usage and exits.
+	dir := t.TempDir()
+	script := "#!/bin/sh\n[ \"$1\" = -h ] && exit 1\n/bin/cat " + fixture + " " + fixture + "\nexec /bin/sleep 60\n"
+	if err := os.WriteFile(filepath.Join(dir, "powermetrics"), []byte(script), 0o755); err != nil {
+		t.Fatalf("Failed to write fake powermetrics: %v", err)
+	}
+	t.Setenv("PATH", dir)
+
+	cfg := config.New()
+	cfg.EnabledCollectors = []string{"powermetrics"}
+	cfg.PowermetricsMode = config.PowermetricsModeBackground
+	cfg.Port = ""
+	cfg.TextfileOutputPath = filepath.Join(t.TempDir(), "mac.prom")
+	s := newTestServer(t, cfg)
+	go s.Start()
+	defer s.Stop()
+
+	// Wait for the stream to publish a sample
+	var out string
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(50 * time.Millisecond) {
+		if err := writeTextfile(s.textfileRegistry, cfg.TextfileOutputPath); err != nil {
+			t.Fatalf("Failed to write textfile: %v", err)
+		}
+		data, err := os.ReadFile(cfg.TextfileOutputPath)
+		if err != nil {
+			t.Fatalf("Failed to read textfile: %v", err)
+		}
+		if out = string(data); strings.Contains(out, "powermetrics_up 1") {
+			break
+		}
+	}
+	if !strings.Contains(out, "powermetrics_up 1") {
+		t.Fatalf("Expected a background sample in the textfile, got:\n%s", out)
+	}
+
+	families, err := new(expfmt.TextParser).TextToMetricFamilies(strings.NewReader(out))
+	if err != nil {
+		t.Fatalf("Failed to parse textfile: %v", err)
+	}
+	for name, family := range families {
+		for _, metric := range family.GetMetric() {
+			if metric.TimestampMs != nil {
+				t.Errorf("Expected no timestamp on %s, got %d", name, metric.GetTimestampMs())
+			}
+		}
+	}
+}
+
+func TestTextfileSeparateFromScrapes(t *testing.T) {
+	fixture, err := filepath.Abs("../collector/testdata/powermetrics_apple_silicon.txt")
+	if err != nil {
+		t.Fatalf("Failed to resolve fixture: %v", err)
+	}
+	dir := t.TempDir()
+	script := "#!/bin/sh\n[ \"$1\" = -h ] && exit 1\n/bin/cat " + fixture + " " + fixture + "\nexec /bin/sleep 60\n"
+	if err := os.WriteFile(filepath.Join(dir, "powermetrics"), []byte(script), 0o755); err != nil {
+		t.Fatalf("Failed to write fake powermetrics: %v", err)
+	}
+	t.Setenv("PATH", dir)
+
+	cfg := config.New()
+	cfg.EnabledCollectors = []string{"powermetrics"}
+	cfg.PowermetricsMode = config.PowermetricsModeBackground
+	cfg.UtilizationSummaries = true
+	cfg.TextfileOutputPath = filepath.Join(t.TempDir(), "mac.prom")
+	s := newTestServer(t, cfg)
+	// The streams are stopped, killing the fake powermetrics, before the test ends
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	defer cancel()
+	for _, r := range s.runners {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r.Run(ctx)
+		}()
+	}
+
+	// Each output sees the sample its own stream published, rather than the
+	// first gather draining the GPU usage window for both
+	for name, registry := range map[string]*prometheus.Registry{"scrape": s.registry, "textfile": s.textfileRegistry} {
+		var count uint64
+		for deadline := time.Now().Add(5 * time.Second); count == 0 && time.Now().Before(deadline); time.Sleep(50 * time.Millisecond) {
+			families, _ := registry.Gather()
+			for _, family := range families {
+				if family.GetName() == "powermetrics_gpu_usage_percent" {
+					count = family.GetMetric()[0].GetSummary().GetSampleCount()
+				}
+			}
+		}
+		if count == 0 {
+			t.Errorf("Expected the %s output to summarize a GPU usage sample", name)
+		}
+	}
+}
@@ -0,0 +1,20 @@
+package version
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// Build information, injected at build time with
+//
+//	go build -ldflags "-X mac-powermetrics-exporter/internal/version.Version=v1.2.3 -X mac-powermetrics-exporter/internal/version.Commit=$(git rev-parse --short HEAD) -X mac-powermetrics-exporter/internal/version.Date=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+var (
+	Version = "dev"
+	Commit  = "unknown"
+	Date    = "unknown"
+)
+
+// Info returns the build information as printed by -version
+func Info() string {
+	return fmt.Sprintf("mac-powermetrics-exporter %s (commit %s, built %s, %s %s/%s)", Version, Commit, Date, runtime.Version(), runtime.GOOS, runtime.GOARCH)
+}